@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// setHeaders добавляет к запросу User-Agent, Config.Headers и, для
+// хостов сайта, логин и пароль Basic: на другие хосты (CDN, чужие
+// сайты) пароль не отправляется
+func (c *Crawler) setHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", c.cfg.UserAgent)
+	for name, values := range c.cfg.Headers {
+		if strings.EqualFold(name, "Host") && len(values) > 0 {
+			req.Host = values[0]
+			continue
+		}
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if c.cfg.Username != "" && c.scope.isSite(req.URL.Hostname()) {
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+}
+
+// login входит на сайт формой перед обходом: отправляет
+// Config.LoginData POST-запросом на Config.LoginURL, а cookie сессии
+// из ответа попадают в jar и отправляются со всеми запросами обхода
+func (c *Crawler) login(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.LoginURL, strings.NewReader(c.cfg.LoginData))
+	if err != nil {
+		return fmt.Errorf("login failed: %v", err)
+	}
+	c.setHeaders(req)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("login failed: %w", &httpError{url: c.cfg.LoginURL, status: resp.StatusCode, text: resp.Status})
+	}
+	c.progress.log("logged in: %s", c.cfg.LoginURL)
+	return nil
+}
@@ -0,0 +1,195 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Значения по умолчанию для таймаутов и повторов
+const (
+	DefaultConnectTimeout = 30 * time.Second
+	DefaultReadTimeout    = 60 * time.Second
+	DefaultRetryWait      = time.Second
+
+	maxRedirects  = 10
+	maxRetryWait  = time.Minute     // предел паузы между повторами
+	maxRetryAfter = 5 * time.Minute // предел Retry-After от сервера
+)
+
+// newHTTPClient создает один клиент на весь обход: соединения с хостом
+// переиспользуются всеми воркерами. Таймауты ограничивают подключение,
+// TLS и ожидание заголовков; паузы в теле ответа ограничивает idleReader,
+// а не общий таймаут, чтобы большие файлы успевали скачаться.
+// allowRedirect решает, идти ли по перенаправлению.
+func newHTTPClient(cfg Config, allowRedirect func(*url.URL) bool) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			TLSClientConfig:       &tls.Config{InsecureSkipVerify: cfg.SkipTLSVerify},
+			TLSHandshakeTimeout:   cfg.ConnectTimeout,
+			ResponseHeaderTimeout: cfg.ReadTimeout,
+			ExpectContinueTimeout: time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   cfg.Concurrency,
+			ForceAttemptHTTP2:     true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if !allowRedirect(req.URL) {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+// allowRedirect не дает клиенту уходить по перенаправлениям за границы
+// обхода. Ресурс это или страница, здесь неизвестно, поэтому граница
+// берется как для ресурсов; страницы проверяет claimRedirect.
+func (c *Crawler) allowRedirect(u *url.URL) bool {
+	return c.scope.allows(normalizeURL(u), true)
+}
+
+// timeoutError - таймаут, который не вернул сам net/http
+type timeoutError struct{ op string }
+
+func (e timeoutError) Error() string { return e.op + " timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var errReadTimeout = timeoutError{"read"}
+
+// idleReader прерывает чтение тела ответа, если данные не приходят
+// дольше timeout: по истечении вызывается cancel запроса, а Read
+// возвращает errReadTimeout
+type idleReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func newIdleReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleReader {
+	ir := &idleReader{r: r, timeout: timeout}
+	ir.timer = time.AfterFunc(timeout, func() {
+		ir.expired.Store(true)
+		cancel()
+	})
+	return ir
+}
+
+func (r *idleReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if r.expired.Load() {
+		return n, errReadTimeout
+	}
+	r.timer.Reset(r.timeout)
+	return n, err
+}
+
+// stop отключает таймаут
+func (r *idleReader) stop() {
+	r.timer.Stop()
+}
+
+// retryable сообщает, стоит ли повторить запрос: повторяются сетевые
+// ошибки и таймауты, оборванные ответы, 5xx и 429. Ошибки DNS "нет
+// такого хоста", сертификатов и файловой системы повтор не исправит.
+func retryable(err error) bool {
+	var (
+		httpErr *httpError
+		dnsErr  *net.DNSError
+		certErr *tls.CertificateVerificationError
+		netErr  net.Error
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &httpErr):
+		return httpErr.status >= 500 || httpErr.status == http.StatusTooManyRequests
+	case errors.As(err, &dnsErr):
+		return !dnsErr.IsNotFound
+	case errors.As(err, &certErr):
+		return false
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	return false
+}
+
+// retryDelay возвращает паузу перед повтором attempt (с 0): base,
+// умноженную на 2^attempt, не больше maxRetryWait, со случайным
+// разбросом до половины, чтобы воркеры не повторяли запросы разом.
+// Retry-After от сервера важнее, если он больше.
+func retryDelay(base time.Duration, attempt int, err error) time.Duration {
+	delay := maxRetryWait
+	if attempt < 16 && base<<attempt < maxRetryWait {
+		delay = base << attempt
+	}
+	delay = delay/2 + rand.N(delay/2+1)
+
+	var httpErr *httpError
+	if errors.As(err, &httpErr) && httpErr.retryAfter > delay {
+		delay = min(httpErr.retryAfter, maxRetryAfter)
+	}
+	return delay
+}
+
+// parseRetryAfter разбирает Retry-After: секунды или HTTP дата
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// downloadWithRetry скачивает URL, повторяя временные ошибки до
+// Config.Retries раз. Недокачанный файл при повторе докачивается.
+func (c *Crawler) downloadWithRetry(ctx context.Context, t task) (downloadResult, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := c.download(ctx, t)
+		if err == nil || attempt >= c.cfg.Retries || ctx.Err() != nil || !retryable(err) {
+			return result, err
+		}
+
+		if err := c.waitRetry(ctx, attempt, err); err != nil {
+			return result, err
+		}
+	}
+}
+
+// waitRetry сообщает о повторе после ошибки err и выдерживает паузу
+// перед попыткой attempt+1; при остановке обхода возвращает ctx.Err()
+func (c *Crawler) waitRetry(ctx context.Context, attempt int, err error) error {
+	delay := retryDelay(c.cfg.RetryWait, attempt, err)
+	c.progress.log("retrying in %s (%d/%d): %v", delay.Round(time.Millisecond), attempt+1, c.cfg.Retries, err)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,241 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// savedPage - сохраненный документ, ссылки в котором переписываются
+// для просмотра без сети
+type savedPage struct {
+	url  *url.URL
+	kind string // "html" или "css"
+}
+
+// recordSaved запоминает, куда сохранен URL, и, если это HTML или CSS,
+// ставит файл в очередь на переписывание ссылок
+func (c *Crawler) recordSaved(u *url.URL, relativePath, contentType string) {
+	c.savedFiles.Store(normalizeURL(u).String(), relativePath)
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		c.savedPages.Store(relativePath, &savedPage{url: u, kind: "html"})
+	case mediaType == "text/css" || mediaType == "" && filepath.Ext(relativePath) == ".css":
+		c.savedPages.Store(relativePath, &savedPage{url: u, kind: "css"})
+	}
+}
+
+// ConvertLinks переписывает ссылки в сохраненных HTML и CSS файлах,
+// как wget -k: ссылки на скачанные файлы становятся относительными
+// путями внутри зеркала, а ссылки на нескачанные страницы сайта -
+// полными URL, чтобы они не указывали в корень файловой системы.
+// Возвращает число обработанных файлов.
+func (c *Crawler) ConvertLinks() (int, error) {
+	converted := 0
+	var firstErr error
+	c.savedPages.Range(func(key, value any) bool {
+		relativePath, page := key.(string), value.(*savedPage)
+		if err := c.convertFile(relativePath, page); err != nil {
+			firstErr = err
+			return false
+		}
+		converted++
+		return true
+	})
+	return converted, firstErr
+}
+
+func (c *Crawler) convertFile(relativePath string, page *savedPage) error {
+	data, err := readFile(c.cfg.Storage, relativePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", relativePath, err)
+	}
+
+	var result []byte
+	if page.kind == "html" {
+		result, err = c.rewriteHTML(data, page.url, relativePath)
+		if err != nil {
+			return fmt.Errorf("failed to parse HTML from %s: %v", relativePath, err)
+		}
+	} else {
+		result = []byte(rewriteCSS(string(data), c.linkRewriter(page.url, relativePath)))
+	}
+
+	if bytes.Equal(result, data) {
+		return nil
+	}
+	if err := replaceFile(c.cfg.Storage, relativePath, result); err != nil {
+		return fmt.Errorf("failed to save content to %s: %v", relativePath, err)
+	}
+	return nil
+}
+
+// linkRewriter возвращает функцию, которая переписывает ссылку из файла
+// from, ссылки которого разрешаются от base. Ссылки на нескачанные
+// файлы других хостов, якоря внутри страницы и схемы кроме http(s)
+// не меняются.
+func (c *Crawler) linkRewriter(base *url.URL, from string) func(string) string {
+	return func(link string) string {
+		target, ok := resolveLink(base, link)
+		if !ok {
+			return link
+		}
+		// resolveLink отбрасывает фрагмент, а в ссылке его надо сохранить
+		fragment := ""
+		if ref, err := url.Parse(strings.TrimSpace(link)); err == nil {
+			fragment = ref.Fragment
+		}
+
+		saved, ok := c.savedFiles.Load(target.String())
+		if !ok {
+			// перенаправленный URL сохранен под итоговым
+			if final, redirected := c.redirects.Load(target.String()); redirected {
+				saved, ok = c.savedFiles.Load(final)
+			}
+		}
+		if !ok {
+			if target.Host != c.baseURL.Host {
+				return link
+			}
+			target.Fragment = fragment
+			return target.String()
+		}
+		rel, err := filepath.Rel(filepath.Dir(from), saved.(string))
+		if err != nil {
+			target.Fragment = fragment
+			return target.String()
+		}
+		local := &url.URL{Path: filepath.ToSlash(rel), Fragment: fragment}
+		return local.String()
+	}
+}
+
+// urlAttrs - атрибуты, значение которых целиком является ссылкой. Атрибут
+// data - ссылка только у <object>, как в assetAttrs.
+var urlAttrs = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"poster":     true,
+	"background": true,
+}
+
+// rewriteHTML переписывает ссылки в атрибутах, srcset, атрибутах style
+// и элементах <style>. Документ разбирается потоком токенов: неизмененные
+// токены выводятся байт в байт, чтобы разметка не переформатировалась.
+// Элемент <base> удаляется - после переписывания ссылки относительны
+// самого файла.
+func (c *Crawler) rewriteHTML(data []byte, pageURL *url.URL, from string) ([]byte, error) {
+	var out bytes.Buffer
+	rewrite := c.linkRewriter(pageURL, from)
+	inStyle := false
+
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return out.Bytes(), nil
+			}
+			return nil, z.Err()
+		}
+		raw := append([]byte(nil), z.Raw()...)
+		tok := z.Token()
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if tok.Data == "base" {
+				for _, a := range tok.Attr {
+					if a.Key == "href" {
+						if ref, err := url.Parse(strings.TrimSpace(a.Val)); err == nil {
+							rewrite = c.linkRewriter(pageURL.ResolveReference(ref), from)
+						}
+					}
+				}
+				continue
+			}
+			inStyle = tt == html.StartTagToken && tok.Data == "style"
+
+			changed := false
+			for i, a := range tok.Attr {
+				value := a.Val
+				switch {
+				case urlAttrs[a.Key], a.Key == "data" && tok.Data == "object":
+					value = rewrite(a.Val)
+				case a.Key == "srcset":
+					value = rewriteSrcset(a.Val, rewrite)
+				case a.Key == "style":
+					value = rewriteCSS(a.Val, rewrite)
+				}
+				if value != a.Val {
+					tok.Attr[i].Val = value
+					changed = true
+				}
+			}
+			if changed {
+				out.WriteString(tok.String())
+				continue
+			}
+		case html.EndTagToken:
+			if tok.Data == "style" {
+				inStyle = false
+			}
+		case html.TextToken:
+			if inStyle {
+				out.WriteString(rewriteCSS(string(raw), rewrite))
+				continue
+			}
+		}
+		out.Write(raw)
+	}
+}
+
+// rewriteSrcset переписывает адреса в списке вида "a.png 1x, b.png 2x",
+// сохраняя дескрипторы
+func rewriteSrcset(srcset string, rewrite func(string) string) string {
+	candidates := parseSrcset(srcset)
+	parts := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		parts[i] = rewrite(candidate.url)
+		if candidate.descriptor != "" {
+			parts[i] += " " + candidate.descriptor
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+var (
+	// cssURL находит url(...) с кавычками и без
+	cssURL = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+	// cssImport находит @import "..." без url()
+	cssImport = regexp.MustCompile(`(?i)@import\s+(?:"([^"]*)"|'([^']*)')`)
+)
+
+// rewriteCSS переписывает ссылки в url(...) и @import
+func rewriteCSS(css string, rewrite func(string) string) string {
+	css = replaceCSSRefs(cssURL, css, rewrite)
+	return replaceCSSRefs(cssImport, css, rewrite)
+}
+
+// replaceCSSRefs заменяет в каждом совпадении re первую сработавшую
+// группу - адрес без кавычек
+func replaceCSSRefs(re *regexp.Regexp, css string, rewrite func(string) string) string {
+	return re.ReplaceAllStringFunc(css, func(match string) string {
+		sub := re.FindStringSubmatchIndex(match)
+		for i := 1; i < len(sub)/2; i++ {
+			start, end := sub[2*i], sub[2*i+1]
+			if start >= 0 && end > start {
+				return match[:start] + rewrite(match[start:end]) + match[end:]
+			}
+		}
+		return match
+	})
+}
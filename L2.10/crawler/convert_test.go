@@ -0,0 +1,166 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+)
+
+// convertCrawler возвращает обходчик, который уже сохранил несколько
+// файлов сайта example.com, и адрес страницы docs/page.html
+func convertCrawler(t *testing.T) (*Crawler, *url.URL) {
+	c, err := New(Config{URL: "http://example.com/", OutputDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := []struct{ url, path, contentType string }{
+		{"http://example.com/docs/page.html", "docs/page.html", "text/html"},
+		{"http://example.com/index.html", "index.html", "text/html"},
+		{"http://example.com/img/a.png", "img/a.png", "image/png"},
+		{"http://example.com/img/b.png", "img/b.png", "image/png"},
+		{"http://example.com/css/s.css", "css/s.css", "text/css"},
+		{"http://example.com/new.html", "new.html", "text/html"},
+		{"http://cdn.example.net/lib.js", "cdn.example.net/lib.js", "text/javascript"},
+	}
+	for _, file := range saved {
+		u, err := url.Parse(file.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.recordSaved(u, file.path, file.contentType)
+	}
+	c.redirects.Store("http://example.com/old", "http://example.com/new.html")
+
+	page, _ := url.Parse("http://example.com/docs/page.html")
+	return c, page
+}
+
+func TestLinkRewriter(t *testing.T) {
+	c, page := convertCrawler(t)
+	rewrite := c.linkRewriter(page, "docs/page.html")
+	tests := []struct {
+		link     string
+		expected string
+	}{
+		{"/index.html", "../index.html"},
+		{"http://example.com/img/a.png", "../img/a.png"},
+		{"HTTP://Example.COM:80/img/a.png", "../img/a.png"},
+		{"../img/a.png", "../img/a.png"},
+		{"page.html", "page.html"},
+		{"/index.html#top", "../index.html#top"},
+		{"http://cdn.example.net/lib.js", "../cdn.example.net/lib.js"},
+		// перенаправленный URL ведет на файл итогового
+		{"/old", "../new.html"},
+		// нескачанные страницы сайта - полные URL, другие хосты не меняются
+		{"/missing", "http://example.com/missing"},
+		{"missing#part", "http://example.com/docs/missing#part"},
+		{"http://cdn.example.net/other.js", "http://cdn.example.net/other.js"},
+		{"#top", "#top"},
+		{"mailto:a@example.com", "mailto:a@example.com"},
+		{"javascript:void(0)", "javascript:void(0)"},
+	}
+	for _, test := range tests {
+		if result := rewrite(test.link); result != test.expected {
+			t.Errorf("rewrite(%q) = %q, ожидалось %q", test.link, result, test.expected)
+		}
+	}
+}
+
+func TestRewriteHTML(t *testing.T) {
+	c, page := convertCrawler(t)
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			"ссылки от корня и полные",
+			`<a href="/index.html">i</a><a href="http://example.com/img/a.png#x">a</a>`,
+			`<a href="../index.html">i</a><a href="../img/a.png#x">a</a>`,
+		},
+		{
+			"base удаляется, ссылки разрешаются от него",
+			`<head><base href="/img/"></head><img src="a.png">`,
+			`<head></head><img src="../img/a.png">`,
+		},
+		{
+			"srcset с дескрипторами",
+			`<img srcset="/img/a.png 1x,/img/b.png 2x">`,
+			`<img srcset="../img/a.png 1x, ../img/b.png 2x">`,
+		},
+		{
+			"атрибут style",
+			`<div style="background:url(/img/a.png)"></div>`,
+			`<div style="background:url(../img/a.png)"></div>`,
+		},
+		{
+			"элемент style",
+			`<style>@import "/css/s.css"; p{background:url('/img/b.png')}</style><p>url(/img/b.png)</p>`,
+			`<style>@import "../css/s.css"; p{background:url('../img/b.png')}</style><p>url(/img/b.png)</p>`,
+		},
+		{
+			"атрибут data только у object",
+			`<object data="/img/a.png"></object><div data="/img/a.png"></div>`,
+			`<object data="../img/a.png"></object><div data="/img/a.png"></div>`,
+		},
+		{
+			"нескачанная страница сайта",
+			`<a href="/missing">m</a><a href="http://other.example.org/">o</a>`,
+			`<a href="http://example.com/missing">m</a><a href="http://other.example.org/">o</a>`,
+		},
+		{
+			"неизмененная разметка сохраняется байт в байт",
+			"<P CLASS=x>text</P>\n<a href='#top'>top</a>",
+			"<P CLASS=x>text</P>\n<a href='#top'>top</a>",
+		},
+	}
+	for _, test := range tests {
+		result, err := c.rewriteHTML([]byte(test.html), page, "docs/page.html")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if string(result) != test.expected {
+			t.Errorf("%s: получили %s, ожидалось %s", test.name, result, test.expected)
+		}
+	}
+}
+
+func TestRewriteCSS(t *testing.T) {
+	rewrite := func(link string) string { return "x/" + link }
+	tests := []struct {
+		css      string
+		expected string
+	}{
+		{"a{background:url(a.png)}", "a{background:url(x/a.png)}"},
+		{`a{background:URL( "a b.png" )}`, `a{background:URL( "x/a b.png" )}`},
+		{"a{background:url('a.png')}", "a{background:url('x/a.png')}"},
+		{`@import "s.css";`, `@import "x/s.css";`},
+		{`@import 's.css' screen;`, `@import 'x/s.css' screen;`},
+		{"@import url(s.css);", "@import url(x/s.css);"},
+		{"a{background:url()}", "a{background:url()}"},
+	}
+	for _, test := range tests {
+		if result := rewriteCSS(test.css, rewrite); result != test.expected {
+			t.Errorf("rewriteCSS(%q) = %q, ожидалось %q", test.css, result, test.expected)
+		}
+	}
+}
+
+func TestRewriteSrcset(t *testing.T) {
+	rewrite := func(link string) string { return "x/" + link }
+	tests := []struct {
+		srcset   string
+		expected string
+	}{
+		{"a.png", "x/a.png"},
+		{"a.png 1x,  b.png 2x", "x/a.png 1x, x/b.png 2x"},
+		{"a.png 100w, b.png 200w", "x/a.png 100w, x/b.png 200w"},
+		{"data:image/png;base64,AAA= 1x,b.png 2x", "x/data:image/png;base64,AAA= 1x, x/b.png 2x"},
+		{"a.png,b.png", "x/a.png,b.png"},
+		{"a.png, b.png", "x/a.png, x/b.png"},
+	}
+	for _, test := range tests {
+		if result := rewriteSrcset(test.srcset, rewrite); result != test.expected {
+			t.Errorf("rewriteSrcset(%q) = %q, ожидалось %q", test.srcset, result, test.expected)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package crawler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// httpOnlyPrefix - префикс строк с HttpOnly cookie в cookies.txt (как у curl)
+const httpOnlyPrefix = "#HttpOnly_"
+
+// savedCookie - cookie в том виде, в каком она пишется в cookies.txt
+type savedCookie struct {
+	domain   string // без точки в начале
+	hostOnly bool   // только для domain, без поддоменов
+	path     string
+	secure   bool
+	httpOnly bool
+	expires  time.Time // нулевое - cookie сессии
+	name     string
+	value    string
+}
+
+// cookieJar - cookiejar.Jar, который помнит все полученные cookie, чтобы
+// сохранить их в файл: стандартный Jar отдает cookie только для URL
+type cookieJar struct {
+	jar *cookiejar.Jar
+
+	mu      sync.Mutex
+	cookies map[string]*savedCookie // домен;путь;имя -> cookie
+}
+
+func newCookieJar() (*cookieJar, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	return &cookieJar{jar: jar, cookies: make(map[string]*savedCookie)}, nil
+}
+
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	for _, cookie := range cookies {
+		saved := &savedCookie{
+			domain:   strings.ToLower(u.Hostname()),
+			hostOnly: true,
+			path:     cookie.Path,
+			secure:   cookie.Secure,
+			httpOnly: cookie.HttpOnly,
+			name:     cookie.Name,
+			value:    cookie.Value,
+		}
+		if cookie.Domain != "" {
+			saved.domain = strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+			saved.hostOnly = false
+		}
+		if !strings.HasPrefix(saved.path, "/") {
+			saved.path = defaultCookiePath(u.Path)
+		}
+		switch {
+		case cookie.MaxAge < 0:
+			saved.expires = time.Unix(1, 0)
+		case cookie.MaxAge > 0:
+			saved.expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		case !cookie.Expires.IsZero():
+			saved.expires = cookie.Expires
+		}
+
+		key := saved.domain + ";" + saved.path + ";" + saved.name
+		if !saved.expires.IsZero() && saved.expires.Before(now) {
+			// истекшая cookie - сервер ее удаляет
+			delete(j.cookies, key)
+			continue
+		}
+		if !j.accepted(saved) {
+			continue
+		}
+		j.cookies[key] = saved
+	}
+}
+
+// accepted сообщает, что jar принял cookie. Cookie с чужим доменом или
+// доменом-публичным суффиксом он отбрасывает, и в файл их писать нельзя:
+// при загрузке они бы ушли на тот домен.
+func (j *cookieJar) accepted(cookie *savedCookie) bool {
+	u := &url.URL{Scheme: "http", Host: cookie.domain, Path: cookie.path}
+	if cookie.secure {
+		u.Scheme = "https"
+	}
+	if strings.Contains(cookie.domain, ":") {
+		u.Host = "[" + cookie.domain + "]"
+	}
+	for _, got := range j.jar.Cookies(u) {
+		if got.Name == cookie.name && got.Value == cookie.value {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultCookiePath - путь cookie без атрибута Path (RFC 6265, 5.1.4)
+func defaultCookiePath(urlPath string) string {
+	i := strings.LastIndex(urlPath, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return urlPath[:i]
+}
+
+// load читает cookies.txt в формате Netscape; если файла нет, jar пуст.
+// Строка файла: домен, флаг поддоменов, путь, secure, срок (Unix),
+// имя и значение через табуляцию.
+func (j *cookieJar) load(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cookies: %v", err)
+	}
+	defer file.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return fmt.Errorf("failed to parse cookies %s:%d: expected 7 tab-separated fields", path, lineNum)
+		}
+		seconds, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse cookies %s:%d: invalid expiry %q", path, lineNum, fields[4])
+		}
+
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if seconds != 0 {
+			if cookie.Expires = time.Unix(seconds, 0); cookie.Expires.Before(now) {
+				continue
+			}
+		}
+		host := strings.TrimPrefix(fields[0], ".")
+		if strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = host
+		}
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		j.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: fields[2]}, []*http.Cookie{cookie})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read cookies: %v", err)
+	}
+	return nil
+}
+
+// save записывает cookie, включая cookie сессии, в файл в формате Netscape
+func (j *cookieJar) save(path string) error {
+	j.mu.Lock()
+	lines := make([]string, 0, len(j.cookies))
+	now := time.Now()
+	for _, cookie := range j.cookies {
+		if !cookie.expires.IsZero() && cookie.expires.Before(now) {
+			continue
+		}
+		domain, subdomains := cookie.domain, "FALSE"
+		if !cookie.hostOnly {
+			domain, subdomains = "."+cookie.domain, "TRUE"
+		}
+		if cookie.httpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		var expires int64
+		if !cookie.expires.IsZero() {
+			expires = cookie.expires.Unix()
+		}
+		secure := "FALSE"
+		if cookie.secure {
+			secure = "TRUE"
+		}
+		lines = append(lines, strings.Join([]string{
+			domain, subdomains, cookie.path, secure, strconv.FormatInt(expires, 10), cookie.name, cookie.value,
+		}, "\t"))
+	}
+	j.mu.Unlock()
+	sort.Strings(lines)
+
+	data := "# Netscape HTTP Cookie File\n" + strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		data += "\n"
+	}
+	// в файле могут быть сессии - читать его может только владелец
+	if err := writeFileAtomic(path, []byte(data), 0600); err != nil {
+		return fmt.Errorf("failed to save cookies: %v", err)
+	}
+	return nil
+}
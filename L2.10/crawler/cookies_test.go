@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCookieJarDomains(t *testing.T) {
+	jar, err := newCookieJar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("http://www.site.com/app/login")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "parent", Value: "2", Domain: "site.com", Path: "/"},
+		{Name: "secure", Value: "3", Domain: ".www.site.com", Path: "/", Secure: true},
+		// чужой домен и публичный суффикс jar отбрасывает
+		{Name: "evil", Value: "4", Domain: "evil.com", Path: "/"},
+		{Name: "suffix", Value: "5", Domain: "com", Path: "/"},
+		{Name: "sibling", Value: "6", Domain: "other.site.com", Path: "/"},
+	})
+
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := jar.save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# Netscape HTTP Cookie File\n" +
+		".site.com\tTRUE\t/\tFALSE\t0\tparent\t2\n" +
+		".www.site.com\tTRUE\t/\tTRUE\t0\tsecure\t3\n" +
+		"www.site.com\tFALSE\t/app\tFALSE\t0\thost\t1\n"
+	if string(data) != expected {
+		t.Errorf("cookies.txt:\n%s\nожидалось:\n%s", data, expected)
+	}
+
+	// после загрузки cookie не уходит на чужой домен
+	loaded, err := newCookieJar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if cookies := loaded.Cookies(&url.URL{Scheme: "http", Host: "evil.com", Path: "/"}); len(cookies) != 0 {
+		t.Errorf("для evil.com отправляются %v", cookies)
+	}
+	if cookies := loaded.Cookies(&url.URL{Scheme: "http", Host: "www.site.com", Path: "/app/x"}); len(cookies) != 2 {
+		t.Errorf("для www.site.com %v, ожидались host и parent", cookies)
+	}
+}
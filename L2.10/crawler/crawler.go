@@ -0,0 +1,495 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config - параметры обхода сайта
+type Config struct {
+	URL           string  // стартовый URL, его хост - сайт
+	MaxDepth      int     // глубина рекурсии, 0 - только стартовая страница
+	OutputDir     string  // каталог зеркала, если не задан Storage
+	Storage       Storage // хранилище зеркала, по умолчанию DirStorage(OutputDir)
+	Concurrency   int     // число одновременных загрузок
+	IncludeAssets bool    // скачивать картинки, скрипты и стили
+	SkipTLSVerify bool    // не проверять сертификаты
+
+	UserAgent    string        // заголовок User-Agent и агент для robots.txt
+	IgnoreRobots bool          // не читать robots.txt - для своих сайтов
+	Delay        time.Duration // пауза между запросами к одному хосту
+	Timestamping bool          // не перекачивать файлы, не изменившиеся на сервере
+
+	AdjustExtension bool // добавлять .html и .css к именам по Content-Type
+
+	// Границы обхода, см. scope. Сайт - хост стартового URL вместе
+	// с вариантом с www. или без.
+	Domains        []string // другие домены, страницы которых тоже скачиваются
+	ExcludeDomains []string // домены, которые не скачиваются никогда
+	SpanHosts      bool     // скачивать ресурсы страниц с любых хостов
+	NoParent       bool     // не подниматься выше каталога стартового URL
+	IncludeDirs    []string // скачивать только из этих каталогов
+	ExcludeDirs    []string // не скачивать из этих каталогов
+	AcceptRegex    string   // скачивать только URL, подходящие под выражение
+	RejectRegex    string   // не скачивать URL, подходящие под выражение
+	Accept         []string // сохранять только файлы с этими окончаниями или шаблонами имен
+	Reject         []string // не сохранять файлы с этими окончаниями или шаблонами имен
+
+	Progress io.Writer // вывод прогресса и журнала обхода, nil - без вывода
+
+	ConnectTimeout time.Duration // подключение и TLS, 0 - DefaultConnectTimeout
+	ReadTimeout    time.Duration // ожидание данных от сервера, 0 - DefaultReadTimeout
+	Retries        int           // повторы при временных ошибках, 5xx и 429
+	RetryWait      time.Duration // пауза перед первым повтором, 0 - DefaultRetryWait
+
+	// Пределы, 0 - без предела
+	LimitRate     int64 // байт в секунду на все загрузки
+	HostLimitRate int64 // байт в секунду на загрузки с одного хоста
+	Quota         int64 // байт за обход; файл, начатый до превышения, докачивается
+	MaxFileSize   int64 // байт на файл; большие файлы пропускаются
+	MaxPages      int   // страниц (не ресурсов) за обход
+
+	Headers    http.Header // дополнительные заголовки всех запросов
+	Username   string      // логин Basic, отправляется только хостам сайта
+	Password   string
+	CookieFile string // cookies.txt в формате Netscape: читается до обхода и сохраняется после
+	LoginURL   string // адрес формы входа, на который до обхода отправляются LoginData
+	LoginData  string // поля формы входа: user=me&pass=secret
+
+	// WARCFile - если задан, все запросы и ответы обхода пишутся
+	// в WARCFile.warc.gz с индексом WARCFile.cdx, кроме каталога зеркала
+	WARCFile string
+
+	// Дополнительные стартовые URL глубины 0. Повторы отсекаются так же,
+	// как повторы ссылок.
+	Seeds    []string // URL из списка -i; границы обхода к ним не применяются
+	Sitemaps bool     // брать страницы из sitemap.xml и строк Sitemap в robots.txt
+
+	// Хуки для встраивания краулера в свои программы. Воркеры вызывают
+	// их одновременно, поэтому хуки должны быть безопасны для этого.
+	OnRequest    func(req *http.Request)                      // перед отправкой любого запроса; может менять заголовки
+	OnResponse   func(resp *http.Response)                    // после заголовков ответа; тело читает краулер
+	OnLink       func(page, target *url.URL, asset bool)      // каждая найденная ссылка, до проверки границ обхода
+	ShouldFollow func(u *url.URL, depth int, asset bool) bool // дополнительный фильтр ссылок в границах обхода
+}
+
+// DefaultUserAgent - User-Agent, если он не задан в Config
+const DefaultUserAgent = "L2-wget/1.0"
+
+type Crawler struct {
+	cfg         Config
+	baseURL     *url.URL
+	client      *http.Client
+	visitedURLs sync.Map
+	state       *crawlState
+	names       *fileNamer
+	scope       *scope
+	report      *report
+	progress    *progress
+
+	// redirects - URL -> итоговый URL после перенаправлений
+	redirects sync.Map
+
+	limiter  *rateLimiter // общее ограничение скорости
+	received atomic.Int64 // получено байт - для Config.Quota
+	pages    atomic.Int64 // начато страниц - для Config.MaxPages
+
+	jar  *cookieJar
+	warc *warcWriter
+
+	// hosts - схема://хост -> *hostState: robots.txt и паузы между запросами
+	hosts sync.Map
+
+	// savedFiles - URL без фрагмента -> путь файла относительно outputDir,
+	// savedPages - путь файла -> страница, ссылки в которой можно переписать
+	savedFiles sync.Map
+	savedPages sync.Map
+}
+
+// New создает краулер по параметрам cfg. Краулеры в одном процессе
+// независимы, если у них разные хранилища.
+func New(cfg Config) (*Crawler, error) {
+	parsedURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" || parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid URL: %s is not an absolute http(s) URL", cfg.URL)
+	}
+	for _, seed := range cfg.Seeds {
+		if u, err := url.Parse(seed); err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL in URL list: %s is not an absolute http(s) URL", seed)
+		}
+	}
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = DefaultConnectTimeout
+	}
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = DefaultReadTimeout
+	}
+	if cfg.RetryWait <= 0 {
+		cfg.RetryWait = DefaultRetryWait
+	}
+	if cfg.Storage == nil {
+		cfg.Storage = DirStorage(cfg.OutputDir)
+	}
+	parsedURL = normalizeURL(parsedURL)
+	scope, err := newScope(parsedURL.Hostname(), parsedURL.Path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadState(cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := newCookieJar()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CookieFile != "" {
+		if err := jar.load(cfg.CookieFile); err != nil {
+			return nil, err
+		}
+	}
+
+	report := newReport()
+	c := &Crawler{
+		cfg:      cfg,
+		baseURL:  parsedURL,
+		state:    state,
+		names:    newFileNamer(parsedURL.Host, cfg.AdjustExtension),
+		scope:    scope,
+		report:   report,
+		progress: newProgress(cfg.Progress, report),
+		limiter:  newRateLimiter(cfg.LimitRate),
+		jar:      jar,
+	}
+	c.client = newHTTPClient(cfg, c.allowRedirect)
+	c.client.Jar = jar
+	if cfg.WARCFile != "" {
+		if c.warc, err = openWARC(cfg.WARCFile); err != nil {
+			return nil, err
+		}
+		// в архив попадает тело в том виде, в каком его отдал сервер
+		transport := c.client.Transport.(*http.Transport)
+		transport.DisableCompression = true
+		c.client.Transport = &warcTransport{next: transport, warc: c.warc}
+	}
+	return c, nil
+}
+
+// Run скачивает сайт в ширину, начиная с Config.URL, силами
+// Config.Concurrency воркеров. Если прошлый обход был прерван,
+// продолжает его: законченные URL пропускаются, а найденные, но не
+// законченные скачиваются снова. При отмене ctx обход останавливается,
+// состояние сохраняется и возвращается ctx.Err(); ошибки отдельных URL
+// собираются и возвращаются вместе. Run вызывается один раз.
+func (c *Crawler) Run(ctx context.Context) (err error) {
+	f := newFrontier()
+	stop := context.AfterFunc(ctx, f.close)
+	defer stop()
+	// WARC закрывается при любом выходе, в том числе при неудачном входе,
+	// иначе в архиве не будет индекса
+	if c.warc != nil {
+		defer func() {
+			if closeErr := c.warc.close(); closeErr != nil {
+				err = errors.Join(err, closeErr)
+			}
+		}()
+	}
+	c.progress.start()
+	defer c.progress.finish()
+
+	if c.cfg.LoginURL != "" {
+		if err := c.login(ctx); err != nil {
+			return err
+		}
+	}
+
+	done, pending := c.state.resume()
+	// имена файлов прошлых запусков остаются за своими URL
+	for urlStr, path := range c.state.paths() {
+		c.names.claim(urlStr, path)
+	}
+	for urlStr := range done {
+		c.visitedURLs.Store(urlStr, true)
+		meta := c.state.meta(urlStr)
+		c.report.discover(urlStr, done[urlStr])
+		c.report.finish(urlStr, statusResumed, meta, 0)
+		if u, err := url.Parse(urlStr); err == nil && meta.Path != "" && c.scope.acceptsFile(u.Path) {
+			c.recordSaved(u, meta.Path, meta.ContentType)
+		}
+	}
+	// незаконченные URL уже прошли проверку границ обхода
+	for urlStr, depth := range pending {
+		if u, err := url.Parse(urlStr); err == nil {
+			c.push(f, u, depth, false)
+		}
+	}
+	c.push(f, c.baseURL, 0, false)
+	for _, seed := range c.cfg.Seeds {
+		if u, err := url.Parse(seed); err == nil {
+			c.push(f, u, 0, false)
+		}
+	}
+	// страницы из карт сайта - как ссылки со стартовой страницы
+	if c.cfg.Sitemaps {
+		for _, u := range c.sitemapURLs(ctx) {
+			c.enqueue(f, link{url: u}, 0)
+		}
+	}
+
+	var (
+		mu    sync.Mutex
+		errs  []error
+		wg    sync.WaitGroup
+		quota atomic.Bool
+	)
+	for i := 0; i < c.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				t, ok := f.pop()
+				if !ok {
+					return
+				}
+				links, err := c.process(ctx, t)
+				switch {
+				case err == nil:
+					// ссылки попадают в очередь раньше, чем страница
+					// отмечается законченной, чтобы не потерять их
+					// при остановке
+					for _, l := range links {
+						depth := t.depth + 1
+						if l.asset {
+							depth = t.depth
+						}
+						c.enqueue(f, l, depth)
+					}
+					if err := c.state.finish(t.url.String()); err != nil {
+						mu.Lock()
+						errs = append(errs, err)
+						mu.Unlock()
+					}
+				case errors.Is(err, ErrQuotaExceeded):
+					// URL остается незаконченным до следующего запуска
+					quota.Store(true)
+					f.close()
+				case ctx.Err() == nil:
+					// неудачный URL остается в состоянии и будет
+					// скачан снова при продолжении обхода
+					c.report.fail(t.url.String(), err)
+					c.progress.log("failed: %v", err)
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+				f.done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.cfg.CookieFile != "" {
+		if err := c.jar.save(c.cfg.CookieFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if ctx.Err() != nil {
+		if err := c.state.save(); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+	if quota.Load() {
+		if err := c.state.save(); err != nil {
+			return err
+		}
+		return ErrQuotaExceeded
+	}
+	if len(errs) > 0 {
+		if err := c.state.save(); err != nil {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+	return c.state.complete()
+}
+
+// Stats возвращает итоги обхода
+func (c *Crawler) Stats() Stats {
+	return c.report.stats()
+}
+
+// WriteReport сохраняет в path отчет об обходе в JSON: итоги и для
+// каждого найденного URL - статус, путь файла и ошибку
+func (c *Crawler) WriteReport(path string) error {
+	return c.report.write(path, c.baseURL.String())
+}
+
+// SaveState сохраняет состояние обхода, чтобы следующий запуск
+// продолжил его с того же места
+func (c *Crawler) SaveState() error {
+	return c.state.save()
+}
+
+// enqueue ставит в очередь найденную ссылку, если она в границах обхода
+func (c *Crawler) enqueue(f *frontier, l link, depth int) {
+	u := normalizeURL(l.url)
+	if !c.follows(u, depth, l.asset) {
+		return
+	}
+	c.push(f, u, depth, l.asset)
+}
+
+// follows сообщает, что URL в границах обхода и его пропускает
+// Config.ShouldFollow
+func (c *Crawler) follows(u *url.URL, depth int, asset bool) bool {
+	if depth > c.cfg.MaxDepth || !c.scope.allows(u, asset) {
+		return false
+	}
+	return c.cfg.ShouldFollow == nil || c.cfg.ShouldFollow(u, depth, asset)
+}
+
+// push ставит URL в очередь, если он еще не встречался и не глубже
+// Config.MaxDepth. URL нормализуется, чтобы разные записи одного адреса
+// не скачивались дважды.
+func (c *Crawler) push(f *frontier, u *url.URL, depth int, asset bool) {
+	if depth > c.cfg.MaxDepth {
+		return
+	}
+	u = normalizeURL(u)
+	urlStr := u.String()
+	if _, visited := c.visitedURLs.LoadOrStore(urlStr, true); visited {
+		return
+	}
+	c.state.start(urlStr, depth)
+	c.report.discover(urlStr, depth)
+	f.push(task{url: u, depth: depth, asset: asset})
+}
+
+// process скачивает один URL и возвращает ссылки, найденные на странице
+func (c *Crawler) process(ctx context.Context, t task) ([]link, error) {
+	parsedURL := t.url
+	urlStr := parsedURL.String()
+
+	// Проверяем, что robots.txt разрешает URL, и выдерживаем паузу
+	allowed, err := c.allowedByRobots(ctx, parsedURL)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		c.report.finish(urlStr, statusRobots, fileMeta{}, 0)
+		c.progress.log("disallowed by robots.txt: %s", urlStr)
+		return nil, nil
+	}
+	// Проверяем пределы обхода
+	if c.cfg.Quota > 0 && c.received.Load() >= c.cfg.Quota {
+		return nil, ErrQuotaExceeded
+	}
+	if c.cfg.MaxPages > 0 && !t.asset && c.pages.Add(1) > int64(c.cfg.MaxPages) {
+		c.report.finish(urlStr, statusPageLimit, fileMeta{}, 0)
+		return nil, nil
+	}
+
+	if err := c.politeWait(ctx, parsedURL); err != nil {
+		return nil, err
+	}
+
+	// Скачиваем файл или убеждаемся, что он не изменился
+	result, err := c.downloadWithRetry(ctx, t)
+	c.received.Add(result.bytes)
+	if errors.Is(err, errFileTooLarge) {
+		c.report.finish(urlStr, statusTooLarge, fileMeta{}, 0)
+		c.progress.log("too large: %s", urlStr)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta := result.meta
+	if !result.skipped {
+		c.state.setMeta(urlStr, meta)
+	}
+
+	// После перенаправления файл и ссылки относятся к итоговому URL
+	if finalStr := result.url.String(); finalStr != urlStr {
+		c.report.redirect(urlStr, finalStr)
+		c.progress.log("redirected: %s -> %s", urlStr, finalStr)
+		if result.skipped {
+			return nil, nil
+		}
+		parsedURL, urlStr = result.url, finalStr
+		c.report.discover(urlStr, t.depth)
+	}
+
+	// ссылки разобраны во время скачивания, а неизмененный файл
+	// разбирается с диска. Ошибка разбора не отменяет скачивание:
+	// страница сохранена, а ссылки, найденные до ошибки, обходятся.
+	links, err := result.links, result.linksErr
+	if result.notModified {
+		links, err = c.fileLinks(meta.Path, parsedURL, meta.ContentType)
+	}
+	if err != nil {
+		c.progress.log("links: %v", err)
+	}
+	if c.cfg.OnLink != nil {
+		for _, l := range links {
+			c.cfg.OnLink(parsedURL, l.url, l.asset)
+		}
+	}
+
+	// Отклоненные списками Accept и Reject страницы скачиваются только
+	// ради ссылок, как в wget, а затем удаляются
+	if !c.scope.acceptsFile(parsedURL.Path) {
+		if err := c.cfg.Storage.Remove(meta.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove rejected %s: %w", meta.Path, err)
+		}
+		c.report.finish(urlStr, statusRejected, fileMeta{}, result.bytes)
+		c.progress.log("rejected: %s", urlStr)
+		return links, nil
+	}
+	c.recordSaved(parsedURL, meta.Path, meta.ContentType)
+	if result.notModified {
+		c.report.finish(urlStr, statusNotModified, meta, 0)
+		c.progress.log("not modified: %s", urlStr)
+	} else {
+		c.report.finish(urlStr, statusSaved, meta, result.bytes)
+		c.progress.log("saved: %s -> %s (%s)", urlStr, meta.Path, FormatBytes(result.bytes))
+	}
+	return links, nil
+}
+
+// fileLinks возвращает ссылки из сохраненного файла: в стилях - ресурсы,
+// в HTML документе - ссылки и ресурсы
+func (c *Crawler) fileLinks(name string, u *url.URL, contentType string) ([]link, error) {
+	parse := c.linkParser(u, contentType)
+	if parse == nil {
+		return nil, nil
+	}
+	file, err := c.cfg.Storage.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer file.Close()
+	links, err := parse(file)
+	if err != nil {
+		return links, fmt.Errorf("failed to parse links from %s: %v", name, err)
+	}
+	return links, nil
+}
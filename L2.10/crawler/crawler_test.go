@@ -0,0 +1,982 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chainServer отдает цепочку страниц /page/0 -> /page/1 -> ... -> /page/{n-1};
+// каждая страница также ссылается на общую /shared и на начало цепочки
+func chainServer(t *testing.T, n int, handle func(path string)) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle != nil {
+			handle(r.URL.Path)
+		}
+		if r.URL.Path == "/shared" {
+			fmt.Fprint(w, "shared")
+			return
+		}
+		i, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/page/"))
+		if err != nil || i >= n {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<a href="/page/0">start</a><a href="/shared">shared</a>`)
+		if i+1 < n {
+			fmt.Fprintf(w, `<a href="%d">next</a>`, i+1)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCrawlDeepChain(t *testing.T) {
+	const pages = 60
+
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := chainServer(t, pages, func(path string) {
+		mu.Lock()
+		hits[path]++
+		mu.Unlock()
+	})
+
+	dir := t.TempDir()
+	// глубина больше числа воркеров: рекурсивный обход здесь зависал
+	c, err := New(Config{URL: srv.URL + "/page/0", MaxDepth: pages, OutputDir: dir, Concurrency: 2, IgnoreRobots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.Run(ctx); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+
+	for i := 0; i < pages; i++ {
+		path := "/page/" + strconv.Itoa(i)
+		if hits[path] != 1 {
+			t.Errorf("%s скачан %d раз", path, hits[path])
+		}
+		if _, err := os.Stat(filepath.Join(dir, "page", strconv.Itoa(i))); err != nil {
+			t.Errorf("%s не сохранен: %v", path, err)
+		}
+	}
+	if hits["/shared"] != 1 {
+		t.Errorf("/shared скачан %d раз", hits["/shared"])
+	}
+}
+
+func TestCrawlMaxDepth(t *testing.T) {
+	srv := chainServer(t, 10, nil)
+	dir := t.TempDir()
+	c, err := New(Config{URL: srv.URL + "/page/0", MaxDepth: 3, OutputDir: dir, Concurrency: 4, IgnoreRobots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err := os.Stat(filepath.Join(dir, "page", strconv.Itoa(i)))
+		if saved := err == nil; saved != (i <= 3) {
+			t.Errorf("page/%d: сохранен = %v при глубине 3", i, saved)
+		}
+	}
+}
+
+func TestCrawlCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var once sync.Once
+	srv := chainServer(t, 1000, func(path string) {
+		if path == "/page/5" {
+			once.Do(cancel)
+		}
+	})
+
+	dir := t.TempDir()
+	c, err := New(Config{URL: srv.URL + "/page/0", MaxDepth: 1000, OutputDir: dir, Concurrency: 3, IgnoreRobots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Crawl: %v, ожидали context.Canceled", err)
+	}
+
+	// остановленный обход продолжается с сохраненного состояния
+	state, err := loadState(DirStorage(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Pending) == 0 {
+		t.Fatal("в сохраненном состоянии нет незаконченных URL")
+	}
+	if len(state.Done) == 0 {
+		t.Fatal("в сохраненном состоянии нет законченных URL")
+	}
+}
+
+func TestCrawlAssets(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path] = true
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head>
+<link rel="stylesheet" href="/css/site.css"><link rel="icon" href="/favicon.ico">
+<style>@import "/css/imported.css"; h1 { background: url(/img/style-block.png) }</style>
+</head><body background="/img/body.png">
+<img src="/img/a.png" srcset="/img/a-1x.png 1x, /img/a-2x.png 2x">
+<picture><source srcset="/img/pic.webp" type="image/webp"></picture>
+<video src="/media/v.mp4" poster="/img/poster.jpg"><source src="/media/v.webm"></video>
+<audio src="/media/a.mp3"></audio>
+<iframe src="/frame.html"></iframe><object data="/media/o.swf"></object>
+<div style="background-image: url('/img/inline.png')"></div>
+<a href="/next.html">next</a>
+</body></html>`)
+		case r.URL.Path == "/css/site.css":
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, `@import url("base.css"); p { background: url(../img/from-css.png) }`)
+		default:
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+	}))
+	defer srv.Close()
+
+	// при глубине 0 ресурсы стартовой страницы все равно скачиваются,
+	// а ссылки на другие страницы - нет
+	c, err := New(Config{URL: srv.URL, OutputDir: t.TempDir(), Concurrency: 4, IncludeAssets: true, IgnoreRobots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+
+	for _, path := range []string{
+		"/css/site.css", "/favicon.ico", "/css/imported.css", "/img/style-block.png", "/img/body.png",
+		"/img/a.png", "/img/a-1x.png", "/img/a-2x.png", "/img/pic.webp", "/media/v.mp4", "/img/poster.jpg",
+		"/media/v.webm", "/media/a.mp3", "/frame.html", "/media/o.swf", "/img/inline.png",
+		"/css/base.css", "/img/from-css.png",
+	} {
+		if !hits[path] {
+			t.Errorf("%s не скачан", path)
+		}
+	}
+	if hits["/next.html"] {
+		t.Error("/next.html скачан при глубине 0")
+	}
+}
+
+func TestCrawlReport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/ok.txt">ok</a><a href="/missing">missing</a><a href="/private">private</a>`)
+		case "/ok.txt":
+			fmt.Fprint(w, "ok")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	var log strings.Builder
+	c, err := New(Config{URL: srv.URL, MaxDepth: 1, OutputDir: dir, Concurrency: 2, Progress: &log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err == nil {
+		t.Fatal("Crawl не вернул ошибку для /missing")
+	}
+
+	stats := c.Stats()
+	if stats.Saved != 2 || stats.Failed != 1 || stats.Skipped != 1 || stats.Errors["HTTP 404"] != 1 {
+		t.Errorf("итоги: %+v", stats)
+	}
+	if stats.Bytes != int64(len("ok"))+int64(len(`<a href="/ok.txt">ok</a><a href="/missing">missing</a><a href="/private">private</a>`)) {
+		t.Errorf("получено %d байт", stats.Bytes)
+	}
+	if !strings.Contains(log.String(), "failed: ") || !strings.Contains(log.String(), "saved: ") {
+		t.Errorf("в журнале нет итогов URL:\n%s", log.String())
+	}
+
+	reportPath := filepath.Join(dir, "report.json")
+	if err := c.WriteReport(reportPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		URLs []urlRecord `json:"urls"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"/":        statusSaved,
+		"/ok.txt":  statusSaved,
+		"/missing": statusFailed,
+		"/private": statusRobots,
+	}
+	if len(report.URLs) != len(expected) {
+		t.Errorf("в отчете %d URL, ожидали %d", len(report.URLs), len(expected))
+	}
+	for _, record := range report.URLs {
+		path := strings.TrimPrefix(record.URL, srv.URL)
+		if record.Status != expected[path] {
+			t.Errorf("%s: статус %q, ожидали %q", path, record.Status, expected[path])
+		}
+		if record.Status == statusSaved && record.Path == "" {
+			t.Errorf("%s: нет пути файла", path)
+		}
+	}
+}
+
+func TestCrawlRetries(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/flaky">flaky</a><a href="/busy">busy</a><a href="/stall">stall</a><a href="/gone">gone</a>`)
+		case "/flaky":
+			if n < 3 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "flaky")
+		case "/busy":
+			if n == 1 {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+				return
+			}
+			fmt.Fprint(w, "busy")
+		case "/stall":
+			// первый ответ обрывается паузой посреди тела
+			w.Header().Set("Content-Length", "10")
+			fmt.Fprint(w, "stal")
+			if n == 1 {
+				w.(http.Flusher).Flush()
+				time.Sleep(300 * time.Millisecond)
+				return
+			}
+			fmt.Fprint(w, "l-done")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{
+		URL:      srv.URL,
+		MaxDepth: 1, OutputDir: t.TempDir(), Concurrency: 4, IgnoreRobots: true,
+		Retries: 3, RetryWait: 10 * time.Millisecond, ReadTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := c.Run(context.Background()); err == nil {
+		t.Fatal("Crawl не вернул ошибку для /gone")
+	}
+
+	stats := c.Stats()
+	if stats.Saved != 4 || stats.Failed != 1 || stats.Errors["HTTP 404"] != 1 {
+		t.Errorf("итоги: %+v", stats)
+	}
+	if hits["/flaky"] != 3 {
+		t.Errorf("/flaky запрошен %d раз, ожидали 3", hits["/flaky"])
+	}
+	if hits["/gone"] != 1 {
+		t.Errorf("404 повторялся: %d запросов", hits["/gone"])
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Retry-After не выдержан: обход занял %s", elapsed)
+	}
+}
+
+func TestCrawlRedirects(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/old">old</a><a href="/new/">new</a><a href="/away">away</a>`)
+		case "/old":
+			http.Redirect(w, r, "/new/", http.StatusMovedPermanently)
+		case "/away":
+			http.Redirect(w, r, "http://other.invalid/", http.StatusFound)
+		case "/new/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="page">page</a>`)
+		case "/new/page":
+			fmt.Fprint(w, "page")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c, err := New(Config{URL: srv.URL, MaxDepth: 2, OutputDir: dir, Concurrency: 1, IgnoreRobots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+
+	if hits["/new/"] != 2 {
+		// один раз по ссылке, один - при перенаправлении с /old, после которого скачивание прерывается
+		t.Errorf("/new/ запрошен %d раз", hits["/new/"])
+	}
+	if hits["/new/page"] != 1 {
+		t.Errorf("/new/page запрошен %d раз: ссылки перенаправленной страницы разрешаются не от итогового URL", hits["/new/page"])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old")); err == nil {
+		t.Error("перенаправленный /old сохранен отдельным файлом")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new", "index.html")); err != nil {
+		t.Errorf("/new/ не сохранен: %v", err)
+	}
+
+	converted, err := c.ConvertLinks()
+	if err != nil || converted == 0 {
+		t.Fatalf("ConvertLinks: %d, %v", converted, err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), `href="new/index.html">old`) {
+		t.Errorf("ссылка на /old не указывает на файл /new/:\n%s", index)
+	}
+}
+
+func TestCrawlLimits(t *testing.T) {
+	const size = 20 * 1024
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/a.bin">a</a><a href="/b.bin">b</a><a href="/c.bin">c</a>`+
+				`<a href="/big.bin">big</a><a href="/chunked.bin">chunked</a>`)
+		case "/big.bin":
+			w.Write(make([]byte, 4*size))
+		case "/chunked.bin":
+			// без Content-Length размер выясняется только при чтении
+			for i := 0; i < 4; i++ {
+				w.Write(make([]byte, size))
+				w.(http.Flusher).Flush()
+			}
+		default:
+			w.Write(make([]byte, size))
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c, err := New(Config{
+		URL:      srv.URL,
+		MaxDepth: 1, OutputDir: dir, Concurrency: 3, IgnoreRobots: true,
+		LimitRate: 2 * size, MaxFileSize: 2 * size,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+
+	// первые 2*size байт проходят запасом ведра, остальные - со скоростью 2*size в секунду
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("скорость не ограничена: обход занял %s", elapsed)
+	}
+	stats := c.Stats()
+	if stats.Saved != 4 || stats.Skipped != 2 {
+		t.Errorf("итоги: %+v", stats)
+	}
+	for _, name := range []string{"big.bin", "chunked.bin", "chunked.bin" + partSuffix} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s больше MaxFileSize, но сохранен", name)
+		}
+	}
+}
+
+func TestCrawlMaxPages(t *testing.T) {
+	srv := chainServer(t, 10, nil)
+	dir := t.TempDir()
+	c, err := New(Config{URL: srv.URL + "/page/0", MaxDepth: 10, OutputDir: dir, Concurrency: 2, IgnoreRobots: true, MaxPages: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+	// в ширину: /page/0, затем /shared и /page/1 с нее
+	if stats := c.Stats(); stats.Saved != 3 || stats.Skipped == 0 {
+		t.Errorf("итоги при MaxPages 3: %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "page", "2")); err == nil {
+		t.Error("page/2 скачан сверх MaxPages")
+	}
+}
+
+func TestCrawlQuota(t *testing.T) {
+	srv := chainServer(t, 10, nil)
+	dir := t.TempDir()
+	c, err := New(Config{URL: srv.URL + "/page/0", MaxDepth: 10, OutputDir: dir, Concurrency: 1, IgnoreRobots: true, Quota: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Crawl: %v, ожидали ErrQuotaExceeded", err)
+	}
+	if stats := c.Stats(); stats.Saved == 0 || stats.Saved >= 10 {
+		t.Errorf("скачано %d файлов при квоте 100 байт", stats.Saved)
+	}
+
+	// следующий запуск продолжает обход
+	state, err := loadState(DirStorage(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Pending) == 0 {
+		t.Error("в сохраненном состоянии нет незаконченных URL")
+	}
+}
+
+func TestCrawlAuth(t *testing.T) {
+	var mu sync.Mutex
+	var denied []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			if r.Method != http.MethodPost || r.PostFormValue("user") != "me" || r.PostFormValue("pass") != "secret" {
+				http.Error(w, "bad login", http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/", HttpOnly: true})
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		user, pass, _ := r.BasicAuth()
+		cookie, err := r.Cookie("session")
+		if user != "bot" || pass != "pw" || err != nil || cookie.Value != "abc" || r.Header.Get("X-Token") != "t1" {
+			mu.Lock()
+			denied = append(denied, r.URL.Path)
+			mu.Unlock()
+			http.Error(w, "denied", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/doc">doc</a>`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cookieFile := filepath.Join(t.TempDir(), "cookies.txt")
+	cfg := Config{
+		URL:      srv.URL,
+		MaxDepth: 1, OutputDir: dir, Concurrency: 2, IgnoreRobots: true,
+		Headers:  http.Header{"X-Token": {"t1"}},
+		Username: "bot", Password: "pw",
+		CookieFile: cookieFile,
+		LoginURL:   srv.URL + "/login", LoginData: "user=me&pass=secret",
+	}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v (отказано: %v)", err, denied)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "doc")); err != nil {
+		t.Errorf("/doc не сохранен: %v", err)
+	}
+	data, err := os.ReadFile(cookieFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "#HttpOnly_127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\tabc") {
+		t.Errorf("cookie сессии не сохранена:\n%s", data)
+	}
+
+	// второй запуск без входа берет cookie из файла
+	cfg.LoginURL, cfg.OutputDir = "", t.TempDir()
+	c, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl с сохраненными cookie: %v", err)
+	}
+
+	// неверный пароль формы останавливает обход до скачивания, но
+	// WARC все равно закрывается и получает индекс
+	warcFile := filepath.Join(t.TempDir(), "crawl")
+	cfg.LoginURL, cfg.LoginData, cfg.CookieFile = srv.URL+"/login", "user=me&pass=wrong", ""
+	cfg.WARCFile = warcFile
+	c, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "login failed") {
+		t.Errorf("Crawl с неверным паролем: %v", err)
+	}
+	if _, err := os.Stat(warcFile + ".cdx"); err != nil {
+		t.Errorf("WARC не закрыт после неудачного входа: %v", err)
+	}
+}
+
+func TestCrawlWARC(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/a.txt">a</a><a href="/missing">missing</a>`)
+		case "/a.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "hello warc")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "archive")
+	c, err := New(Config{URL: srv.URL, MaxDepth: 1, OutputDir: filepath.Join(dir, "mirror"), Concurrency: 2, WARCFile: base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Run(context.Background())
+
+	// каждая запись - отдельный gzip-блок с полной записью WARC
+	file, err := os.Open(base + ".warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	readRecord := func(r io.Reader) (map[string]string, []byte) {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr.Multistream(false)
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		head, block, ok := strings.Cut(string(data), "\r\n\r\n")
+		if !ok || !strings.HasPrefix(head, "WARC/1.1\r\n") {
+			t.Fatalf("не запись WARC: %q", data)
+		}
+		headers := make(map[string]string)
+		for _, line := range strings.Split(head, "\r\n")[1:] {
+			name, value, _ := strings.Cut(line, ": ")
+			headers[name] = value
+		}
+		length, _ := strconv.Atoi(headers["Content-Length"])
+		if len(block) != length+4 || !strings.HasSuffix(block, "\r\n\r\n") {
+			t.Fatalf("%s %s: блок %d байт, Content-Length %d", headers["WARC-Type"], headers["WARC-Target-URI"], len(block)-4, length)
+		}
+		return headers, []byte(block[:length])
+	}
+
+	types := make(map[string]int)
+	responses := make(map[string]string)
+	br := bufio.NewReader(file)
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		}
+		headers, block := readRecord(br)
+		types[headers["WARC-Type"]]++
+		if headers["WARC-Type"] == "response" {
+			responses[strings.TrimPrefix(headers["WARC-Target-URI"], srv.URL)] = string(block)
+		}
+	}
+	// robots.txt, /, /a.txt и /missing
+	if types["warcinfo"] != 1 || types["request"] != 4 || types["response"] != 4 {
+		t.Errorf("записи: %v", types)
+	}
+	if body := responses["/a.txt"]; !strings.HasPrefix(body, "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(body, "\r\n\r\nhello warc") {
+		t.Errorf("ответ /a.txt записан неверно: %q", body)
+	}
+	if !strings.HasPrefix(responses["/missing"], "HTTP/1.1 404") {
+		t.Errorf("ответ /missing записан неверно: %q", responses["/missing"])
+	}
+
+	// смещение из CDX указывает на запись ответа
+	cdx, err := os.ReadFile(base + ".cdx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(string(cdx), "\n"), "\n")
+	if len(lines) != 5 || lines[0] != " CDX N b a m s k r M S V g" {
+		t.Fatalf("индекс:\n%s", cdx)
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if fields[2] != srv.URL+"/a.txt" {
+			continue
+		}
+		offset, _ := strconv.ParseInt(fields[9], 10, 64)
+		size, _ := strconv.ParseInt(fields[8], 10, 64)
+		headers, _ := readRecord(io.NewSectionReader(file, offset, size))
+		if headers["WARC-Type"] != "response" || headers["WARC-Target-URI"] != fields[2] || fields[3] != "text/plain" || fields[4] != "200" {
+			t.Errorf("строка индекса %q указывает на %v", line, headers)
+		}
+	}
+}
+
+func TestCrawlSeeds(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\n\nSitemap: %s/sitemap-index.xml\n", srvURL)
+		case "/sitemap-index.xml":
+			fmt.Fprintf(w, `<?xml version="1.0"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%s/pages.xml.gz</loc></sitemap>
+  <sitemap><loc>%s/sitemap-index.xml</loc></sitemap>
+</sitemapindex>`, srvURL, srvURL)
+		case "/pages.xml.gz":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			zw := gzip.NewWriter(w)
+			fmt.Fprintf(zw, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/a</loc></url>
+  <url><loc> %[1]s/b </loc></url>
+  <url><loc>%[1]s/private</loc></url>
+  <url><loc>http://other.invalid/x</loc></url>
+</urlset>`, srvURL)
+			zw.Close()
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/a">a</a>`)
+		}
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	dir := t.TempDir()
+	cfg := Config{
+		URL:      srv.URL,
+		MaxDepth: 1, OutputDir: dir, Concurrency: 3,
+		Seeds:    []string{srv.URL + "/c", srv.URL + "/a"},
+		Sitemaps: true,
+	}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+
+	for _, path := range []string{"/", "/a", "/b", "/c", "/sitemap-index.xml", "/pages.xml.gz"} {
+		if fetched[path] != 1 {
+			t.Errorf("%s скачан %d раз, ожидался 1", path, fetched[path])
+		}
+	}
+	if fetched["/private"] != 0 {
+		t.Error("запрещенный robots.txt URL из карты сайта скачан")
+	}
+	if c.Stats().Failed != 0 {
+		t.Errorf("ошибок: %d", c.Stats().Failed)
+	}
+
+	if _, err := New(Config{URL: srv.URL, OutputDir: t.TempDir(), Seeds: []string{"ftp://example.com/"}}); err == nil {
+		t.Error("ожидалась ошибка для URL списка не по http(s)")
+	}
+}
+
+func TestCrawlResumeLinks(t *testing.T) {
+	page := `<html><body><a href="/first">1</a>` + strings.Repeat("<p>text</p>", 1000) + `<a href="/second">2</a></body></html>`
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/page.html" {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/html")
+			http.ServeContent(w, r, "page.html", time.Time{}, strings.NewReader(page))
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	// прошлый запуск скачал половину страницы, первая ссылка - в ней
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "page.html"+partSuffix), []byte(page[:len(page)/2]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(Config{URL: srv.URL + "/page.html", MaxDepth: 1, OutputDir: dir, Concurrency: 2, IgnoreRobots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+	if len(ranges) != 1 || ranges[0] != fmt.Sprintf("bytes=%d-", len(page)/2) {
+		t.Errorf("страница запрошена с Range %q, ожидалась докачка", ranges)
+	}
+	for _, name := range []string{"first", "second"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("/%s не скачан: %v", name, err)
+		}
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Hook") != "on" {
+			http.Error(w, "no hook header", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/skip">skip</a><img src="/i.png">`)
+		default:
+			fmt.Fprint(w, `<a href="/">home</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var statuses []int
+	links := make(map[string]bool)
+	storage := NewMemStorage()
+	c, err := New(Config{
+		URL: srv.URL, MaxDepth: 1, Concurrency: 2, IgnoreRobots: true, IncludeAssets: true,
+		Storage:   storage,
+		OnRequest: func(req *http.Request) { req.Header.Set("X-Hook", "on") },
+		OnResponse: func(resp *http.Response) {
+			mu.Lock()
+			statuses = append(statuses, resp.StatusCode)
+			mu.Unlock()
+		},
+		OnLink: func(page, target *url.URL, asset bool) {
+			mu.Lock()
+			links[page.Path+" -> "+target.Path+" "+strconv.FormatBool(asset)] = true
+			mu.Unlock()
+		},
+		ShouldFollow: func(u *url.URL, depth int, asset bool) bool {
+			return u.Path != "/skip"
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	names := strings.Join(storage.Names(), " ")
+	if names != ".crawl-state.json a i.png index.html" {
+		t.Errorf("в хранилище %q", names)
+	}
+	for _, want := range []string{"/ -> /a false", "/ -> /skip false", "/ -> /i.png true", "/a -> / false"} {
+		if !links[want] {
+			t.Errorf("OnLink не получил %q: %v", want, links)
+		}
+	}
+	if len(statuses) != 3 {
+		t.Errorf("OnResponse вызван %d раз, ожидалось 3: %v", len(statuses), statuses)
+	}
+	for _, status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("OnRequest не добавил заголовок: статус %d", status)
+		}
+	}
+
+	if _, err := c.ConvertLinks(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := storage.ReadFile("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `href="index.html"`) {
+		t.Errorf("ссылки в хранилище не переписаны: %s", data)
+	}
+}
+
+// failingStorage - хранилище, чтение файлов которого обрывается ошибкой
+// после after байт
+type failingStorage struct {
+	*MemStorage
+	after int
+}
+
+func (s failingStorage) Open(name string) (fs.File, error) {
+	file, err := s.MemStorage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &failingFile{File: file, left: s.after}, nil
+}
+
+type failingFile struct {
+	fs.File
+	left int
+}
+
+func (f *failingFile) Read(p []byte) (int, error) {
+	if f.left <= 0 {
+		return 0, errors.New("read error")
+	}
+	if len(p) > f.left {
+		p = p[:f.left]
+	}
+	n, err := f.File.Read(p)
+	f.left -= n
+	return n, err
+}
+
+func TestCrawlLinksError(t *testing.T) {
+	page := `<a href="/first">1</a>` + strings.Repeat("<p>text</p>", 1000) + `<a href="/second">2</a>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" && r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+
+	// страница не изменилась, а при разборе ссылок с диска чтение
+	// обрывается на середине
+	storage := failingStorage{MemStorage: NewMemStorage(), after: len(page) / 2}
+	state, err := json.Marshal(&crawlState{
+		Files: map[string]*fileMeta{srv.URL + "/": {Path: "index.html", ETag: `"v1"`, ContentType: "text/html"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceFile(storage, stateFile, state); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceFile(storage, "index.html", []byte(page)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(Config{URL: srv.URL, MaxDepth: 1, Storage: storage, IgnoreRobots: true, Timestamping: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	// страница считается сохраненной, а ссылка до ошибки обойдена
+	names := strings.Join(storage.Names(), " ")
+	if names != ".crawl-state.json first index.html" {
+		t.Errorf("в хранилище %q", names)
+	}
+	if stats := c.Stats(); stats.Failed != 0 || stats.NotModified != 1 {
+		t.Errorf("итоги обхода %+v, ожидалась одна неизмененная страница без ошибок", stats)
+	}
+}
+
+func TestCrawlFileDirCollision(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages map[string]string
+	}{
+		{"файл, затем каталог", map[string]string{
+			"/":           `<a href="/docs">docs</a>`,
+			"/docs":       `<a href="/docs/intro">intro</a>`,
+			"/docs/intro": "intro",
+		}},
+		{"каталог, затем файл", map[string]string{
+			"/":           `<a href="/docs/intro">intro</a>`,
+			"/docs/intro": `<a href="/docs">docs</a>`,
+			"/docs":       "docs",
+		}},
+	}
+	for _, test := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			page, ok := test.pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, page)
+		}))
+
+		dir := t.TempDir()
+		c, err := New(Config{URL: srv.URL, MaxDepth: 2, Concurrency: 1, OutputDir: dir, IgnoreRobots: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Run(context.Background()); err != nil {
+			t.Errorf("%s: Run: %v", test.name, err)
+		}
+		srv.Close()
+
+		// все три страницы сохранены, хотя docs нужен и файлом, и каталогом
+		var files []string
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && d.Name() != stateFile {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if len(files) != 3 {
+			t.Errorf("%s: сохранены %q", test.name, files)
+		}
+	}
+}
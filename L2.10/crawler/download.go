@@ -0,0 +1,279 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// partSuffix - суффикс недокачанного файла. Файл переименовывается
+// в итоговое имя только целиком, а по размеру .part докачка
+// продолжается с того же места.
+const partSuffix = ".part"
+
+// newRequest создает GET с заголовками краулера
+func (c *Crawler) newRequest(ctx context.Context, urlStr string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(req)
+	return req, nil
+}
+
+// fetch выполняет GET с заголовками краулера
+func (c *Crawler) fetch(ctx context.Context, urlStr string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, urlStr)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// do отправляет запрос, вызывая хуки Config.OnRequest и Config.OnResponse
+func (c *Crawler) do(req *http.Request) (*http.Response, error) {
+	if c.cfg.OnRequest != nil {
+		c.cfg.OnRequest(req)
+	}
+	resp, err := c.client.Do(req)
+	if err == nil && c.cfg.OnResponse != nil {
+		c.cfg.OnResponse(resp)
+	}
+	return resp, err
+}
+
+// downloadResult - итог скачивания URL
+type downloadResult struct {
+	meta        fileMeta
+	url         *url.URL // итоговый URL после перенаправлений
+	notModified bool     // файл не изменился на сервере
+	skipped     bool     // перенаправлен на URL вне границ обхода или уже найденный
+	bytes       int64    // получено байт тела ответа
+
+	// ссылки, разобранные во время скачивания, и ошибка разбора
+	links    []link
+	linksErr error
+}
+
+// download скачивает URL в каталог зеркала. С Config.Timestamping файл,
+// который не изменился на сервере (304 по ETag или Last-Modified), не
+// перекачивается; недокачанный .part продолжается запросом Range.
+// Имя файла выбирается после получения заголовков, по Content-Type,
+// а .part называется по URL, чтобы докачка нашла его и без заголовков.
+// Перенаправления выполняет клиент, а файл называется по итоговому URL;
+// если итоговый URL вне границ обхода или уже найден по другой ссылке,
+// файл не скачивается (skipped).
+// Возвращает сведения о файле (путь, Content-Type и валидаторы) и
+// число полученных байт; ответ не 2xx возвращается как *httpError.
+func (c *Crawler) download(ctx context.Context, t task) (downloadResult, error) {
+	u := t.url
+	urlStr := u.String()
+	result := downloadResult{url: u}
+	meta := c.state.meta(urlStr)
+	storage := c.cfg.Storage
+	partPath := c.names.partName(u)
+
+	// файл прошлого скачивания - для условного запроса
+	if meta.Path == "" {
+		meta.Path = c.names.basePath(u)
+	}
+
+	// отмена запроса при паузе в теле ответа дольше Config.ReadTimeout
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := c.newRequest(ctx, urlStr)
+	if err != nil {
+		return downloadResult{meta: meta}, fmt.Errorf("failed to download %s: %w", urlStr, err)
+	}
+
+	var offset int64
+	if info, err := statFile(storage, partPath); err == nil && info.Size() > 0 {
+		// докачка: If-Range вернет весь файл, если он успел измениться
+		offset = info.Size()
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if strings.HasPrefix(meta.ETag, `"`) {
+			req.Header.Set("If-Range", meta.ETag)
+		} else if meta.LastModified != "" {
+			req.Header.Set("If-Range", meta.LastModified)
+		}
+	} else if info, err := statFile(storage, meta.Path); err == nil && c.cfg.Timestamping {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		} else {
+			req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+		}
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return downloadResult{meta: meta}, fmt.Errorf("failed to download %s: %w", urlStr, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		if meta.ContentType == "" {
+			meta.ContentType = mime.TypeByExtension(filepath.Ext(meta.Path))
+		}
+		result.meta, result.notModified = meta, true
+		return result, nil
+	case offset > 0 && (resp.StatusCode == http.StatusRequestedRangeNotSatisfiable ||
+		resp.StatusCode == http.StatusPartialContent && contentRangeStart(resp) != offset):
+		// .part не подходит к файлу на сервере - качаем заново
+		resp.Body.Close()
+		if err := storage.Remove(partPath); err != nil {
+			return downloadResult{meta: meta}, fmt.Errorf("failed to remove %s: %w", partPath, err)
+		}
+		return c.download(ctx, t)
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "":
+		// клиент не пошел по перенаправлению за границы обхода
+		location, err := resp.Location()
+		if err != nil {
+			return downloadResult{meta: meta}, fmt.Errorf("failed to download %s: %w", urlStr, err)
+		}
+		result.url = normalizeURL(location)
+		c.redirects.Store(urlStr, result.url.String())
+		result.meta, result.skipped = meta, true
+		return result, nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return downloadResult{meta: meta}, &httpError{
+			url:        urlStr,
+			status:     resp.StatusCode,
+			text:       resp.Status,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	if final := normalizeURL(resp.Request.URL); final.String() != urlStr {
+		result.url = final
+		if !c.claimRedirect(urlStr, final, t) {
+			result.meta, result.skipped = meta, true
+			return result, nil
+		}
+	}
+
+	// большой файл не скачиваем, если сервер сообщил размер заранее
+	var start int64 // уже скачано
+	if resp.StatusCode == http.StatusPartialContent {
+		start = offset
+	}
+	left := int64(-1)
+	if c.cfg.MaxFileSize > 0 {
+		left = c.cfg.MaxFileSize - start
+		if resp.ContentLength > left {
+			return downloadResult{meta: meta}, fmt.Errorf("failed to download %s: %w", urlStr, errFileTooLarge)
+		}
+	}
+
+	// сведения сохраняются до скачивания, чтобы после остановки
+	// докачать .part с правильным If-Range
+	meta.ETag = resp.Header.Get("ETag")
+	meta.LastModified = resp.Header.Get("Last-Modified")
+	meta.ContentType = resp.Header.Get("Content-Type")
+	meta.Path = c.names.name(result.url, meta.ContentType)
+	c.state.setMeta(urlStr, meta)
+
+	// ссылки разбираются одновременно с записью файла; при докачке
+	// разборщик сначала читает уже скачанную часть
+	extractor := c.newLinkExtractor(result.url, meta.ContentType)
+	if start > 0 && extractor != nil {
+		if err := copyFile(extractor, storage, partPath); err != nil {
+			extractor.finish(err)
+			return downloadResult{meta: meta}, fmt.Errorf("failed to read %s: %w", partPath, err)
+		}
+	}
+
+	file, err := storage.Create(partPath, resp.StatusCode == http.StatusPartialContent)
+	if err != nil {
+		extractor.finish(err)
+		return downloadResult{meta: meta}, fmt.Errorf("failed to create file %s: %w", partPath, err)
+	}
+	total := resp.ContentLength
+	if total >= 0 {
+		total += start
+	}
+	bar := c.progress.startFile(meta.Path, start, total)
+	defer c.progress.endFile(bar)
+	idle := newIdleReader(resp.Body, c.cfg.ReadTimeout, cancel)
+	defer idle.stop()
+	body := &limitedReader{
+		ctx:      ctx,
+		r:        idle,
+		limiters: []*rateLimiter{c.limiter, c.host(u).limiter},
+		left:     left,
+	}
+	var out io.Writer = file
+	if extractor != nil {
+		out = io.MultiWriter(file, extractor)
+	}
+	written, err := io.Copy(out, c.progress.reader(bar, body))
+	links, linksErr := extractor.finish(err)
+	if err != nil {
+		file.Close()
+		if errors.Is(err, errFileTooLarge) {
+			// докачивать такой файл незачем
+			storage.Remove(partPath)
+		}
+		return downloadResult{meta: meta}, fmt.Errorf("failed to save content to %s: %w", partPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return downloadResult{meta: meta}, fmt.Errorf("failed to save content to %s: %w", partPath, err)
+	}
+	if err := storage.Rename(partPath, meta.Path); err != nil {
+		return downloadResult{meta: meta}, fmt.Errorf("failed to save content to %s: %w", meta.Path, err)
+	}
+
+	// как wget -N: время файла - время изменения на сервере
+	if modified, err := http.ParseTime(meta.LastModified); err == nil {
+		storage.Chtimes(meta.Path, modified)
+	}
+	result.meta, result.bytes = meta, written
+	result.links = links
+	if linksErr != nil {
+		result.linksErr = fmt.Errorf("failed to parse links from %s: %v", urlStr, linksErr)
+	}
+	return result, nil
+}
+
+// copyFile дописывает в w содержимое файла хранилища
+func copyFile(w io.Writer, storage Storage, name string) error {
+	file, err := storage.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// claimRedirect запоминает, что urlStr перенаправлен на final, и
+// сообщает, скачивать ли final сейчас: он должен быть в границах обхода
+// и еще не встречаться, иначе его скачает (или уже скачал) свой воркер
+func (c *Crawler) claimRedirect(urlStr string, final *url.URL, t task) bool {
+	c.redirects.Store(urlStr, final.String())
+	if !c.follows(final, t.depth, t.asset) {
+		return false
+	}
+	// при повторе запроса URL уже закреплен за urlStr
+	owner, loaded := c.visitedURLs.LoadOrStore(final.String(), urlStr)
+	return !loaded || owner == urlStr
+}
+
+// contentRangeStart возвращает начало диапазона из Content-Range
+// ("bytes 100-199/200") или -1
+func contentRangeStart(resp *http.Response) int64 {
+	var start, end int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/", &start, &end); err != nil {
+		return -1
+	}
+	return start
+}
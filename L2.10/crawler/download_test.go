@@ -0,0 +1,257 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeState записывает состояние прерванного обхода в каталог зеркала
+func writeState(t *testing.T, dir string, state *crawlState) {
+	t.Helper()
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, stateFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadPartial(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	tests := []struct {
+		name        string
+		ignoreRange bool // сервер отвечает 200 на запрос Range
+	}{
+		{"докачка по 206", false},
+		{"сервер без Range - скачивание заново", true},
+	}
+	for _, test := range tests {
+		var ranges, ifRanges []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("ETag", `"v1"`)
+			if test.ignoreRange {
+				w.Write([]byte(content))
+				return
+			}
+			http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(content))
+		}))
+
+		// прошлый запуск скачал треть файла и успел сохранить ETag
+		dir := t.TempDir()
+		urlStr := srv.URL + "/file.bin"
+		part := content[:len(content)/3]
+		if err := os.WriteFile(filepath.Join(dir, "file.bin"+partSuffix), []byte(part), 0644); err != nil {
+			t.Fatal(err)
+		}
+		writeState(t, dir, &crawlState{
+			Pending: map[string]int{urlStr: 0},
+			Files:   map[string]*fileMeta{urlStr: {Path: "file.bin", ETag: `"v1"`}},
+		})
+
+		c, err := New(Config{URL: urlStr, OutputDir: dir, IgnoreRobots: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatalf("%s: Crawl: %v", test.name, err)
+		}
+		srv.Close()
+
+		if len(ranges) != 1 || ranges[0] != "bytes=3333-" || ifRanges[0] != `"v1"` {
+			t.Errorf("%s: Range %q, If-Range %q, ожидалась докачка с 3333 байта", test.name, ranges, ifRanges)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "file.bin"))
+		if err != nil || string(data) != content {
+			t.Errorf("%s: файл длиной %d (%v), ожидалось %d байт", test.name, len(data), err, len(content))
+		}
+		if _, err := os.Stat(filepath.Join(dir, "file.bin"+partSuffix)); !os.IsNotExist(err) {
+			t.Errorf("%s: .part не удален: %v", test.name, err)
+		}
+	}
+}
+
+func TestDownloadNotModified(t *testing.T) {
+	var mu sync.Mutex
+	var conditions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conditions = append(conditions, r.Header.Get("If-None-Match"))
+		mu.Unlock()
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		w.Write([]byte("new"))
+	}))
+	defer srv.Close()
+
+	// прошлое зеркалирование закончено, остались только сведения о файлах
+	dir := t.TempDir()
+	urlStr := srv.URL + "/file.txt"
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeState(t, dir, &crawlState{
+		Files: map[string]*fileMeta{urlStr: {Path: "file.txt", ETag: `"v1"`, ContentType: "text/plain"}},
+	})
+
+	c, err := New(Config{URL: urlStr, OutputDir: dir, IgnoreRobots: true, Timestamping: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+	if len(conditions) != 1 || conditions[0] != `"v1"` {
+		t.Errorf("If-None-Match = %q, ожидался один условный запрос", conditions)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "file.txt")); err != nil || string(data) != "old" {
+		t.Errorf("файл = %q, %v, ожидалось прежнее содержимое", data, err)
+	}
+	state, err := loadState(DirStorage(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta := state.meta(urlStr); meta.Path != "file.txt" || meta.ETag != `"v1"` {
+		t.Errorf("сведения о файле после 304: %+v", meta)
+	}
+}
+
+func TestCrawlResumeState(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/done">d</a><a href="/pending">p</a>`))
+		case "/pending":
+			w.Write([]byte(`<a href="/next">n</a>`))
+		default:
+			w.Write([]byte("page"))
+		}
+	}))
+	defer srv.Close()
+
+	// прерванный обход: стартовая и /done закончены, /pending - нет
+	dir := t.TempDir()
+	for _, name := range []string{"index.html", "done"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("saved"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeState(t, dir, &crawlState{
+		Pending: map[string]int{srv.URL + "/pending": 1},
+		Done:    map[string]int{srv.URL + "/": 0, srv.URL + "/done": 1},
+		Files: map[string]*fileMeta{
+			srv.URL + "/":     {Path: "index.html", ContentType: "text/html"},
+			srv.URL + "/done": {Path: "done", ContentType: "text/html"},
+		},
+	})
+
+	c, err := New(Config{URL: srv.URL + "/", MaxDepth: 2, OutputDir: dir, Concurrency: 2, IgnoreRobots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+
+	expected := map[string]int{"/pending": 1, "/next": 1}
+	if len(hits) != len(expected) || hits["/pending"] != 1 || hits["/next"] != 1 {
+		t.Errorf("запросы %v, ожидалось %v", hits, expected)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "done")); err != nil || string(data) != "saved" {
+		t.Errorf("законченный файл изменен: %q, %v", data, err)
+	}
+	// после успешного обхода незаконченных и законченных URL не остается
+	state, err := loadState(DirStorage(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Pending) != 0 || len(state.Done) != 0 {
+		t.Errorf("состояние после обхода: pending %v, done %v", state.Pending, state.Done)
+	}
+}
+
+func TestCrawlStateFileName(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/.crawl-state.json">s</a><a href="/..crawl-state.json.tmp">t</a>`))
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	defer srv.Close()
+
+	storage := NewMemStorage()
+	c, err := New(Config{URL: srv.URL + "/", MaxDepth: 1, Storage: storage, IgnoreRobots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+	// страница сайта получила другое имя, состояние не затерто
+	state, err := loadState(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, urlStr := range []string{srv.URL + "/.crawl-state.json", srv.URL + "/..crawl-state.json.tmp"} {
+		if path := state.meta(urlStr).Path; path == "" || path == stateFile || path == "."+stateFile+".tmp" {
+			t.Errorf("%s сохранен в %q", urlStr, path)
+		}
+	}
+}
+
+// failingStateStorage - хранилище, в котором нельзя сохранить состояние
+type failingStateStorage struct {
+	*MemStorage
+}
+
+func (s failingStateStorage) Rename(oldname, newname string) error {
+	if newname == stateFile {
+		return errors.New("disk full")
+	}
+	return s.MemStorage.Rename(oldname, newname)
+}
+
+func TestCrawlStateSaveError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/missing">m</a>`))
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{URL: srv.URL + "/", MaxDepth: 1, Storage: failingStateStorage{NewMemStorage()}, IgnoreRobots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ошибка сохранения состояния возвращается вместе с неудачным URL
+	err = c.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "failed to save crawl state") {
+		t.Errorf("Run: %v, ожидались ошибки URL и сохранения состояния", err)
+	}
+}
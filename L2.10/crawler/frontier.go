@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"net/url"
+	"sync"
+)
+
+// task - URL в очереди обхода и глубина, на которой он найден
+type task struct {
+	url   *url.URL
+	depth int
+	asset bool // ресурс страницы, а не ссылка на страницу
+}
+
+// frontier - очередь обхода в ширину. Каждый URL попадает в нее один
+// раз (повторы отсекает краулер), поэтому очередь не больше сайта,
+// а работают с ней фиксированные воркеры, а не горутина на ссылку.
+// Обход закончен, когда очередь пуста и ни один воркер не занят:
+// только занятый воркер может добавить новые URL.
+type frontier struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []task
+	active int
+	closed bool
+}
+
+func newFrontier() *frontier {
+	f := &frontier{}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// push добавляет URL в конец очереди
+func (f *frontier) push(t task) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	f.queue = append(f.queue, t)
+	f.cond.Signal()
+}
+
+// pop ждет следующий URL. Возвращает false, когда обход закончен или
+// остановлен. Получивший URL воркер должен вызвать done, добавив
+// перед этим найденные на странице ссылки.
+func (f *frontier) pop() (task, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.queue) == 0 && f.active > 0 && !f.closed {
+		f.cond.Wait()
+	}
+	if len(f.queue) == 0 || f.closed {
+		// будим остальных воркеров, чтобы они тоже завершились
+		f.cond.Broadcast()
+		return task{}, false
+	}
+	t := f.queue[0]
+	f.queue[0] = task{}
+	f.queue = f.queue[1:]
+	f.active++
+	return t, true
+}
+
+// done отмечает, что воркер закончил URL
+func (f *frontier) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.active--
+	f.cond.Broadcast()
+}
+
+// close останавливает обход: pop больше не выдает URL
+func (f *frontier) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.cond.Broadcast()
+}
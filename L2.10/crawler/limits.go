@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded - обход остановлен по Config.Quota. Состояние
+// сохранено, и следующий запуск продолжит обход.
+var ErrQuotaExceeded = errors.New("download quota exceeded")
+
+// errFileTooLarge - файл больше Config.MaxFileSize
+var errFileTooLarge = errors.New("file exceeds max file size")
+
+// rateLimiter - ведро токенов: rate байт в секунду с запасом burst.
+// Токены берутся в долг: воркер, прочитавший n байт, ждет, пока долг
+// не погасится, поэтому суммарная скорость всех воркеров не выше rate.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter возвращает ограничитель rate байт в секунду;
+// nil при rate <= 0 - без ограничения
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	burst := min(max(rate, 1024), 256*1024)
+	return &rateLimiter{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait списывает n байт и ждет, пока долг не погасится
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// chunk - сколько байт читать за раз, чтобы долг не превышал запаса
+func (l *rateLimiter) chunk() int {
+	if l == nil {
+		return 0
+	}
+	return int(l.burst)
+}
+
+// limitedReader ограничивает скорость чтения тела ответа общим
+// ограничителем и ограничителем хоста, а размер - Config.MaxFileSize
+type limitedReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*rateLimiter
+	left     int64 // сколько еще можно прочитать; < 0 - без предела
+}
+
+func (r *limitedReader) Read(b []byte) (int, error) {
+	for _, l := range r.limiters {
+		if chunk := l.chunk(); chunk > 0 && len(b) > chunk {
+			b = b[:chunk]
+		}
+	}
+	n, err := r.r.Read(b)
+	if r.left >= 0 {
+		if r.left -= int64(n); r.left < 0 {
+			return n, errFileTooLarge
+		}
+	}
+	for _, l := range r.limiters {
+		if err := l.wait(r.ctx, n); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
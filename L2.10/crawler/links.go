@@ -0,0 +1,320 @@
+package crawler
+
+import (
+	"io"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// link - ссылка, найденная в документе. Ресурсы страницы (картинки,
+// стили, скрипты, фреймы) скачиваются на той же глубине, что и сама
+// страница, чтобы страницы последнего уровня отображались целиком.
+type link struct {
+	url   *url.URL
+	asset bool
+}
+
+// assetAttrs - атрибуты элементов, ссылающиеся на ресурсы страницы
+var assetAttrs = map[string][]string{
+	"img":    {"src", "srcset"},
+	"source": {"src", "srcset"},
+	"video":  {"src", "poster"},
+	"audio":  {"src"},
+	"track":  {"src"},
+	"iframe": {"src"},
+	"frame":  {"src"},
+	"embed":  {"src"},
+	"object": {"data"},
+	"script": {"src"},
+	"input":  {"src"},
+	"body":   {"background"},
+	"table":  {"background"},
+	"td":     {"background"},
+}
+
+// requisiteRels - значения rel у <link>, которые нужны для отображения
+// страницы; остальные <link> (next, alternate...) ведут на страницы
+var requisiteRels = map[string]bool{
+	"stylesheet":       true,
+	"icon":             true,
+	"shortcut":         true,
+	"apple-touch-icon": true,
+	"manifest":         true,
+	"preload":          true,
+	"modulepreload":    true,
+	"prefetch":         true,
+}
+
+// maxTokenSize - предел размера одного токена HTML. Память разбора
+// не зависит от размера страницы, но тег с огромным атрибутом (data:
+// картинка) токенизатор держит целиком.
+const maxTokenSize = 16 << 20
+
+// maxCSSSize - сколько байт стиля читается для поиска ссылок; стиль
+// разбирается целиком в памяти, поэтому дальше предела он не читается
+const maxCSSSize = 16 << 20
+
+// linkParser возвращает разборщик ссылок для Content-Type: для стилей -
+// ресурсы, для HTML документов - ссылки и ресурсы; nil - в файле нет ссылок
+func (c *Crawler) linkParser(u *url.URL, contentType string) func(io.Reader) ([]link, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/css" && c.cfg.IncludeAssets:
+		return func(r io.Reader) ([]link, error) {
+			css, err := io.ReadAll(io.LimitReader(r, maxCSSSize))
+			if err != nil {
+				return nil, err
+			}
+			return cssLinks(string(css), u), nil
+		}
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return func(r io.Reader) ([]link, error) {
+			return c.htmlLinks(r, u, contentType)
+		}
+	}
+	return nil
+}
+
+// htmlLinks собирает ссылки документа, разбирая его потоком токенов без
+// построения дерева, поэтому память не растет с размером страницы.
+// Кодировка определяется, как в браузере, по BOM, Content-Type и
+// <meta charset>. Относительные ссылки разрешаются от адреса страницы,
+// а после первого <base href> - от него.
+func (c *Crawler) htmlLinks(r io.Reader, pageURL *url.URL, contentType string) ([]link, error) {
+	utf8, err := charset.NewReader(r, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []link
+	base, baseSet := pageURL, false
+	add := func(ref string, asset bool) {
+		if u, ok := resolveLink(base, ref); ok {
+			links = append(links, link{url: u, asset: asset})
+		}
+	}
+
+	z := html.NewTokenizer(utf8)
+	z.SetMaxBuf(maxTokenSize)
+	inStyle := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return links, nil
+			}
+			return links, z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if tok.Data == "base" && !baseSet {
+				if href, ok := attr(tok.Attr, "href"); ok {
+					if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+						base, baseSet = pageURL.ResolveReference(ref), true
+					}
+				}
+			}
+			inStyle = tt == html.StartTagToken && tok.Data == "style"
+			c.elementLinks(tok.Data, tok.Attr, add)
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "style" {
+				inStyle = false
+			}
+		case html.TextToken:
+			if inStyle && c.cfg.IncludeAssets {
+				for _, ref := range cssRefs(string(z.Text())) {
+					add(ref, true)
+				}
+			}
+		}
+	}
+}
+
+// elementLinks передает add ссылки одного элемента
+func (c *Crawler) elementLinks(tag string, attrs []html.Attribute, add func(ref string, asset bool)) {
+	switch tag {
+	case "a", "area":
+		if href, ok := attr(attrs, "href"); ok {
+			add(href, false)
+		}
+		return
+	case "link":
+		href, ok := attr(attrs, "href")
+		if !ok {
+			return
+		}
+		rel, _ := attr(attrs, "rel")
+		for _, r := range strings.Fields(strings.ToLower(rel)) {
+			if requisiteRels[r] {
+				if c.cfg.IncludeAssets {
+					add(href, true)
+				}
+				return
+			}
+		}
+		add(href, false)
+		return
+	}
+
+	if !c.cfg.IncludeAssets {
+		return
+	}
+	for _, name := range assetAttrs[tag] {
+		value, ok := attr(attrs, name)
+		if !ok {
+			continue
+		}
+		if name == "srcset" {
+			for _, ref := range srcsetURLs(value) {
+				add(ref, true)
+			}
+			continue
+		}
+		add(value, true)
+	}
+	if style, ok := attr(attrs, "style"); ok {
+		for _, ref := range cssRefs(style) {
+			add(ref, true)
+		}
+	}
+}
+
+// attr возвращает значение атрибута элемента
+func attr(attrs []html.Attribute, name string) (string, bool) {
+	for _, a := range attrs {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// linkExtractor разбирает ссылки тела ответа одновременно со
+// скачиванием: download пишет тело и в файл, и в linkExtractor, а
+// разборщик читает его из канала в своей горутине
+type linkExtractor struct {
+	w     *io.PipeWriter
+	done  chan struct{}
+	links []link
+	err   error
+}
+
+// newLinkExtractor запускает разбор; nil - в файле этого типа нет ссылок
+func (c *Crawler) newLinkExtractor(u *url.URL, contentType string) *linkExtractor {
+	parse := c.linkParser(u, contentType)
+	if parse == nil {
+		return nil
+	}
+	r, w := io.Pipe()
+	e := &linkExtractor{w: w, done: make(chan struct{})}
+	go func() {
+		defer close(e.done)
+		e.links, e.err = parse(r)
+		// разборщик мог остановиться раньше конца тела - дочитываем
+		// его, чтобы не встала запись в файл
+		io.Copy(io.Discard, r)
+	}()
+	return e
+}
+
+func (e *linkExtractor) Write(p []byte) (int, error) {
+	return e.w.Write(p)
+}
+
+// finish сообщает разборщику о конце тела (err - скачивание прервано)
+// и возвращает найденные ссылки
+func (e *linkExtractor) finish(err error) ([]link, error) {
+	if e == nil {
+		return nil, nil
+	}
+	e.w.CloseWithError(err)
+	<-e.done
+	return e.links, e.err
+}
+
+// cssLinks возвращает ресурсы, на которые ссылается CSS файл,
+// разрешенные относительно его адреса
+func cssLinks(css string, base *url.URL) []link {
+	var links []link
+	for _, ref := range cssRefs(css) {
+		if u, ok := resolveLink(base, ref); ok {
+			links = append(links, link{url: u, asset: true})
+		}
+	}
+	return links
+}
+
+// cssRefs возвращает адреса из url(...) и @import
+func cssRefs(css string) []string {
+	var refs []string
+	for _, re := range []*regexp.Regexp{cssURL, cssImport} {
+		for _, match := range re.FindAllStringSubmatch(css, -1) {
+			for _, group := range match[1:] {
+				if group != "" {
+					refs = append(refs, group)
+					break
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// srcsetURLs возвращает адреса из списка вида "a.png 1x, b.png 2x"
+func srcsetURLs(srcset string) []string {
+	var refs []string
+	for _, candidate := range parseSrcset(srcset) {
+		refs = append(refs, candidate.url)
+	}
+	return refs
+}
+
+// srcsetCandidate - вариант из srcset: адрес и дескриптор (2x, 100w)
+type srcsetCandidate struct {
+	url        string
+	descriptor string
+}
+
+// parseSrcset разбирает srcset по правилам HTML: адрес идет до пробела,
+// поэтому запятые внутри него (data: URI) - часть адреса, а дескриптор -
+// до запятой вне скобок
+func parseSrcset(srcset string) []srcsetCandidate {
+	isSpace := func(c byte) bool { return strings.IndexByte(" \t\n\f\r", c) >= 0 }
+	var candidates []srcsetCandidate
+	i := 0
+	for {
+		for i < len(srcset) && (isSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+		if i == len(srcset) {
+			return candidates
+		}
+		start := i
+		for i < len(srcset) && !isSpace(srcset[i]) {
+			i++
+		}
+		candidate := srcsetCandidate{url: srcset[start:i]}
+		// запятая в конце адреса завершает вариант без дескриптора
+		if trimmed := strings.TrimRight(candidate.url, ","); trimmed != candidate.url {
+			candidate.url = trimmed
+		} else {
+			start = i
+			depth := 0
+			for ; i < len(srcset) && (srcset[i] != ',' || depth > 0); i++ {
+				switch srcset[i] {
+				case '(':
+					depth++
+				case ')':
+					depth = max(depth-1, 0)
+				}
+			}
+			candidate.descriptor = strings.Join(strings.Fields(srcset[start:i]), " ")
+		}
+		candidates = append(candidates, candidate)
+	}
+}
@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHTMLLinks(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		html        string
+		assets      bool
+		expected    []string // URL, у ресурсов с префиксом "asset "
+	}{
+		{
+			"ссылки и ресурсы",
+			"text/html",
+			`<a href="a">a</a><img srcset="i1.png 1x, i2.png 2x"><link rel="stylesheet" href="s.css"><link rel="next" href="p2">`,
+			true,
+			[]string{"http://example.com/docs/a", "asset http://example.com/docs/i1.png", "asset http://example.com/docs/i2.png", "asset http://example.com/docs/s.css", "http://example.com/docs/p2"},
+		},
+		{
+			"srcset с data: URI",
+			"text/html",
+			`<img srcset="data:image/png;base64,iVBORw0KGgo= 1x, i2.png 2x,i3.png">`,
+			true,
+			[]string{"asset http://example.com/docs/i2.png", "asset http://example.com/docs/i3.png"},
+		},
+		{
+			"без ресурсов",
+			"text/html",
+			`<a href="/a">a</a><img src="i.png"><style>body{background:url(bg.png)}</style>`,
+			false,
+			[]string{"http://example.com/a"},
+		},
+		{
+			"стили в элементе и атрибуте",
+			"text/html",
+			`<style>@import "x.css"; p{background:url('bg.png')}</style><div style="background: url(d.png)"></div><p>url(text.png)</p>`,
+			true,
+			[]string{"asset http://example.com/docs/bg.png", "asset http://example.com/docs/x.css", "asset http://example.com/docs/d.png"},
+		},
+		{
+			"base действует после себя, учитывается первый",
+			"text/html",
+			`<a href="a">a</a><base href="http://cdn.example.com/s/"><base href="/ignored/"><a href="b">b</a>`,
+			true,
+			[]string{"http://example.com/docs/a", "http://cdn.example.com/s/b"},
+		},
+		{
+			"кодировка из meta",
+			"text/html",
+			"<meta charset=\"windows-1251\"><a href=\"/\xf1\xf2\xf0\">\xf1\xf2\xf0</a>",
+			true,
+			[]string{"http://example.com/%D1%81%D1%82%D1%80"},
+		},
+		{
+			"кодировка из Content-Type",
+			"text/html; charset=koi8-r",
+			"<a href=\"/\xd3\xd4\xd2\">x</a>",
+			true,
+			[]string{"http://example.com/%D1%81%D1%82%D1%80"},
+		},
+	}
+
+	pageURL, _ := url.Parse("http://example.com/docs/index.html")
+	for _, test := range tests {
+		c := &Crawler{cfg: Config{IncludeAssets: test.assets}}
+
+		// одним куском из файла и по байту, как из сети
+		links, err := c.htmlLinks(strings.NewReader(test.html), pageURL, test.contentType)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		e := c.newLinkExtractor(pageURL, test.contentType)
+		for i := 0; i < len(test.html); i++ {
+			e.Write([]byte{test.html[i]})
+		}
+		streamed, err := e.finish(nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		for _, got := range [][]link{links, streamed} {
+			var urls []string
+			for _, l := range got {
+				if l.asset {
+					urls = append(urls, "asset "+l.url.String())
+				} else {
+					urls = append(urls, l.url.String())
+				}
+			}
+			if strings.Join(urls, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("%s: ссылки %q, ожидались %q", test.name, urls, test.expected)
+			}
+		}
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset   string
+		expected []srcsetCandidate
+	}{
+		{"a.png", []srcsetCandidate{{"a.png", ""}}},
+		{" a.png 1x ,b.png  2x ", []srcsetCandidate{{"a.png", "1x"}, {"b.png", "2x"}}},
+		{"a.png 100w, b.png 200w 300h", []srcsetCandidate{{"a.png", "100w"}, {"b.png", "200w 300h"}}},
+		{"data:image/png;base64,AAA= 1x, b.png 2x", []srcsetCandidate{{"data:image/png;base64,AAA=", "1x"}, {"b.png", "2x"}}},
+		{"a.png, b.png", []srcsetCandidate{{"a.png", ""}, {"b.png", ""}}},
+		{"a.png,,, b.png", []srcsetCandidate{{"a.png", ""}, {"b.png", ""}}},
+		{"a,b.png 1x", []srcsetCandidate{{"a,b.png", "1x"}}},
+		{"a.png f(1, 2), b.png", []srcsetCandidate{{"a.png", "f(1, 2)"}, {"b.png", ""}}},
+		{", ,", nil},
+		{"", nil},
+	}
+	for _, test := range tests {
+		if result := parseSrcset(test.srcset); !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("parseSrcset(%q) = %q, ожидалось %q", test.srcset, result, test.expected)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package crawler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxNameLen - предел длины имени файла в большинстве файловых систем
+const maxNameLen = 255
+
+// basePath возвращает путь файла для URL относительно каталога зеркала,
+// еще не зная Content-Type:
+//   - адреса каталогов ("/", "/docs/") сохраняются как index.html в них;
+//   - запрос дает к имени суффикс с хешем (list.php?p=2 -> list@1a2b3c4d.php),
+//     чтобы страницы с разными запросами не затирали друг друга;
+//   - сегменты "." и ".." отбрасываются, а символы, недопустимые в именах
+//     файлов, заменяются на "_", поэтому путь не выходит из каталога зеркала.
+func basePath(u *url.URL) string {
+	var segments []string
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, sanitizeSegment(segment))
+	}
+	if len(segments) == 0 || strings.HasSuffix(u.Path, "/") {
+		segments = append(segments, "index.html")
+	}
+
+	last := len(segments) - 1
+	if u.RawQuery != "" {
+		segments[last] = addSuffix(segments[last], "@"+shortHash(u.RawQuery))
+	}
+	for i, segment := range segments {
+		segments[i] = limitLength(segment)
+	}
+	return filepath.Join(segments...)
+}
+
+// sanitizeSegment заменяет управляющие символы и разделители путей
+func sanitizeSegment(segment string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '\\' {
+			return '_'
+		}
+		return r
+	}, segment)
+}
+
+// addSuffix вставляет суффикс перед расширением имени
+func addSuffix(name, suffix string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + suffix + ext
+}
+
+// limitLength укорачивает слишком длинное имя, сохраняя расширение
+// и добавляя хеш полного имени, чтобы укороченные имена не совпадали
+func limitLength(name string) string {
+	if len(name) <= maxNameLen {
+		return name
+	}
+	ext := path.Ext(name)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	suffix := "@" + shortHash(name) + ext
+	stem := name[:maxNameLen-len(suffix)]
+	// не разрезаем многобайтовый символ UTF-8
+	for len(stem) > 0 && !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+	return stem + suffix
+}
+
+// shortHash возвращает 8 шестнадцатеричных цифр FNV-1a от s
+func shortHash(s string) string {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// adjustExtension добавляет расширение, соответствующее Content-Type,
+// как wget -E: страница /about, отданная как text/html, сохраняется
+// в about.html, чтобы ее открывал браузер
+func adjustExtension(name, contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	ext := strings.ToLower(filepath.Ext(name))
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		if ext != ".html" && ext != ".htm" && ext != ".xhtml" {
+			return name + ".html"
+		}
+	case "text/css":
+		if ext != ".css" {
+			return name + ".css"
+		}
+	}
+	return name
+}
+
+// fileNamer выдает URL имена файлов и следит, чтобы разные URL не
+// получили имена, различающиеся только регистром: в нечувствительных
+// к регистру файловых системах (macOS, Windows) это один файл. Имя
+// файла не должно совпадать и с каталогом другого файла: /docs и
+// /docs/intro без -E - это файл docs и каталог docs.
+type fileNamer struct {
+	host   string // хост сайта; файлы других хостов лежат в каталогах по имени хоста
+	adjust bool   // добавлять расширение по Content-Type
+
+	mu     sync.Mutex
+	owners map[string]string // путь в нижнем регистре -> URL
+	parts  map[string]string // путь .part в нижнем регистре -> URL
+	dirs   map[string]bool   // каталоги выданных путей в нижнем регистре
+}
+
+// newFileNamer создает fileNamer. Имена файла состояния и его временной
+// копии заняты заранее, чтобы страница сайта /.crawl-state.json не
+// затерла их.
+func newFileNamer(host string, adjust bool) *fileNamer {
+	return &fileNamer{
+		host:   host,
+		adjust: adjust,
+		owners: map[string]string{
+			strings.ToLower(stateFile):                "",
+			strings.ToLower("." + stateFile + ".tmp"): "",
+		},
+		parts: make(map[string]string),
+		dirs:  make(map[string]bool),
+	}
+}
+
+// basePath - как basePath, но файлы с других хостов (CDN, поддомены)
+// кладутся в каталог хоста, чтобы не смешиваться с файлами сайта:
+// http://cdn.example.com:8080/a.js -> cdn.example.com+8080/a.js
+func (n *fileNamer) basePath(u *url.URL) string {
+	if u.Host == n.host {
+		return basePath(u)
+	}
+	host := sanitizeSegment(strings.ReplaceAll(u.Host, ":", "+"))
+	return filepath.Join(host, basePath(u))
+}
+
+// name возвращает путь файла для URL с учетом Content-Type.
+// Если путь уже выдан другому URL, к имени добавляется хеш URL.
+func (n *fileNamer) name(u *url.URL, contentType string) string {
+	name := n.basePath(u)
+	if n.adjust {
+		name = adjustExtension(name, contentType)
+	}
+	return n.claim(u.String(), name)
+}
+
+// claim закрепляет путь за URL. Путь, занятый другим URL или уже
+// ставший каталогом, получает суффикс с хешем URL.
+func (n *fileNamer) claim(urlStr, name string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.claimIn(n.owners, urlStr, name, "")
+}
+
+// partName возвращает путь недокачанного файла URL: базовое имя с теми
+// же поправками, что у файлов, чтобы два URL с одним базовым именем
+// не писали в один .part. Имена .part выдаются отдельно от имен файлов:
+// итоговое имя может отличаться расширением (-E).
+func (n *fileNamer) partName(u *url.URL) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.claimIn(n.parts, u.String(), n.basePath(u), partSuffix)
+}
+
+// claimIn закрепляет путь name+suffix за URL в owners
+func (n *fileNamer) claimIn(owners map[string]string, urlStr, name, suffix string) string {
+	name = n.fixDirs(name)
+	key := strings.ToLower(name + suffix)
+	if owner, ok := owners[key]; ok && owner != urlStr || n.dirs[key] {
+		name = addSuffix(name, "@"+shortHash(urlStr))
+		key = strings.ToLower(name + suffix)
+	}
+	name += suffix
+	owners[key] = urlStr
+	for dir := filepath.Dir(name); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		n.dirs[strings.ToLower(dir)] = true
+	}
+	return name
+}
+
+// fixDirs добавляет суффикс с хешем к каталогам пути, которые уже
+// выданы как файлы. Хеш зависит только от каталога, поэтому все файлы
+// из него попадают в один новый каталог.
+func (n *fileNamer) fixDirs(name string) string {
+	segments := strings.Split(name, string(filepath.Separator))
+	for i := range segments[:len(segments)-1] {
+		dir := filepath.Join(segments[:i+1]...)
+		if _, isFile := n.owners[strings.ToLower(dir)]; isFile {
+			segments[i] = limitLength(segments[i] + "@" + shortHash(dir))
+		}
+	}
+	return filepath.Join(segments...)
+}
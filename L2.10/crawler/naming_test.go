@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileNames(t *testing.T) {
+	tests := []struct {
+		url         string
+		contentType string
+		expected    string
+	}{
+		{"http://example.com", "text/html", "index.html"},
+		{"http://example.com/docs/", "text/html", "docs/index.html"},
+		{"http://example.com/about", "text/html; charset=utf-8", "about.html"},
+		{"http://example.com/about.htm", "text/html", "about.htm"},
+		{"http://example.com/style", "text/css", "style.css"},
+		{"http://example.com/img/logo.png", "image/png", "img/logo.png"},
+		{"http://example.com/list.php?page=2", "text/html", "list@" + shortHash("page=2") + ".php.html"},
+		{"http://example.com/?page=2", "text/html", "index@" + shortHash("page=2") + ".html"},
+		{"http://example.com/a/%2E%2E/%2E%2E/etc/passwd", "text/plain", "a/etc/passwd"},
+		{"http://example.com/a%5Cb", "text/plain", "a_b"},
+		{"http://cdn.example.com:8080/js/app.js", "text/javascript", "cdn.example.com+8080/js/app.js"},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := newFileNamer("example.com", true).name(u, test.contentType)
+		if result != filepath.FromSlash(test.expected) {
+			t.Errorf("%s (%s): получили %q, ожидали %q", test.url, test.contentType, result, test.expected)
+		}
+	}
+}
+
+func TestFileNameCollisions(t *testing.T) {
+	namer := newFileNamer("example.com", false)
+	upper, _ := url.Parse("http://example.com/Readme.txt")
+	lower, _ := url.Parse("http://example.com/readme.txt")
+
+	first := namer.name(upper, "text/plain")
+	second := namer.name(lower, "text/plain")
+	if first != "Readme.txt" || strings.EqualFold(first, second) {
+		t.Errorf("имена %q и %q совпадают без учета регистра", first, second)
+	}
+	if again := namer.name(lower, "text/plain"); again != second {
+		t.Errorf("повторное имя %q, ожидали %q", again, second)
+	}
+
+	long, _ := url.Parse("http://example.com/" + strings.Repeat("я", 200) + ".html")
+	if name := namer.name(long, "text/html"); len(name) > maxNameLen || !strings.HasSuffix(name, ".html") {
+		t.Errorf("длинное имя не укорочено: %d байт", len(name))
+	}
+}
+
+func TestFileDirCollisions(t *testing.T) {
+	h := func(s string) string { return "@" + shortHash(s) }
+	tests := []struct {
+		name     string
+		urls     []string
+		expected []string
+	}{
+		{
+			"файл, затем каталог с тем же именем",
+			[]string{"http://example.com/docs", "http://example.com/docs/intro", "http://example.com/docs/a/b"},
+			[]string{"docs", "docs" + h("docs") + "/intro", "docs" + h("docs") + "/a/b"},
+		},
+		{
+			"каталог, затем файл с тем же именем",
+			[]string{"http://example.com/docs/intro", "http://example.com/docs", "http://example.com/Docs"},
+			[]string{"docs/intro", "docs" + h("http://example.com/docs"), "Docs" + h("http://example.com/Docs")},
+		},
+		{
+			"каталог вложенного файла",
+			[]string{"http://example.com/a/b", "http://example.com/a/b/c/d"},
+			[]string{"a/b", "a/b" + h("a/b") + "/c/d"},
+		},
+	}
+	for _, test := range tests {
+		namer := newFileNamer("example.com", false)
+		for i, rawURL := range test.urls {
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result := namer.name(u, "text/html"); result != filepath.FromSlash(test.expected[i]) {
+				t.Errorf("%s: %s получил %q, ожидали %q", test.name, rawURL, result, test.expected[i])
+			}
+		}
+	}
+}
+
+func TestPartNames(t *testing.T) {
+	namer := newFileNamer("example.com", false)
+	parse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	site := parse("http://example.com/cdn.example.com/a.js")
+	cdn := parse("http://cdn.example.com/a.js")
+	upper := parse("http://example.com/A.js")
+	lower := parse("http://example.com/a.js")
+
+	first, second := namer.partName(site), namer.partName(cdn)
+	if first != filepath.FromSlash("cdn.example.com/a.js"+partSuffix) || first == second {
+		t.Errorf(".part сайта %q и CDN %q", first, second)
+	}
+	if again := namer.partName(cdn); again != second {
+		t.Errorf("повторный .part %q, ожидали %q", again, second)
+	}
+	if a, b := namer.partName(upper), namer.partName(lower); strings.EqualFold(a, b) {
+		t.Errorf(".part %q и %q совпадают без учета регистра", a, b)
+	}
+
+	// .part лежит в том же каталоге, что и итоговый файл
+	docs := parse("http://example.com/docs")
+	intro := parse("http://example.com/docs/intro")
+	namer.name(docs, "text/html")
+	if part, name := namer.partName(intro), namer.name(intro, "text/html"); part != name+partSuffix {
+		t.Errorf(".part %q не рядом с файлом %q", part, name)
+	}
+}
@@ -0,0 +1,198 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval - как часто перерисовываются полосы прогресса
+const progressInterval = 200 * time.Millisecond
+
+// barWidth - ширина полосы прогресса в символах
+const barWidth = 30
+
+// fileProgress - скачивание одного файла
+type fileProgress struct {
+	name  string
+	total int64 // -1, если сервер не сообщил размер
+	done  atomic.Int64
+}
+
+// progress показывает ход обхода: полосу для каждого скачиваемого файла
+// и общую полосу по найденным URL, а по окончании каждого URL - строку
+// журнала. В терминале полосы перерисовываются на месте под журналом,
+// иначе (вывод в файл или канал) выводится только журнал.
+type progress struct {
+	out    io.Writer // nil - ничего не выводить
+	live   bool
+	report *report
+	bytes  atomic.Int64 // получено байт за обход
+
+	mu     sync.Mutex
+	active []*fileProgress
+	drawn  int // строк полос на экране
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newProgress(out io.Writer, report *report) *progress {
+	p := &progress{out: out, report: report}
+	if file, ok := out.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			p.live = true
+		}
+	}
+	return p
+}
+
+// start запускает перерисовку полос
+func (p *progress) start() {
+	if !p.live {
+		return
+	}
+	p.stop = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.mu.Lock()
+				p.redraw()
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// finish останавливает перерисовку и стирает полосы
+func (p *progress) finish() {
+	if !p.live {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+}
+
+// startFile добавляет полосу файла; total < 0 - размер неизвестен
+func (p *progress) startFile(name string, done, total int64) *fileProgress {
+	f := &fileProgress{name: name, total: total}
+	f.done.Store(done)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active = append(p.active, f)
+	return f
+}
+
+// endFile убирает полосу файла
+func (p *progress) endFile(f *fileProgress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, active := range p.active {
+		if active == f {
+			p.active = append(p.active[:i], p.active[i+1:]...)
+			break
+		}
+	}
+}
+
+// reader считает байты, прочитанные из r, в полосу файла и общий итог
+func (p *progress) reader(f *fileProgress, r io.Reader) io.Reader {
+	return &progressReader{r: r, file: f, progress: p}
+}
+
+type progressReader struct {
+	r        io.Reader
+	file     *fileProgress
+	progress *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.file.done.Add(int64(n))
+	r.progress.bytes.Add(int64(n))
+	return n, err
+}
+
+// log выводит строку журнала над полосами
+func (p *progress) log(format string, args ...any) {
+	if p.out == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fmt.Fprintf(p.out, format+"\n", args...)
+	if p.live {
+		p.redraw()
+	}
+}
+
+// clear стирает нарисованные полосы
+func (p *progress) clear() {
+	if p.drawn > 0 {
+		// в начало первой полосы и стереть до конца экрана
+		fmt.Fprintf(p.out, "\x1b[%dF\x1b[J", p.drawn)
+		p.drawn = 0
+	}
+}
+
+func (p *progress) redraw() {
+	var b strings.Builder
+	for _, f := range p.active {
+		done := f.done.Load()
+		if f.total > 0 {
+			fmt.Fprintf(&b, "%s %3d%% %10s / %-10s %s\n", bar(float64(done)/float64(f.total)),
+				done*100/f.total, FormatBytes(done), FormatBytes(f.total), shorten(f.name, 40))
+		} else {
+			fmt.Fprintf(&b, "%s      %10s              %s\n", strings.Repeat(" ", barWidth+2),
+				FormatBytes(done), shorten(f.name, 40))
+		}
+	}
+
+	finished, total, failed := p.report.progress()
+	fraction := 0.0
+	if total > 0 {
+		fraction = float64(finished) / float64(total)
+	}
+	bytes := p.bytes.Load()
+	speed := float64(bytes) / time.Since(p.report.started).Seconds()
+	fmt.Fprintf(&b, "%s %d/%d URLs, %s, %s/s, %d errors\n",
+		bar(fraction), finished, total, FormatBytes(bytes), FormatBytes(int64(speed)), failed)
+
+	p.clear()
+	io.WriteString(p.out, b.String())
+	p.drawn = len(p.active) + 1
+}
+
+// bar рисует полосу прогресса: [=======>      ]
+func bar(fraction float64) string {
+	fraction = min(max(fraction, 0), 1)
+	filled := int(fraction * barWidth)
+	head := ""
+	if filled < barWidth {
+		head = ">"
+	}
+	return "[" + strings.Repeat("=", filled) + head + strings.Repeat(" ", barWidth-filled-len(head)) + "]"
+}
+
+// shorten укорачивает строку до n символов, оставляя конец
+func shorten(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return "..." + string(runes[len(runes)-n+3:])
+}
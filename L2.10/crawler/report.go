@@ -0,0 +1,276 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Итоги обработки URL в отчете об обходе
+const (
+	statusPending     = "pending"      // найден, но не обработан: обход остановлен
+	statusSaved       = "saved"        // скачан в этом запуске
+	statusNotModified = "not_modified" // не изменился на сервере (-N)
+	statusResumed     = "resumed"      // скачан прерванным прошлым запуском
+	statusRobots      = "robots"       // запрещен robots.txt
+	statusRejected    = "rejected"     // отклонен списками Accept и Reject
+	statusRedirected  = "redirected"   // перенаправлен, файл - у итогового URL
+	statusTooLarge    = "too_large"    // больше Config.MaxFileSize
+	statusPageLimit   = "page_limit"   // не скачан: достигнут Config.MaxPages
+	statusFailed      = "failed"
+)
+
+// httpError - ответ сервера с кодом ошибки
+type httpError struct {
+	url        string
+	status     int
+	text       string        // например "404 Not Found"
+	retryAfter time.Duration // из заголовка Retry-After
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("failed to download %s: server returned %s", e.url, e.text)
+}
+
+// errorType возвращает вид ошибки для статистики: "HTTP 404",
+// "timeout", "dns", "tls", "network", "filesystem" или "other"
+func errorType(err error) string {
+	var (
+		httpErr *httpError
+		dnsErr  *net.DNSError
+		certErr *tls.CertificateVerificationError
+		netErr  net.Error
+		pathErr *fs.PathError
+		linkErr *os.LinkError
+	)
+	switch {
+	case errors.As(err, &httpErr):
+		return fmt.Sprintf("HTTP %d", httpErr.status)
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, &certErr):
+		return "tls"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return "filesystem"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
+
+// urlRecord - строка отчета об обходе
+type urlRecord struct {
+	URL         string `json:"url"`
+	Depth       int    `json:"depth"`
+	Status      string `json:"status"`
+	Path        string `json:"path,omitempty"` // относительно каталога зеркала
+	ContentType string `json:"content_type,omitempty"`
+	Bytes       int64  `json:"bytes,omitempty"` // получено в этом запуске
+	Redirect    string `json:"redirect,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorType   string `json:"error_type,omitempty"`
+}
+
+// Stats - итоги обхода
+type Stats struct {
+	URLs        int            // найдено URL
+	Saved       int            // скачано файлов
+	NotModified int            // не изменилось на сервере
+	Skipped     int            // запрещено robots.txt, отклонено или вне пределов
+	Failed      int            // не скачано из-за ошибок
+	Bytes       int64          // получено байт
+	Errors      map[string]int // вид ошибки -> число URL
+	Elapsed     time.Duration
+}
+
+// Throughput возвращает среднюю скорость в байтах в секунду
+func (s Stats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Elapsed.Seconds()
+}
+
+// report собирает итоги по каждому найденному URL
+type report struct {
+	mu      sync.Mutex
+	started time.Time
+	urls    map[string]*urlRecord
+}
+
+func newReport() *report {
+	return &report{started: time.Now(), urls: make(map[string]*urlRecord)}
+}
+
+// discover добавляет найденный URL
+func (r *report) discover(url string, depth int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.urls[url]; !ok {
+		r.urls[url] = &urlRecord{URL: url, Depth: depth, Status: statusPending}
+	}
+}
+
+// finish записывает итог обработки URL
+func (r *report) finish(url, status string, meta fileMeta, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record := r.record(url)
+	record.Status = status
+	record.Path = meta.Path
+	record.ContentType = meta.ContentType
+	record.Bytes = bytes
+	record.Error, record.ErrorType = "", ""
+}
+
+// redirect отмечает, что URL перенаправлен на final
+func (r *report) redirect(url, final string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record := r.record(url)
+	record.Status = statusRedirected
+	record.Redirect = final
+}
+
+// fail записывает ошибку URL
+func (r *report) fail(url string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record := r.record(url)
+	record.Status = statusFailed
+	record.Error = err.Error()
+	record.ErrorType = errorType(err)
+}
+
+func (r *report) record(url string) *urlRecord {
+	record, ok := r.urls[url]
+	if !ok {
+		record = &urlRecord{URL: url}
+		r.urls[url] = record
+	}
+	return record
+}
+
+// progress возвращает число законченных и найденных URL и число ошибок
+func (r *report) progress() (finished, total, failed int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, record := range r.urls {
+		switch record.Status {
+		case statusPending:
+		case statusFailed:
+			failed++
+			finished++
+		default:
+			finished++
+		}
+	}
+	return finished, len(r.urls), failed
+}
+
+func (r *report) stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := Stats{URLs: len(r.urls), Errors: make(map[string]int), Elapsed: time.Since(r.started)}
+	for _, record := range r.urls {
+		stats.Bytes += record.Bytes
+		switch record.Status {
+		case statusSaved:
+			stats.Saved++
+		case statusNotModified:
+			stats.NotModified++
+		case statusRobots, statusRejected, statusTooLarge, statusPageLimit:
+			stats.Skipped++
+		case statusFailed:
+			stats.Failed++
+			stats.Errors[record.ErrorType]++
+		}
+	}
+	return stats
+}
+
+// write сохраняет отчет в JSON: итоги и все URL по алфавиту
+func (r *report) write(path, startURL string) error {
+	stats := r.stats()
+
+	r.mu.Lock()
+	records := make([]urlRecord, 0, len(r.urls))
+	for _, record := range r.urls {
+		records = append(records, *record)
+	}
+	r.mu.Unlock()
+	sort.Slice(records, func(i, j int) bool { return records[i].URL < records[j].URL })
+
+	data, err := json.MarshalIndent(struct {
+		StartURL    string         `json:"start_url"`
+		Started     time.Time      `json:"started"`
+		Elapsed     string         `json:"elapsed"`
+		Saved       int            `json:"saved"`
+		NotModified int            `json:"not_modified"`
+		Skipped     int            `json:"skipped"`
+		Failed      int            `json:"failed"`
+		Bytes       int64          `json:"bytes"`
+		Errors      map[string]int `json:"errors,omitempty"`
+		URLs        []urlRecord    `json:"urls"`
+	}{
+		StartURL:    startURL,
+		Started:     r.started,
+		Elapsed:     stats.Elapsed.Round(time.Millisecond).String(),
+		Saved:       stats.Saved,
+		NotModified: stats.NotModified,
+		Skipped:     stats.Skipped,
+		Failed:      stats.Failed,
+		Bytes:       stats.Bytes,
+		Errors:      stats.Errors,
+		URLs:        records,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save crawl report: %v", err)
+	}
+	return nil
+}
+
+// WriteSummary выводит итоги обхода
+func WriteSummary(w io.Writer, s Stats) {
+	fmt.Fprintf(w, "Downloaded %d files, %s in %s (%s/s)\n",
+		s.Saved, FormatBytes(s.Bytes), s.Elapsed.Round(time.Millisecond), FormatBytes(int64(s.Throughput())))
+	fmt.Fprintf(w, "URLs: %d, not modified: %d, skipped: %d, failed: %d\n",
+		s.URLs, s.NotModified, s.Skipped, s.Failed)
+	types := make([]string, 0, len(s.Errors))
+	for errType := range s.Errors {
+		types = append(types, errType)
+	}
+	sort.Strings(types)
+	for _, errType := range types {
+		fmt.Fprintf(w, "  %s: %d\n", errType, s.Errors[errType])
+	}
+}
+
+// FormatBytes форматирует размер: 512 B, 1.5 KiB, 3.2 MiB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, suffix := float64(n)/unit, "KiB"
+	for _, next := range []string{"MiB", "GiB", "TiB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
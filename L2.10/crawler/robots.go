@@ -0,0 +1,310 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsRule - строка Allow или Disallow из robots.txt
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsRules - правила robots.txt, относящиеся к нашему User-Agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	sitemaps   []string // строки Sitemap - они не относятся к группам
+}
+
+// allowAll и disallowAll - правила для сайтов без robots.txt
+// и для недоступного robots.txt (RFC 9309, 2.3.1)
+var (
+	allowAll    = &robotsRules{}
+	disallowAll = &robotsRules{rules: []robotsRule{{allow: false, pattern: "/"}}}
+)
+
+// parseRobots разбирает robots.txt и оставляет правила группы, которая
+// подходит к userAgent точнее всего; если такой нет - группы "*".
+// Несколько групп для одного агента объединяются.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	// в robots.txt сравнивается только название продукта, без версии
+	product := strings.ToLower(userAgent)
+	if i := strings.IndexAny(product, "/ "); i >= 0 {
+		product = product[:i]
+	}
+
+	type group struct {
+		agents []string
+		rules  robotsRules
+		delay  bool
+	}
+	var groups []*group
+	var current *group
+	var sitemaps []string
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// подряд идущие User-agent относятся к одной группе
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			// пустой Disallow ничего не запрещает
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules.rules = append(current.rules.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+				current.rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+				current.delay = true
+			}
+		case "sitemap":
+			inAgents = false
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	// выбираем агента с самым длинным совпадающим названием
+	bestLen := -1
+	result := &robotsRules{}
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			matchLen := -1
+			switch {
+			case agent == "*":
+				matchLen = 0
+			case agent != "" && strings.Contains(product, agent):
+				matchLen = len(agent)
+			}
+			if matchLen < 0 || matchLen < bestLen {
+				continue
+			}
+			if matchLen > bestLen {
+				bestLen = matchLen
+				result = &robotsRules{}
+			}
+			result.rules = append(result.rules, g.rules.rules...)
+			if g.delay {
+				result.crawlDelay = g.rules.crawlDelay
+			}
+			break
+		}
+	}
+	result.sitemaps = sitemaps
+	return result
+}
+
+// allowed проверяет путь (с запросом) по правилам: побеждает правило
+// с самым длинным шаблоном, при равенстве - Allow
+func (r *robotsRules) allowed(path string) bool {
+	allow, best := true, -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > best || len(rule.pattern) == best && rule.allow {
+			allow, best = rule.allow, len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// robotsMatch сопоставляет путь с шаблоном robots.txt: шаблон - префикс
+// пути, "*" - любая последовательность символов, "$" в конце - конец пути
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		// последний кусок при "$" должен стоять в самом конце
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return !anchored || rest == ""
+}
+
+// robotsErrorTTL - сколько помнится временная ошибка загрузки
+// robots.txt; потом файл запрашивается снова
+const robotsErrorTTL = time.Minute
+
+// hostState - robots.txt, время следующего запроса и ограничение
+// скорости для одного хоста
+type hostState struct {
+	robotsMu      sync.Mutex
+	robots        *robotsRules
+	robotsErr     error
+	robotsExpires time.Time // когда запросить robots.txt снова после ошибки
+	limiter       *rateLimiter
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (c *Crawler) host(u *url.URL) *hostState {
+	key := u.Scheme + "://" + u.Host
+	if state, ok := c.hosts.Load(key); ok {
+		return state.(*hostState)
+	}
+	state, _ := c.hosts.LoadOrStore(key, &hostState{limiter: newRateLimiter(c.cfg.HostLimitRate)})
+	return state.(*hostState)
+}
+
+// robotsFor загружает robots.txt хоста при первом обращении. Временная
+// ошибка запоминается на robotsErrorTTL: пока она действует, robotsFor
+// возвращает ее и правила disallowAll, не запрашивая файл снова.
+func (c *Crawler) robotsFor(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	if c.cfg.IgnoreRobots {
+		return allowAll, nil
+	}
+	state := c.host(u)
+	state.robotsMu.Lock()
+	defer state.robotsMu.Unlock()
+	if state.robots != nil && (state.robotsErr == nil || time.Now().Before(state.robotsExpires)) {
+		return state.robots, state.robotsErr
+	}
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	rules, err := c.fetchRobots(ctx, robotsURL.String())
+	if ctx.Err() != nil {
+		// остановка обхода - не ошибка сайта
+		return rules, err
+	}
+	state.robots, state.robotsErr = rules, err
+	state.robotsExpires = time.Now().Add(robotsErrorTTL)
+	return rules, err
+}
+
+// fetchRobots загружает robots.txt, повторяя временные ошибки до
+// Config.Retries раз. Недоступный после повторов robots.txt (сеть, 5xx,
+// 429) запрещает обход хоста (RFC 9309, 2.3.1.4) и возвращается как
+// ошибка. Если файла нет (4xx) или клиент остановился на
+// перенаправлении за границы обхода, ограничений нет.
+func (c *Crawler) fetchRobots(ctx context.Context, robotsURL string) (*robotsRules, error) {
+	for attempt := 0; ; attempt++ {
+		rules, err := c.fetchRobotsOnce(ctx, robotsURL)
+		if err == nil {
+			return rules, nil
+		}
+		if attempt >= c.cfg.Retries || ctx.Err() != nil || !retryable(err) {
+			return disallowAll, fmt.Errorf("failed to fetch robots.txt %s: %w", robotsURL, err)
+		}
+		if err := c.waitRetry(ctx, attempt, err); err != nil {
+			return disallowAll, err
+		}
+	}
+}
+
+func (c *Crawler) fetchRobotsOnce(ctx context.Context, robotsURL string) (*robotsRules, error) {
+	resp, err := c.fetch(ctx, robotsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &httpError{
+			url:        robotsURL,
+			status:     resp.StatusCode,
+			text:       resp.Status,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	case resp.StatusCode >= 300:
+		return allowAll, nil
+	}
+	// RFC 9309 требует разбирать не меньше 500 КиБ
+	return parseRobots(io.LimitReader(resp.Body, 512*1024), c.cfg.UserAgent), nil
+}
+
+// allowedByRobots сообщает, разрешает ли robots.txt скачивать URL;
+// ошибка - robots.txt хоста временно недоступен
+func (c *Crawler) allowedByRobots(ctx context.Context, u *url.URL) (bool, error) {
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	rules, err := c.robotsFor(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return rules.allowed(path), nil
+}
+
+// politeWait выдерживает паузу между запросами к одному хосту:
+// большую из Config.Delay и Crawl-delay из robots.txt. Возвращает
+// ошибку, если обход остановлен во время ожидания.
+func (c *Crawler) politeWait(ctx context.Context, u *url.URL) error {
+	delay := c.cfg.Delay
+	if robots, _ := c.robotsFor(ctx, u); robots.crawlDelay > delay {
+		delay = robots.crawlDelay
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	state := c.host(u)
+	state.mu.Lock()
+	now := time.Now()
+	start := state.next
+	if start.Before(now) {
+		start = now
+	}
+	state.next = start.Add(delay)
+	state.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,245 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/", "/any", true},
+		{"/private", "/private/a", true},
+		{"/private", "/privateer", true},
+		{"/private", "/public", false},
+		{"/*.php", "/a/b.php", true},
+		{"/*.php", "/a/b.php?x=1", true},
+		{"/*.php$", "/a/b.php", true},
+		{"/*.php$", "/a/b.php?x=1", false},
+		{"/a*b*c", "/a1b2c3", true},
+		{"/a*b*c", "/a1c2b", false},
+		{"/exact$", "/exact", true},
+		{"/exact$", "/exact/", false},
+		{"/*$", "/x", true},
+	}
+	for _, test := range tests {
+		if result := robotsMatch(test.pattern, test.path); result != test.expected {
+			t.Errorf("robotsMatch(%q, %q) = %v, ожидалось %v", test.pattern, test.path, result, test.expected)
+		}
+	}
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	const robots = `
+# общая группа
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Allow: /tie
+Disallow: /tie
+Disallow: /files/*.tmp
+
+User-agent: wget
+Disallow: /wget-only
+
+User-agent: other
+User-agent: WGET
+Disallow: /merged
+Allow: /wget-only/open
+`
+	tests := []struct {
+		userAgent string
+		path      string
+		expected  bool
+	}{
+		// группа "*": самое длинное правило побеждает
+		{"curl/8.0", "/private/x", false},
+		{"curl/8.0", "/private/public/x", true},
+		{"curl/8.0", "/doc.pdf", false},
+		{"curl/8.0", "/doc.pdf?download=1", true},
+		{"curl/8.0", "/files/a/b.tmp", false},
+		{"curl/8.0", "/files/a.txt", true},
+		// при равной длине побеждает Allow
+		{"curl/8.0", "/tie", true},
+		{"curl/8.0", "/wget-only", true},
+		// своя группа заменяет "*", а две группы wget объединяются
+		{"Wget/1.21", "/private/x", true},
+		{"Wget/1.21", "/wget-only/x", false},
+		{"Wget/1.21", "/wget-only/open/x", true},
+		{"Wget/1.21", "/merged", false},
+		// сравнивается название продукта без версии
+		{"wget-mirror/2.0", "/wget-only", false},
+		{"mirror wget/1.0", "/wget-only", true},
+	}
+	for _, test := range tests {
+		rules := parseRobots(strings.NewReader(robots), test.userAgent)
+		if result := rules.allowed(test.path); result != test.expected {
+			t.Errorf("%s: allowed(%q) = %v, ожидалось %v", test.userAgent, test.path, result, test.expected)
+		}
+	}
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	const robots = `
+User-agent: *
+Crawl-delay: 5
+
+User-agent: wget
+Crawl-delay: 0.5
+Disallow:
+
+User-agent: slow
+Crawl-delay: fast
+
+Sitemap: http://example.com/sitemap.xml
+`
+	tests := []struct {
+		userAgent string
+		expected  time.Duration
+	}{
+		{"curl/8.0", 5 * time.Second},
+		{"Wget/1.21", 500 * time.Millisecond},
+		{"slow", 0},
+	}
+	for _, test := range tests {
+		rules := parseRobots(strings.NewReader(robots), test.userAgent)
+		if rules.crawlDelay != test.expected {
+			t.Errorf("%s: Crawl-delay = %v, ожидалось %v", test.userAgent, rules.crawlDelay, test.expected)
+		}
+		if len(rules.sitemaps) != 1 || rules.sitemaps[0] != "http://example.com/sitemap.xml" {
+			t.Errorf("%s: Sitemap = %q", test.userAgent, rules.sitemaps)
+		}
+	}
+	// пустой Disallow ничего не запрещает
+	if rules := parseRobots(strings.NewReader(robots), "wget"); !rules.allowed("/any") {
+		t.Error("пустой Disallow запретил путь")
+	}
+}
+
+func TestFetchRobots(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/ok/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/missing/robots.txt":
+			http.NotFound(w, r)
+		case "/moved/robots.txt":
+			// перенаправление за границы обхода клиент не выполняет
+			http.Redirect(w, r, "http://other.invalid/robots.txt", http.StatusFound)
+		case "/flaky/robots.txt":
+			if hits[r.URL.Path] == 1 {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		default:
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	// сервер, который уже не принимает соединения
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	c, err := New(Config{URL: srv.URL, OutputDir: t.TempDir(), Retries: 1, RetryWait: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url      string
+		expected bool // разрешен ли /private
+		fails    bool
+	}{
+		{srv.URL + "/ok/robots.txt", false, false},
+		{srv.URL + "/missing/robots.txt", true, false},
+		{srv.URL + "/moved/robots.txt", true, false},
+		{srv.URL + "/flaky/robots.txt", false, false},
+		{srv.URL + "/down/robots.txt", false, true},
+		{closed.URL + "/robots.txt", false, true},
+	}
+	for _, test := range tests {
+		rules, err := c.fetchRobots(context.Background(), test.url)
+		if (err != nil) != test.fails {
+			t.Errorf("%s: ошибка %v", test.url, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "robots.txt") {
+			t.Errorf("%s: в ошибке не назван robots.txt: %v", test.url, err)
+		}
+		if result := rules.allowed("/private"); result != test.expected {
+			t.Errorf("%s: allowed(/private) = %v, ожидалось %v", test.url, result, test.expected)
+		}
+	}
+	// временная ошибка повторяется Config.Retries раз
+	if hits["/down/robots.txt"] != 2 || hits["/flaky/robots.txt"] != 2 {
+		t.Errorf("запросы robots.txt: %v", hits)
+	}
+}
+
+func TestRobotsErrorCache(t *testing.T) {
+	var mu sync.Mutex
+	robotsHits, down := 0, true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			robotsHits++
+			if down {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{
+		URL: srv.URL + "/a", Seeds: []string{srv.URL + "/b", srv.URL + "/c"},
+		OutputDir: t.TempDir(), Retries: 1, RetryWait: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// все URL хоста - неудачи с ошибкой robots.txt, а не запреты
+	err = c.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failed to fetch robots.txt") {
+		t.Errorf("Run: %v, ожидалась ошибка robots.txt", err)
+	}
+	if stats := c.Stats(); stats.Failed != 3 || stats.Skipped != 0 {
+		t.Errorf("итоги обхода %+v, ожидались три неудачи", stats)
+	}
+	// ошибка запомнена: robots.txt запрошен один раз с повтором
+	if robotsHits != 2 {
+		t.Errorf("robots.txt запрошен %d раз, ожидалось 2", robotsHits)
+	}
+
+	// когда ошибка устарела, robots.txt запрашивается снова
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	u, _ := url.Parse(srv.URL + "/a")
+	c.host(u).robotsExpires = time.Now().Add(-time.Second)
+	if allowed, err := c.allowedByRobots(context.Background(), u); !allowed || err != nil {
+		t.Errorf("после срока ошибки allowed = %v, %v", allowed, err)
+	}
+	if robotsHits != 3 {
+		t.Errorf("robots.txt запрошен %d раз, ожидалось 3", robotsHits)
+	}
+}
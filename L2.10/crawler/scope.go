@@ -0,0 +1,181 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// scope решает, какие URL входят в обход
+type scope struct {
+	hosts          map[string]bool // хост стартового URL и его вариант с www. или без
+	domains        []string
+	excludeDomains []string
+	spanHosts      bool
+	parent         string // с NoParent - каталог стартового URL, иначе пусто
+	includeDirs    []string
+	excludeDirs    []string
+	acceptRegex    *regexp.Regexp
+	rejectRegex    *regexp.Regexp
+	accept         []string
+	reject         []string
+}
+
+func newScope(base string, basePath string, cfg Config) (*scope, error) {
+	s := &scope{
+		hosts:          map[string]bool{base: true},
+		domains:        lowerAll(cfg.Domains),
+		excludeDomains: lowerAll(cfg.ExcludeDomains),
+		spanHosts:      cfg.SpanHosts,
+		includeDirs:    cfg.IncludeDirs,
+		excludeDirs:    cfg.ExcludeDirs,
+		accept:         lowerAll(cfg.Accept),
+		reject:         lowerAll(cfg.Reject),
+	}
+	// example.com и www.example.com - один сайт
+	if bare, ok := strings.CutPrefix(base, "www."); ok {
+		s.hosts[bare] = true
+	} else {
+		s.hosts["www."+base] = true
+	}
+
+	if cfg.NoParent {
+		dir := basePath
+		if !strings.HasSuffix(dir, "/") {
+			dir = path.Dir(dir) + "/"
+		}
+		if dir != "/" {
+			s.parent = dir
+		}
+	}
+
+	var err error
+	if cfg.AcceptRegex != "" {
+		if s.acceptRegex, err = regexp.Compile(cfg.AcceptRegex); err != nil {
+			return nil, fmt.Errorf("invalid accept regex: %v", err)
+		}
+	}
+	if cfg.RejectRegex != "" {
+		if s.rejectRegex, err = regexp.Compile(cfg.RejectRegex); err != nil {
+			return nil, fmt.Errorf("invalid reject regex: %v", err)
+		}
+	}
+	return s, nil
+}
+
+func lowerAll(list []string) []string {
+	result := make([]string, 0, len(list))
+	for _, s := range list {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// allows сообщает, входит ли URL в обход. Ресурсы страницы (asset)
+// с SpanHosts скачиваются с любых хостов и не ограничиваются NoParent;
+// страницы - только с сайта и из Domains. Списки Accept и Reject
+// проверяются здесь только для файлов, которые не похожи на страницы:
+// страницы нужно скачать, чтобы найти в них ссылки (см. acceptsFile).
+func (s *scope) allows(u *url.URL, asset bool) bool {
+	urlPath := u.Path
+	if !s.hostAllowed(u.Hostname(), asset) {
+		return false
+	}
+	if !asset && s.parent != "" && !strings.HasPrefix(urlPath, s.parent) {
+		return false
+	}
+	if len(s.includeDirs) > 0 && !hasDirPrefix(urlPath, s.includeDirs) {
+		return false
+	}
+	if hasDirPrefix(urlPath, s.excludeDirs) {
+		return false
+	}
+	if s.acceptRegex != nil && !s.acceptRegex.MatchString(u.String()) {
+		return false
+	}
+	if s.rejectRegex != nil && s.rejectRegex.MatchString(u.String()) {
+		return false
+	}
+	return looksLikePage(urlPath) || s.acceptsFile(urlPath)
+}
+
+func (s *scope) hostAllowed(host string, asset bool) bool {
+	host = strings.ToLower(host)
+	for _, d := range s.excludeDomains {
+		if domainMatch(host, d) {
+			return false
+		}
+	}
+	if s.hosts[host] {
+		return true
+	}
+	for _, d := range s.domains {
+		if domainMatch(host, d) {
+			return true
+		}
+	}
+	return asset && s.spanHosts
+}
+
+// isSite сообщает, что host - хост сайта, а не другого домена
+func (s *scope) isSite(host string) bool {
+	return s.hosts[strings.ToLower(host)]
+}
+
+// domainMatch сообщает, что host - домен d или его поддомен
+func domainMatch(host, d string) bool {
+	return host == d || strings.HasSuffix(host, "."+d)
+}
+
+// hasDirPrefix сообщает, что путь лежит в одном из каталогов
+func hasDirPrefix(urlPath string, dirs []string) bool {
+	for _, dir := range dirs {
+		dir = "/" + strings.Trim(dir, "/")
+		if dir == "/" || urlPath == dir || strings.HasPrefix(urlPath, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsFile проверяет имя файла по спискам Accept и Reject: элемент
+// с *, ? или [ - шаблон имени, иначе - окончание имени ("jpg", ".pdf")
+func (s *scope) acceptsFile(urlPath string) bool {
+	name := strings.ToLower(path.Base(urlPath))
+	if strings.HasSuffix(urlPath, "/") {
+		name = ""
+	}
+	if len(s.accept) > 0 && !matchesAny(name, s.accept) {
+		return false
+	}
+	return !matchesAny(name, s.reject)
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		} else if strings.HasSuffix(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikePage сообщает, что по имени URL может быть HTML страницей
+func looksLikePage(urlPath string) bool {
+	if strings.HasSuffix(urlPath, "/") {
+		return true
+	}
+	switch strings.ToLower(path.Ext(urlPath)) {
+	case "", ".html", ".htm", ".xhtml", ".php", ".asp", ".aspx", ".jsp", ".cgi":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		url      string
+		asset    bool
+		expected bool
+	}{
+		{"тот же хост", Config{}, "http://example.com/a", false, true},
+		{"вариант с www", Config{}, "http://www.example.com/a", false, true},
+		{"чужой хост", Config{}, "http://other.com/a", false, false},
+		{"ресурс с CDN без span-hosts", Config{}, "http://cdn.net/a.js", true, false},
+		{"ресурс с CDN", Config{SpanHosts: true}, "http://cdn.net/a.js", true, true},
+		{"страница с CDN при span-hosts", Config{SpanHosts: true}, "http://cdn.net/a", false, false},
+		{"поддомен из domains", Config{Domains: []string{"example.org"}}, "http://blog.example.org/", false, true},
+		{"исключенный домен", Config{SpanHosts: true, ExcludeDomains: []string{"ads.net"}}, "http://x.ads.net/a.js", true, false},
+		{"no-parent: выше стартового каталога", Config{NoParent: true}, "http://example.com/other/", false, false},
+		{"no-parent: внутри каталога", Config{NoParent: true}, "http://example.com/docs/guide/", false, true},
+		{"no-parent: ресурс выше каталога", Config{NoParent: true}, "http://example.com/static/a.css", true, true},
+		{"include-directories", Config{IncludeDirs: []string{"/docs"}}, "http://example.com/blog/", false, false},
+		{"exclude-directories", Config{ExcludeDirs: []string{"docs/private"}}, "http://example.com/docs/private/a", false, false},
+		{"accept-regex", Config{AcceptRegex: `/docs/`}, "http://example.com/docs/a", false, true},
+		{"reject-regex", Config{RejectRegex: `\?sort=`}, "http://example.com/docs/?sort=asc", false, false},
+		{"accept: другой тип файла", Config{Accept: []string{"jpg", "png"}}, "http://example.com/a.pdf", false, false},
+		{"accept: страница нужна ради ссылок", Config{Accept: []string{"jpg"}}, "http://example.com/docs/a.html", false, true},
+		{"reject по шаблону", Config{Reject: []string{"*.min.*"}}, "http://example.com/app.min.js", true, false},
+	}
+
+	for _, test := range tests {
+		test.cfg.URL, test.cfg.OutputDir = "http://example.com/docs/index.html", t.TempDir()
+		c, err := New(test.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := c.scope.allows(u, test.asset); result != test.expected {
+			t.Errorf("%s: %s - получили %v, ожидали %v", test.name, test.url, result, test.expected)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// maxSitemapSize - предел размера карты сайта (sitemaps.org: 50 МБ
+// без сжатия)
+const maxSitemapSize = 50 << 20
+
+// maxSitemapDepth - сколько уровней индексов карт разворачивается
+const maxSitemapDepth = 3
+
+// sitemap - карта сайта (urlset) или индекс карт (sitemapindex)
+type sitemap struct {
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// sitemapURLs возвращает адреса страниц из карт сайта, перечисленных
+// в строках Sitemap файла robots.txt стартового хоста, а если их нет -
+// из /sitemap.xml. Индексы карт разворачиваются, сжатые gzip карты
+// распаковываются. Недоступная карта - не ошибка: у многих сайтов ее нет.
+func (c *Crawler) sitemapURLs(ctx context.Context) []*url.URL {
+	rules, err := c.robotsFor(ctx, c.baseURL)
+	if c.cfg.IgnoreRobots {
+		// правила не соблюдаются, но строки Sitemap нужны
+		robotsURL := &url.URL{Scheme: c.baseURL.Scheme, Host: c.baseURL.Host, Path: "/robots.txt"}
+		rules, err = c.fetchRobots(ctx, robotsURL.String())
+	}
+	if err != nil {
+		c.progress.log("sitemap: %v", err)
+	}
+	queue := rules.sitemaps
+	if len(queue) == 0 {
+		queue = []string{(&url.URL{Scheme: c.baseURL.Scheme, Host: c.baseURL.Host, Path: "/sitemap.xml"}).String()}
+	}
+
+	seen := make(map[string]bool)
+	var pages []*url.URL
+	for depth := 0; len(queue) > 0 && depth <= maxSitemapDepth; depth++ {
+		var next []string
+		for _, loc := range queue {
+			sitemapURL, ok := resolveLink(c.baseURL, loc)
+			if !ok || seen[sitemapURL.String()] {
+				continue
+			}
+			seen[sitemapURL.String()] = true
+
+			sm, err := c.fetchSitemap(ctx, sitemapURL.String())
+			if err != nil {
+				c.progress.log("sitemap: %v", err)
+				continue
+			}
+			for _, loc := range sm.URLs {
+				if u, ok := resolveLink(sitemapURL, loc); ok {
+					pages = append(pages, u)
+				}
+			}
+			next = append(next, sm.Sitemaps...)
+		}
+		queue = next
+	}
+	c.progress.log("sitemap: %d URLs", len(pages))
+	return pages
+}
+
+// fetchSitemap скачивает и разбирает карту сайта
+func (c *Crawler) fetchSitemap(ctx context.Context, sitemapURL string) (*sitemap, error) {
+	resp, err := c.fetch(ctx, sitemapURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download sitemap %s: %w", sitemapURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &httpError{url: sitemapURL, status: resp.StatusCode, text: resp.Status}
+	}
+
+	// сжатую карту узнаем по содержимому: сервер отдает sitemap.xml.gz
+	// и как application/gzip, и как application/octet-stream
+	var body io.Reader = bufio.NewReader(io.LimitReader(resp.Body, maxSitemapSize))
+	if magic, _ := body.(*bufio.Reader).Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sitemap %s: %v", sitemapURL, err)
+		}
+		defer zr.Close()
+		body = io.LimitReader(zr, maxSitemapSize)
+	}
+
+	sm := &sitemap{}
+	if err := xml.NewDecoder(body).Decode(sm); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap %s: %v", sitemapURL, err)
+	}
+	return sm, nil
+}
@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stateFile - файл состояния обхода в каталоге зеркала
+const stateFile = ".crawl-state.json"
+
+// stateSaveInterval - как часто состояние сбрасывается на диск во время обхода
+const stateSaveInterval = time.Second
+
+// fileMeta - сведения о скачанном файле для условных запросов и докачки
+type fileMeta struct {
+	Path         string `json:"path,omitempty"` // относительно каталога зеркала
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+}
+
+// crawlState - состояние обхода, сохраняемое между запусками. Пока обход
+// идет, в Pending лежат найденные, но не законченные URL, а в Done -
+// законченные; по ним прерванный обход продолжается. После успешного
+// обхода остаются только Files - для условных запросов при повторном
+// зеркалировании.
+type crawlState struct {
+	mu       sync.Mutex
+	storage  Storage
+	lastSave time.Time
+
+	Pending map[string]int       `json:"pending,omitempty"` // URL -> глубина
+	Done    map[string]int       `json:"done,omitempty"`
+	Files   map[string]*fileMeta `json:"files,omitempty"`
+}
+
+// loadState читает состояние из хранилища; если файла нет, состояние пустое
+func loadState(storage Storage) (*crawlState, error) {
+	s := &crawlState{storage: storage}
+	data, err := readFile(storage, stateFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read crawl state: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("failed to parse crawl state %s: %v", stateFile, err)
+		}
+	}
+	if s.Pending == nil {
+		s.Pending = make(map[string]int)
+	}
+	if s.Done == nil {
+		s.Done = make(map[string]int)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]*fileMeta)
+	}
+	return s, nil
+}
+
+// resume возвращает законченные и незаконченные URL прерванного обхода
+func (s *crawlState) resume() (done, pending map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	done = make(map[string]int, len(s.Done))
+	for url, depth := range s.Done {
+		done[url] = depth
+	}
+	pending = make(map[string]int, len(s.Pending))
+	for url, depth := range s.Pending {
+		pending[url] = depth
+	}
+	return done, pending
+}
+
+// start отмечает URL как найденный
+func (s *crawlState) start(url string, depth int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Pending[url] = depth
+}
+
+// finish отмечает URL как законченный и время от времени сохраняет
+// состояние, чтобы после остановки не пришлось начинать сначала
+func (s *crawlState) finish(url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if depth, ok := s.Pending[url]; ok {
+		delete(s.Pending, url)
+		s.Done[url] = depth
+	}
+	if time.Since(s.lastSave) < stateSaveInterval {
+		return nil
+	}
+	// после ошибки следующая попытка - тоже через интервал
+	s.lastSave = time.Now()
+	return s.saveLocked()
+}
+
+// meta возвращает копию сведений о файле URL
+func (s *crawlState) meta(url string) fileMeta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if meta, ok := s.Files[url]; ok {
+		return *meta
+	}
+	return fileMeta{}
+}
+
+// paths возвращает пути сохраненных файлов по URL
+func (s *crawlState) paths() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths := make(map[string]string, len(s.Files))
+	for url, meta := range s.Files {
+		if meta.Path != "" {
+			paths[url] = meta.Path
+		}
+	}
+	return paths
+}
+
+func (s *crawlState) setMeta(url string, meta fileMeta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Files[url] = &meta
+}
+
+// complete завершает обход: следующий запуск начнется заново,
+// но с условными запросами по сохраненным Files
+func (s *crawlState) complete() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.Pending)
+	clear(s.Done)
+	return s.saveLocked()
+}
+
+func (s *crawlState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+func (s *crawlState) saveLocked() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := replaceFile(s.storage, stateFile, data); err != nil {
+		return fmt.Errorf("failed to save crawl state: %v", err)
+	}
+	s.lastSave = time.Now()
+	return nil
+}
+
+// writeFileAtomic записывает файл через временный файл в том же каталоге
+// и переименование, чтобы при остановке не оставалось недописанных файлов
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,254 @@
+package crawler
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage хранит зеркало сайта: скачанные файлы, недокачанные .part и
+// состояние обхода. Имена - пути относительно корня зеркала, как
+// fileMeta.Path. Воркеры вызывают методы одновременно, но для разных
+// имен. Так зеркало можно держать в памяти, в архиве или в базе.
+type Storage interface {
+	// Open открывает файл для чтения; если файла нет - fs.ErrNotExist
+	Open(name string) (fs.File, error)
+	// Create открывает файл для записи, создавая каталоги; с append
+	// запись продолжает существующий файл, иначе заменяет его
+	Create(name string, append bool) (io.WriteCloser, error)
+	// Rename переименовывает файл, заменяя newname
+	Rename(oldname, newname string) error
+	// Remove удаляет файл
+	Remove(name string) error
+	// Chtimes задает время изменения файла
+	Chtimes(name string, mtime time.Time) error
+}
+
+// DirStorage - зеркало в каталоге на диске, хранилище по умолчанию
+type DirStorage string
+
+func (d DirStorage) path(name string) string {
+	return filepath.Join(string(d), name)
+}
+
+func (d DirStorage) Open(name string) (fs.File, error) {
+	return os.Open(d.path(name))
+}
+
+func (d DirStorage) Create(name string, append bool) (io.WriteCloser, error) {
+	path := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if append {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	return os.OpenFile(path, flags, 0644)
+}
+
+func (d DirStorage) Rename(oldname, newname string) error {
+	path := d.path(newname)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.Rename(d.path(oldname), path)
+}
+
+func (d DirStorage) Remove(name string) error {
+	return os.Remove(d.path(name))
+}
+
+func (d DirStorage) Chtimes(name string, mtime time.Time) error {
+	return os.Chtimes(d.path(name), mtime, mtime)
+}
+
+// MemStorage - зеркало в памяти: для тестов и программ, которые
+// обрабатывают скачанное сами. Записанное видно после Close.
+type MemStorage struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemStorage() *MemStorage {
+	return &MemStorage{files: make(map[string]*memFile)}
+}
+
+// ReadFile возвращает содержимое файла
+func (m *MemStorage) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(file.data), nil
+}
+
+// Names возвращает имена файлов по алфавиту
+func (m *MemStorage) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *MemStorage) Open(name string) (fs.File, error) {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	// запись заменяет data целиком, поэтому читать можно без блокировки
+	return &memReader{Reader: bytes.NewReader(file.data), info: memInfo{name, file}}, nil
+}
+
+func (m *MemStorage) Create(name string, append bool) (io.WriteCloser, error) {
+	name = filepath.Clean(name)
+	w := &memWriter{storage: m, name: name}
+	if append {
+		m.mu.Lock()
+		if file, ok := m.files[name]; ok {
+			w.data = bytes.Clone(file.data)
+		}
+		m.mu.Unlock()
+	}
+	return w, nil
+}
+
+func (m *MemStorage) Rename(oldname, newname string) error {
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, ok := m.files[oldname]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldname)
+	m.files[newname] = file
+	return nil
+}
+
+func (m *MemStorage) Remove(name string) error {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *MemStorage) Chtimes(name string, mtime time.Time) error {
+	name = filepath.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, ok := m.files[name]
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrNotExist}
+	}
+	m.files[name] = &memFile{data: file.data, modTime: mtime}
+	return nil
+}
+
+// memWriter копит записанное и сохраняет файл при Close
+type memWriter struct {
+	storage *MemStorage
+	name    string
+	data    []byte
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	w.data = append(w.data, p...)
+	return len(p), nil
+}
+
+func (w *memWriter) Close() error {
+	w.storage.mu.Lock()
+	defer w.storage.mu.Unlock()
+	w.storage.files[w.name] = &memFile{data: w.data, modTime: time.Now()}
+	return nil
+}
+
+// memReader - открытый файл MemStorage
+type memReader struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (r *memReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+func (r *memReader) Close() error               { return nil }
+
+// memInfo - fs.FileInfo файла MemStorage
+type memInfo struct {
+	name string
+	file *memFile
+}
+
+func (i memInfo) Name() string       { return filepath.Base(i.name) }
+func (i memInfo) Size() int64        { return int64(len(i.file.data)) }
+func (i memInfo) Mode() fs.FileMode  { return 0644 }
+func (i memInfo) ModTime() time.Time { return i.file.modTime }
+func (i memInfo) IsDir() bool        { return false }
+func (i memInfo) Sys() any           { return nil }
+
+// statFile возвращает сведения о файле хранилища
+func statFile(s Storage, name string) (fs.FileInfo, error) {
+	file, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+// readFile читает файл хранилища целиком
+func readFile(s Storage, name string) ([]byte, error) {
+	file, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// replaceFile записывает файл хранилища через временный файл и
+// переименование, чтобы при остановке не оставалось недописанных файлов
+func replaceFile(s Storage, name string, data []byte) error {
+	tmp := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	w, err := s.Create(tmp, false)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		s.Remove(tmp)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		s.Remove(tmp)
+		return err
+	}
+	if err := s.Rename(tmp, name); err != nil {
+		s.Remove(tmp)
+		return err
+	}
+	return nil
+}
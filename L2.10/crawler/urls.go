@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// defaultPorts - порты, которые не пишутся в нормализованном URL
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// normalizeURL приводит URL к виду, в котором одинаковые адреса совпадают
+// как строки: схема и хост в нижнем регистре, порт по умолчанию убран,
+// фрагмент отброшен, пустой путь заменен на "/", точечные сегменты
+// раскрыты, а процентное кодирование приведено к единой форме.
+func normalizeURL(u *url.URL) *url.URL {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if port := n.Port(); port != "" && port == defaultPorts[n.Scheme] {
+		n.Host = strings.TrimSuffix(n.Host, ":"+port)
+	}
+	n.Fragment = ""
+	n.RawFragment = ""
+
+	// ResolveReference с пустой ссылкой раскрывает "." и ".." в пути
+	path := (&url.URL{Path: "/"}).ResolveReference(&url.URL{Path: n.Path, RawPath: n.RawPath})
+	n.Path, n.RawPath = path.Path, ""
+	if escaped := normalizeEscapes(path.EscapedPath()); escaped != n.EscapedPath() {
+		if unescaped, err := url.PathUnescape(escaped); err == nil {
+			n.Path, n.RawPath = unescaped, escaped
+		}
+	}
+	n.RawQuery = normalizeEscapes(n.RawQuery)
+	n.ForceQuery = false
+	return &n
+}
+
+// normalizeEscapes раскодирует незарезервированные символы (%7E -> ~)
+// и переводит шестнадцатеричные цифры остальных кодов в верхний регистр
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// isUnreserved сообщает, что символ не требует кодирования (RFC 3986)
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// resolveLink разрешает ссылку относительно адреса страницы и нормализует
+// ее. Пустые ссылки, якоря внутри страницы и схемы кроме http(s) -
+// mailto:, javascript:, data:, tel: - отбрасываются.
+func resolveLink(base *url.URL, link string) (*url.URL, bool) {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return nil, false
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return nil, false
+	}
+	target := base.ResolveReference(ref)
+	if target.Scheme != "http" && target.Scheme != "https" || target.Host == "" {
+		return nil, false
+	}
+	return normalizeURL(target), true
+}
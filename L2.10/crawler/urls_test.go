@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"http://example.com", "http://example.com/"},
+		{"HTTP://Example.COM/Path", "http://example.com/Path"},
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com:80/a", "https://example.com:80/a"},
+		{"http://example.com/a/./b/../c", "http://example.com/a/c"},
+		{"http://example.com/../a", "http://example.com/a"},
+		{"http://example.com/a/b/..", "http://example.com/a/"},
+		{"http://example.com/a#frag", "http://example.com/a"},
+		{"http://example.com/%7Euser", "http://example.com/~user"},
+		{"http://example.com/a%2fb", "http://example.com/a%2Fb"},
+		{"http://example.com/%e2%82%ac", "http://example.com/%E2%82%AC"},
+		{"http://example.com/a?q=%7e%2f", "http://example.com/a?q=~%2F"},
+		{"http://example.com/a?", "http://example.com/a"},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := normalizeURL(u).String(); result != test.expected {
+			t.Errorf("normalizeURL(%q) = %q, ожидалось %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestNormalizeEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"%7E%7e%41%2d", "~~A-"},
+		{"%2f%3A", "%2F%3A"},
+		{"100%", "100%"},
+		{"%zz%4", "%zz%4"},
+	}
+	for _, test := range tests {
+		if result := normalizeEscapes(test.input); result != test.expected {
+			t.Errorf("normalizeEscapes(%q) = %q, ожидалось %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestResolveLink(t *testing.T) {
+	base, _ := url.Parse("http://example.com/docs/page.html")
+	tests := []struct {
+		link     string
+		expected string // пусто - ссылка отброшена
+	}{
+		{"other.html", "http://example.com/docs/other.html"},
+		{"  ../a.html  ", "http://example.com/a.html"},
+		{"/a/./b/../c", "http://example.com/a/c"},
+		{"//Example.com:80/x", "http://example.com/x"},
+		{"HTTPS://CDN.example.com:443", "https://cdn.example.com/"},
+		{"other.html#part", "http://example.com/docs/other.html"},
+		{"?q=1", "http://example.com/docs/page.html?q=1"},
+		{"", ""},
+		{"#frag", ""},
+		{"mailto:a@example.com", ""},
+		{"javascript:void(0)", ""},
+		{"data:text/plain,hi", ""},
+		{"tel:+123", ""},
+		{"ftp://example.com/file", ""},
+		{"http://[::1", ""},
+	}
+	for _, test := range tests {
+		result, ok := resolveLink(base, test.link)
+		switch {
+		case test.expected == "" && ok:
+			t.Errorf("resolveLink(%q) = %q, ожидалось отбросить", test.link, result)
+		case test.expected != "" && !ok:
+			t.Errorf("resolveLink(%q) отброшена, ожидалось %q", test.link, test.expected)
+		case ok && result.String() != test.expected:
+			t.Errorf("resolveLink(%q) = %q, ожидалось %q", test.link, result, test.expected)
+		}
+	}
+}
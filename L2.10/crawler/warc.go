@@ -0,0 +1,377 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warcDateFormat - WARC-Date: UTC, WARC 1.1 допускает доли секунды
+const warcDateFormat = "2006-01-02T15:04:05.000000Z"
+
+// warcWriter пишет WARC 1.1: каждая запись сжата отдельным gzip-блоком,
+// поэтому ее можно прочитать по смещению из CDX, не распаковывая файл
+// целиком. При продолжении обхода записи дописываются в конец файла.
+type warcWriter struct {
+	path    string // .warc.gz
+	cdxPath string
+
+	mu     sync.Mutex
+	file   *os.File
+	offset int64
+	cdx    []string
+	err    error // первая ошибка записи, возвращается из close
+}
+
+// openWARC открывает base.warc.gz и пишет запись warcinfo;
+// индекс пишется в base.cdx при close
+func openWARC(base string) (*warcWriter, error) {
+	w := &warcWriter{path: base + ".warc.gz", cdxPath: base + ".cdx"}
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WARC file: %v", err)
+	}
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WARC file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create WARC file: %v", err)
+	}
+	w.file, w.offset = file, info.Size()
+
+	fields := fmt.Sprintf("software: %s\r\nformat: WARC File Format 1.1\r\n"+
+		"conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n",
+		DefaultUserAgent)
+	headers := [][2]string{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", time.Now().UTC().Format(warcDateFormat)},
+		{"WARC-Filename", filepath.Base(w.path)},
+		{"Content-Type", "application/warc-fields"},
+	}
+	if _, _, err := w.writeRecord(headers, strings.NewReader(fields), int64(len(fields))); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// newRecordID возвращает WARC-Record-ID - случайный UUID
+func newRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // версия 4
+	b[8] = b[8]&0x3f | 0x80 // вариант RFC 4122
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// digest форматирует SHA-1 как в WARC-*-Digest
+func digest(h hash.Hash) string {
+	return "sha1:" + base32.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// writeRecord дописывает запись отдельным gzip-блоком и возвращает ее
+// смещение и сжатую длину
+func (w *warcWriter) writeRecord(headers [][2]string, block io.Reader, length int64) (offset, size int64, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, 0, errors.New("WARC file is closed")
+	}
+
+	counter := &countingWriter{w: w.file}
+	zw := gzip.NewWriter(counter)
+	buf := bufio.NewWriter(zw)
+	buf.WriteString("WARC/1.1\r\n")
+	for _, header := range headers {
+		fmt.Fprintf(buf, "%s: %s\r\n", header[0], header[1])
+	}
+	fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n", length)
+	if _, err := io.Copy(buf, block); err != nil {
+		return 0, 0, fmt.Errorf("failed to write WARC record: %v", err)
+	}
+	buf.WriteString("\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write WARC record: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write WARC record: %v", err)
+	}
+
+	offset = w.offset
+	w.offset += counter.n
+	return offset, counter.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// exchange - один запрос и ответ на него
+type exchange struct {
+	date     time.Time
+	req      *http.Request
+	reqBody  []byte
+	resp     *http.Response
+	payload  *os.File // тело ответа в том виде, в каком оно прочитано
+	size     int64
+	complete bool // тело прочитано до конца
+}
+
+// writeExchange пишет запись request и запись response и добавляет
+// ответ в индекс
+func (w *warcWriter) writeExchange(e *exchange) error {
+	date := e.date.UTC().Format(warcDateFormat)
+	target := e.req.URL.String()
+	responseID := newRecordID()
+
+	// запрос: строка запроса, заголовки и тело
+	var reqBlock bytes.Buffer
+	fmt.Fprintf(&reqBlock, "%s %s HTTP/1.1\r\nHost: %s\r\n", e.req.Method, e.req.URL.RequestURI(), requestHost(e.req))
+	e.req.Header.Write(&reqBlock)
+	reqBlock.WriteString("\r\n")
+	reqBlock.Write(e.reqBody)
+	blockHash := sha1.New()
+	blockHash.Write(reqBlock.Bytes())
+	_, _, err := w.writeRecord([][2]string{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", target},
+		{"WARC-Concurrent-To", responseID},
+		{"WARC-Block-Digest", digest(blockHash)},
+		{"Content-Type", "application/http;msgtype=request"},
+	}, &reqBlock, int64(reqBlock.Len()))
+	if err != nil {
+		return err
+	}
+
+	// ответ: строка статуса, заголовки и тело
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "%s %s\r\n", e.resp.Proto, e.resp.Status)
+	e.resp.Header.Write(&head)
+	head.WriteString("\r\n")
+
+	payloadHash := sha1.New()
+	blockHash = sha1.New()
+	blockHash.Write(head.Bytes())
+	if _, err := e.payload.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to write WARC record: %v", err)
+	}
+	if _, err := io.Copy(io.MultiWriter(payloadHash, blockHash), e.payload); err != nil {
+		return fmt.Errorf("failed to write WARC record: %v", err)
+	}
+	if _, err := e.payload.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to write WARC record: %v", err)
+	}
+
+	headers := [][2]string{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", target},
+		{"WARC-Block-Digest", digest(blockHash)},
+		{"WARC-Payload-Digest", digest(payloadHash)},
+		{"Content-Type", "application/http;msgtype=response"},
+	}
+	if !e.complete {
+		// тело не дочитано: обход остановлен или файл слишком большой
+		headers = append(headers, [2]string{"WARC-Truncated", "unspecified"})
+	}
+	offset, size, err := w.writeRecord(headers, io.MultiReader(&head, e.payload), int64(head.Len())+e.size)
+	if err != nil {
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(e.resp.Header.Get("Content-Type"))
+	if mediaType == "" {
+		mediaType = "unk"
+	}
+	redirect := "-"
+	if location, err := e.resp.Location(); err == nil {
+		redirect = location.String()
+	}
+	w.mu.Lock()
+	w.cdx = append(w.cdx, strings.Join([]string{
+		surt(e.req.URL), e.date.UTC().Format("20060102150405"), cdxField(target), mediaType,
+		strconv.Itoa(e.resp.StatusCode), strings.TrimPrefix(digest(payloadHash), "sha1:"),
+		cdxField(redirect), "-", strconv.FormatInt(size, 10), strconv.FormatInt(offset, 10),
+		filepath.Base(w.path),
+	}, " "))
+	w.mu.Unlock()
+	return nil
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// cdxField заменяет пробелы, разделяющие поля CDX
+func cdxField(s string) string {
+	return strings.ReplaceAll(s, " ", "%20")
+}
+
+// surt - ключ сортировки CDX: домен в обратном порядке без www.
+// (IP-адрес как есть), затем путь и запрос в нижнем регистре
+// (http://www.example.com/A?b -> com,example)/a?b)
+func surt(u *url.URL) string {
+	key := strings.ToLower(u.Hostname())
+	if net.ParseIP(key) == nil {
+		parts := strings.Split(strings.TrimPrefix(key, "www."), ".")
+		for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+			parts[i], parts[j] = parts[j], parts[i]
+		}
+		key = strings.Join(parts, ",")
+	}
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80" || u.Scheme == "https" && port == "443") {
+		key += ":" + port
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return cdxField(key + ")" + strings.ToLower(path))
+}
+
+// close закрывает WARC и пишет индекс: строки прошлых запусков
+// и этого, отсортированные по ключу
+func (w *warcWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	if w.err != nil {
+		return w.err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save WARC file: %v", err)
+	}
+
+	lines := w.cdx
+	if data, err := os.ReadFile(w.cdxPath); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" && !strings.HasPrefix(line, " CDX") {
+				lines = append(lines, line)
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read CDX index: %v", err)
+	}
+	sort.Strings(lines)
+	data := " CDX N b a m s k r M S V g\n" + strings.Join(lines, "\n") + "\n"
+	if err := writeFileAtomic(w.cdxPath, []byte(data), 0644); err != nil {
+		return fmt.Errorf("failed to save CDX index: %v", err)
+	}
+	return nil
+}
+
+// warcTransport записывает в WARC каждый запрос и ответ. Тело ответа
+// копируется во временный файл по мере чтения, и пара записей пишется,
+// когда тело закрыто: длину записи нужно знать заранее.
+type warcTransport struct {
+	next http.RoundTripper
+	warc *warcWriter
+}
+
+func (t *warcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := &exchange{date: time.Now(), req: req}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			e.reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := os.CreateTemp("", "warc-payload-*")
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to record %s: %v", req.URL, err)
+	}
+	e.resp, e.payload = resp, payload
+	resp.Body = &warcBody{body: resp.Body, exchange: e, transport: t}
+	return resp, nil
+}
+
+// warcBody копирует прочитанное тело ответа во временный файл
+type warcBody struct {
+	body      io.ReadCloser
+	exchange  *exchange
+	transport *warcTransport
+	once      sync.Once
+}
+
+func (b *warcBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		if _, werr := b.exchange.payload.Write(p[:n]); werr != nil {
+			return n, fmt.Errorf("failed to record response: %w", werr)
+		}
+		b.exchange.size += int64(n)
+	}
+	if err == io.EOF {
+		b.exchange.complete = true
+	}
+	return n, err
+}
+
+func (b *warcBody) Close() error {
+	err := b.body.Close()
+	b.once.Do(func() {
+		e := b.exchange
+		if e.resp.ContentLength >= 0 && e.size == e.resp.ContentLength {
+			// пустое тело (304, HEAD) или прочитанное ровно до длины
+			e.complete = true
+		}
+		if werr := b.transport.warc.writeExchange(e); werr != nil {
+			w := b.transport.warc
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = werr
+			}
+			w.mu.Unlock()
+		}
+		e.payload.Close()
+		os.Remove(e.payload.Name())
+	})
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"512", 512},
+		{"200k", 200 * 1024},
+		{"1.5M", 3 * 512 * 1024},
+		{"2g", 2 << 30},
+	}
+	for _, test := range tests {
+		if result, err := parseSize(test.input); err != nil || result != test.expected {
+			t.Errorf("parseSize(%q) = %d, %v, ожидали %d", test.input, result, err, test.expected)
+		}
+	}
+	if _, err := parseSize("fast"); err == nil {
+		t.Error("parseSize(\"fast\") не вернул ошибку")
+	}
+}
+
+func TestReadURLList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	data := "# список\nhttp://a.example/\n\n  http://b.example/x  \r\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	urls, err := readURLList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://a.example/", "http://b.example/x"}
+	if strings.Join(urls, " ") != strings.Join(want, " ") {
+		t.Errorf("readURLList = %q, ожидалось %q", urls, want)
+	}
+}
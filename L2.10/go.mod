@@ -0,0 +1,7 @@
+module wget
+
+go 1.23.2
+
+require golang.org/x/net v0.25.0
+
+require golang.org/x/text v0.15.0 // indirect
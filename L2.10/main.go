@@ -1,176 +1,17 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
 	"os"
-	"path"
-	"path/filepath"
-	"strings"
-	"sync"
+	"os/signal"
+	"syscall"
 
-	"golang.org/x/net/html"
+	"wget/crawler"
 )
 
-type Crawler struct {
-	baseURL        *url.URL
-	visitedURLs    sync.Map
-	maxDepth       int
-	outputDir      string
-	concurrency    int
-	includeAssets  bool
-	skipTLSVerify  bool
-	semaphore      chan struct{}
-}
-
-func NewCrawler(baseURL string, maxDepth int, outputDir string, concurrency int, includeAssets bool, skipTLSVerify bool) (*Crawler, error) {
-	parsedURL, err := url.Parse(baseURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid URL: %v", err)
-	}
-
-	return &Crawler{
-		baseURL:        parsedURL,
-		maxDepth:       maxDepth,
-		outputDir:      outputDir,
-		concurrency:    concurrency,
-		includeAssets:  includeAssets,
-		skipTLSVerify:  skipTLSVerify,
-		semaphore:      make(chan struct{}, concurrency),
-	}, nil
-}
-
-func (c *Crawler) Download(urlStr string, depth int) error {
-	if depth > c.maxDepth {
-		return nil
-	}
-
-	// Проверяем, не скачивали ли мы уже этот URL
-	if _, visited := c.visitedURLs.LoadOrStore(urlStr, true); visited {
-		return nil
-	}
-
-	// Получаем семафор
-	c.semaphore <- struct{}{}
-	defer func() { <-c.semaphore }()
-
-	// Парсим URL
-	parsedURL, err := url.Parse(urlStr)
-	if err != nil {
-		return fmt.Errorf("invalid URL %s: %v", urlStr, err)
-	}
-
-	// Проверяем, что URL относится к тому же домену
-	if parsedURL.Host != c.baseURL.Host {
-		return nil
-	}
-
-	// Создаем HTTP клиент
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: c.skipTLSVerify,
-			},
-		},
-	}
-
-	// Выполняем HTTP запрос
-	resp, err := client.Get(urlStr)
-	if err != nil {
-		return fmt.Errorf("failed to download %s: %v", urlStr, err)
-	}
-	defer resp.Body.Close()
-
-	// Создаем путь для сохранения файла
-	relativePath := strings.TrimPrefix(parsedURL.Path, "/")
-	if relativePath == "" {
-		relativePath = "index.html"
-	}
-	filePath := filepath.Join(c.outputDir, relativePath)
-
-	// Создаем необходимые директории
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return fmt.Errorf("failed to create directories for %s: %v", filePath, err)
-	}
-
-	// Создаем файл
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s: %v", filePath, err)
-	}
-	defer file.Close()
-
-	// Копируем содержимое
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to save content to %s: %v", filePath, err)
-	}
-
-	// Если это HTML документ, ищем ссылки и ресурсы
-	if strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
-		// Перечитываем файл для парсинга HTML
-		file.Seek(0, 0)
-		doc, err := html.Parse(file)
-		if err != nil {
-			return fmt.Errorf("failed to parse HTML from %s: %v", filePath, err)
-		}
-
-		var wg sync.WaitGroup
-		c.processNode(doc, depth+1, &wg)
-		wg.Wait()
-	}
-
-	return nil
-}
-
-func (c *Crawler) processNode(n *html.Node, depth int, wg *sync.WaitGroup) {
-	if n.Type == html.ElementNode {
-		var attr string
-		switch n.Data {
-		case "a":
-			attr = "href"
-		case "img", "script", "link":
-			if c.includeAssets {
-				attr = "src"
-				if n.Data == "link" {
-					attr = "href"
-				}
-			}
-		}
-
-		if attr != "" {
-			for _, a := range n.Attr {
-				if a.Key == attr {
-					link := a.Val
-					if strings.HasPrefix(link, "/") {
-						link = c.baseURL.Scheme + "://" + c.baseURL.Host + link
-					} else if !strings.HasPrefix(link, "http") {
-						base := c.baseURL.String()
-						if !strings.HasSuffix(base, "/") {
-							base += "/"
-						}
-						link = base + link
-					}
-
-					wg.Add(1)
-					go func(url string) {
-						defer wg.Done()
-						c.Download(url, depth)
-					}(link)
-				}
-			}
-		}
-	}
-
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		c.processNode(c, depth, wg)
-	}
-}
-
 func main() {
 	url := flag.String("url", "", "URL to download")
 	depth := flag.Int("depth", 1, "Maximum depth for recursive downloading")
@@ -178,26 +19,174 @@ func main() {
 	concurrency := flag.Int("concurrency", 5, "Number of concurrent downloads")
 	includeAssets := flag.Bool("assets", true, "Download assets (images, scripts, styles)")
 	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification")
-	
+	convertLinks := flag.Bool("convert-links", false, "Rewrite links in saved HTML and CSS for offline browsing")
+	flag.BoolVar(convertLinks, "k", false, "Shorthand for -convert-links")
+	userAgent := flag.String("user-agent", crawler.DefaultUserAgent, "User-Agent header and robots.txt agent name")
+	ignoreRobots := flag.Bool("ignore-robots", false, "Ignore robots.txt (only for sites you own)")
+	delay := flag.Duration("delay", 0, "Minimum delay between requests to the same host")
+	timestamping := flag.Bool("timestamping", false, "Skip files that have not changed on the server")
+	flag.BoolVar(timestamping, "N", false, "Shorthand for -timestamping")
+	adjustExtension := flag.Bool("adjust-extension", false, "Add .html/.css to saved file names based on Content-Type")
+	flag.BoolVar(adjustExtension, "E", false, "Shorthand for -adjust-extension")
+	domains := flag.String("domains", "", "Comma-separated list of other domains to crawl")
+	flag.StringVar(domains, "D", "", "Shorthand for -domains")
+	excludeDomains := flag.String("exclude-domains", "", "Comma-separated list of domains to never crawl")
+	spanHosts := flag.Bool("span-hosts", false, "Download page requisites from any host")
+	flag.BoolVar(spanHosts, "H", false, "Shorthand for -span-hosts")
+	noParent := flag.Bool("no-parent", false, "Do not ascend above the start URL's directory")
+	flag.BoolVar(noParent, "np", false, "Shorthand for -no-parent")
+	includeDirs := flag.String("include-directories", "", "Comma-separated list of directories to crawl")
+	flag.StringVar(includeDirs, "I", "", "Shorthand for -include-directories")
+	excludeDirs := flag.String("exclude-directories", "", "Comma-separated list of directories to skip")
+	flag.StringVar(excludeDirs, "X", "", "Shorthand for -exclude-directories")
+	acceptRegex := flag.String("accept-regex", "", "Only download URLs matching the regular expression")
+	rejectRegex := flag.String("reject-regex", "", "Skip URLs matching the regular expression")
+	accept := flag.String("accept", "", "Comma-separated list of file suffixes or name patterns to keep")
+	flag.StringVar(accept, "A", "", "Shorthand for -accept")
+	reject := flag.String("reject", "", "Comma-separated list of file suffixes or name patterns to skip")
+	flag.StringVar(reject, "R", "", "Shorthand for -reject")
+	quiet := flag.Bool("quiet", false, "Do not show progress")
+	flag.BoolVar(quiet, "q", false, "Shorthand for -quiet")
+	reportFile := flag.String("report", "", "Write a JSON crawl report to this file")
+	connectTimeout := flag.Duration("connect-timeout", crawler.DefaultConnectTimeout, "Timeout for connecting and the TLS handshake")
+	readTimeout := flag.Duration("read-timeout", crawler.DefaultReadTimeout, "Timeout for waiting on data from the server")
+	retries := flag.Int("retries", 3, "Number of retries for transient errors, 5xx and 429 responses")
+	retryWait := flag.Duration("retry-wait", crawler.DefaultRetryWait, "Initial delay between retries, doubled on each retry")
+	var limitRate, hostLimitRate, quotaSize, maxFileSize byteSize
+	flag.Var(&limitRate, "limit-rate", "Limit total download speed, bytes per second (e.g. 200k, 1m)")
+	flag.Var(&hostLimitRate, "host-limit-rate", "Limit download speed per host, bytes per second")
+	flag.Var(&quotaSize, "quota", "Stop the crawl after downloading this many bytes (e.g. 500m)")
+	flag.Var(&maxFileSize, "max-file-size", "Skip files larger than this size")
+	maxPages := flag.Int("max-pages", 0, "Maximum number of pages to download, 0 for no limit")
+	var headers headerFlag
+	flag.Var(&headers, "header", "Add a request header \"Name: value\" (repeatable)")
+	username := flag.String("user", "", "Username for HTTP basic authentication")
+	password := flag.String("password", os.Getenv("WGET_PASSWORD"), "Password for HTTP basic authentication (default $WGET_PASSWORD)")
+	cookieFile := flag.String("cookies", "", "Load cookies from and save them to this Netscape cookies.txt file")
+	loginURL := flag.String("login-url", "", "URL of a login form to submit before crawling")
+	loginData := flag.String("login-data", "", "URL-encoded login form fields, e.g. user=me&pass=secret")
+	warcFile := flag.String("warc-file", "", "Also record all requests and responses to NAME.warc.gz with a NAME.cdx index")
+	inputFile := flag.String("i", "", "Also download URLs listed in this file, one per line (- for stdin)")
+	sitemaps := flag.Bool("sitemap", false, "Also download pages listed in sitemap.xml and robots.txt Sitemap lines")
+
 	flag.Parse()
 
+	var seeds []string
+	if *inputFile != "" {
+		list, err := readURLList(*inputFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		// без -url обход начинается с первого URL списка
+		if *url == "" && len(list) > 0 {
+			*url, list = list[0], list[1:]
+		}
+		seeds = list
+	}
 	if *url == "" {
-		fmt.Println("Please provide a URL using -url flag")
+		fmt.Println("Please provide a URL using -url or -i flag")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	crawler, err := NewCrawler(*url, *depth, *outputDir, *concurrency, *includeAssets, *skipTLSVerify)
+	cfg := crawler.Config{
+		URL:           *url,
+		MaxDepth:      *depth,
+		OutputDir:     *outputDir,
+		Concurrency:   *concurrency,
+		IncludeAssets: *includeAssets,
+		SkipTLSVerify: *skipTLSVerify,
+		UserAgent:     *userAgent,
+		IgnoreRobots:  *ignoreRobots,
+		Delay:         *delay,
+		Timestamping:  *timestamping,
+
+		AdjustExtension: *adjustExtension,
+
+		Domains:        splitList(*domains),
+		ExcludeDomains: splitList(*excludeDomains),
+		SpanHosts:      *spanHosts,
+		NoParent:       *noParent,
+		IncludeDirs:    splitList(*includeDirs),
+		ExcludeDirs:    splitList(*excludeDirs),
+		AcceptRegex:    *acceptRegex,
+		RejectRegex:    *rejectRegex,
+		Accept:         splitList(*accept),
+		Reject:         splitList(*reject),
+
+		ConnectTimeout: *connectTimeout,
+		ReadTimeout:    *readTimeout,
+		Retries:        *retries,
+		RetryWait:      *retryWait,
+
+		LimitRate:     int64(limitRate),
+		HostLimitRate: int64(hostLimitRate),
+		Quota:         int64(quotaSize),
+		MaxFileSize:   int64(maxFileSize),
+		MaxPages:      *maxPages,
+
+		Headers:    headers.header,
+		Username:   *username,
+		Password:   *password,
+		CookieFile: *cookieFile,
+		LoginURL:   *loginURL,
+		LoginData:  *loginData,
+
+		WARCFile: *warcFile,
+
+		Seeds:    seeds,
+		Sitemaps: *sitemaps,
+	}
+	if !*quiet {
+		cfg.Progress = os.Stderr
+	}
+	c, err := crawler.New(cfg)
 	if err != nil {
 		fmt.Printf("Error creating crawler: %v\n", err)
 		os.Exit(1)
 	}
 
+	// При остановке Run сохраняет состояние: следующий запуск продолжит обход
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	fmt.Printf("Starting download of %s (depth: %d)\n", *url, *depth)
-	if err := crawler.Download(*url, 0); err != nil {
-		fmt.Printf("Error during download: %v\n", err)
+	err = c.Run(ctx)
+	stats := c.Stats()
+	crawler.WriteSummary(os.Stdout, stats)
+	if *reportFile != "" {
+		if err := c.WriteReport(*reportFile); err != nil {
+			fmt.Printf("Error writing report: %v\n", err)
+		}
+	}
+	if ctx.Err() != nil {
+		fmt.Println("Interrupted; run again with the same -output to continue")
+		os.Exit(130)
+	}
+	// Ссылки переписываются и после неудачных URL: иначе одна битая
+	// ссылка оставляет все зеркало непригодным для просмотра
+	if *convertLinks {
+		converted, err := c.ConvertLinks()
+		if err != nil {
+			fmt.Printf("Error converting links: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Converted links in %d files\n", converted)
+	}
+	if errors.Is(err, crawler.ErrQuotaExceeded) {
+		fmt.Printf("Download quota of %s exceeded; run again with the same -output to continue\n", crawler.FormatBytes(int64(quotaSize)))
+		os.Exit(0)
+	}
+	if err != nil {
+		// ошибки отдельных URL уже в журнале, итогах и отчете
+		if stats.Failed > 0 {
+			fmt.Printf("Download finished with %d failed URLs\n", stats.Failed)
+		} else {
+			fmt.Printf("Error during download: %v\n", err)
+		}
 		os.Exit(1)
 	}
 
 	fmt.Println("Download completed successfully")
-}
\ No newline at end of file
+}
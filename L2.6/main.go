@@ -2,29 +2,52 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type GrepConfig struct {
-	After      int
-	Before     int
-	Context    int
-	Count      bool
-	IgnoreCase bool
-	Invert     bool
-	Fixed      bool
-	LineNum    bool
-	Pattern    string
-	InputFile  string
+	After        int
+	Before       int
+	Context      int
+	Count        bool
+	IgnoreCase   bool
+	Invert       bool
+	Fixed        bool
+	LineNum      bool
+	ByteOffset   bool   // -b: смещение строки (с -o - совпадения) в байтах
+	OnlyMatching bool   // -o: печатать только совпадения
+	JSON         bool   // --json: строки JSON вместо текста
+	Color        string // --color: always, never или auto
+	Pattern      string
+	InputFile    string
+}
+
+// Match - совпадение в строке, смещения в байтах от начала строки
+type Match struct {
+	Start int
+	End   int
+}
+
+// Line - строка ввода с совпадениями в ней. Весь вывод - текст, -o,
+// цвета и JSON - строится по этим данным.
+type Line struct {
+	Num     int
+	Offset  int64 // смещение начала строки от начала ввода
+	Text    string
+	Matches []Match
 }
 
 func main() {
 	config := parseFlags()
-	
+
 	if err := grep(config); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
@@ -40,6 +63,10 @@ func parseFlags() GrepConfig {
 	invert := flag.Bool("v", false, "invert match")
 	fixed := flag.Bool("F", false, "fixed string match")
 	lineNum := flag.Bool("n", false, "print line numbers")
+	byteOffset := flag.Bool("b", false, "print byte offset of each line (of each match with -o)")
+	onlyMatching := flag.Bool("o", false, "print only the matched parts of lines")
+	jsonOutput := flag.Bool("json", false, "print results as JSON lines")
+	color := flag.String("color", "auto", "highlight matches: always, never or auto; colors are taken from GREP_COLORS")
 
 	flag.Parse()
 	args := flag.Args()
@@ -49,27 +76,39 @@ func parseFlags() GrepConfig {
 		os.Exit(1)
 	}
 
+	switch *color {
+	case "always", "never", "auto":
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -color %q: expected always, never or auto\n", *color)
+		os.Exit(1)
+	}
+
 	inputFile := ""
 	if len(args) > 1 {
 		inputFile = args[1]
 	}
 
 	return GrepConfig{
-		After:      *after,
-		Before:     *before,
-		Context:    *context,
-		Count:      *count,
-		IgnoreCase: *ignoreCase,
-		Invert:     *invert,
-		Fixed:      *fixed,
-		LineNum:    *lineNum,
-		Pattern:    args[0],
-		InputFile:  inputFile,
+		After:        *after,
+		Before:       *before,
+		Context:      *context,
+		Count:        *count,
+		IgnoreCase:   *ignoreCase,
+		Invert:       *invert,
+		Fixed:        *fixed,
+		LineNum:      *lineNum,
+		ByteOffset:   *byteOffset,
+		OnlyMatching: *onlyMatching,
+		JSON:         *jsonOutput,
+		Color:        *color,
+		Pattern:      args[0],
+		InputFile:    inputFile,
 	}
 }
 
 func grep(config GrepConfig) error {
 	var reader io.Reader
+	name := "(standard input)"
 	if config.InputFile != "" {
 		file, err := os.Open(config.InputFile)
 		if err != nil {
@@ -77,48 +116,56 @@ func grep(config GrepConfig) error {
 		}
 		defer file.Close()
 		reader = file
+		name = config.InputFile
 	} else {
 		reader = os.Stdin
 	}
 
-	scanner := bufio.NewScanner(reader)
-	
+	// Подготавливаем паттерн
+	pattern := config.Pattern
+	if config.IgnoreCase {
+		pattern = strings.ToLower(pattern)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	p := newPrinter(config, out, name)
+
+	// Строки читаются целиком с переводом строки, чтобы считать смещения
+	input := bufio.NewReader(reader)
+
 	// Буфер для хранения предыдущих строк (для опции -B)
-	var beforeLines []string
+	var beforeLines []Line
 	var matchCount int
 	var lineNum int
+	var offset int64
 	var afterCount int
-	
+
 	// Определяем максимальное количество строк до совпадения
 	maxBefore := config.Before
 	if config.Context > maxBefore {
 		maxBefore = config.Context
 	}
 
-	// Подготавливаем паттерн
-	pattern := config.Pattern
-	if config.IgnoreCase {
-		pattern = strings.ToLower(pattern)
-	}
-
-	for scanner.Scan() {
+	for {
+		text, err := input.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if text == "" {
+			break
+		}
 		lineNum++
-		line := scanner.Text()
-		var matches bool
-
-		if config.Fixed {
-			if config.IgnoreCase {
-				matches = strings.Contains(strings.ToLower(line), pattern)
-			} else {
-				matches = strings.Contains(line, pattern)
-			}
-		} else {
-			if config.IgnoreCase {
-				matches = strings.Contains(strings.ToLower(line), pattern)
-			} else {
-				matches = strings.Contains(line, pattern)
-			}
+		line := Line{
+			Num:    lineNum,
+			Offset: offset,
+			Text:   strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r"),
 		}
+		offset += int64(len(text))
+		// -F и без него паттерн ищется в строке как подстрока;
+		// пустой паттерн совпадает с любой строкой
+		line.Matches = findMatches(line.Text, pattern, config.IgnoreCase)
+		matches := pattern == "" || len(line.Matches) > 0
 
 		if config.Invert {
 			matches = !matches
@@ -126,37 +173,32 @@ func grep(config GrepConfig) error {
 
 		if matches {
 			matchCount++
-			
+
 			if config.Count {
 				continue
 			}
 
 			// Печатаем предыдущие строки
-			if maxBefore > 0 {
-				for i, bLine := range beforeLines {
-					if config.LineNum {
-						fmt.Printf("%d:", lineNum-len(beforeLines)+i)
-					}
-					fmt.Println(bLine)
+			for _, bLine := range beforeLines {
+				if err := p.print(bLine, false); err != nil {
+					return err
 				}
 			}
 
 			// Печатаем текущую строку
-			if config.LineNum {
-				fmt.Printf("%d:", lineNum)
+			if err := p.print(line, true); err != nil {
+				return err
 			}
-			fmt.Println(line)
-			
+
 			afterCount = config.After
 			if config.Context > afterCount {
 				afterCount = config.Context
 			}
 		} else {
 			if afterCount > 0 {
-				if config.LineNum {
-					fmt.Printf("%d:", lineNum)
+				if err := p.print(line, false); err != nil {
+					return err
 				}
-				fmt.Println(line)
 				afterCount--
 			}
 		}
@@ -170,13 +212,228 @@ func grep(config GrepConfig) error {
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
+	if config.Count {
+		if err := p.count(matchCount); err != nil {
+			return err
+		}
+	}
+
+	return out.Flush()
+}
+
+// findMatches возвращает непересекающиеся вхождения pattern в строку.
+// С ignoreCase pattern уже в нижнем регистре.
+func findMatches(text, pattern string, ignoreCase bool) []Match {
+	if pattern == "" {
+		return nil
+	}
+	var matches []Match
+	for start := 0; start < len(text); {
+		i, n := strings.Index(text[start:], pattern), len(pattern)
+		if ignoreCase {
+			i, n = indexLower(text[start:], pattern)
+		}
+		if i < 0 {
+			break
+		}
+		matches = append(matches, Match{Start: start + i, End: start + i + n})
+		start += i + n
+	}
+	return matches
+}
+
+// indexLower ищет pattern в нижнем регистре в s без учета регистра.
+// Возвращает смещение и длину вхождения в самой s: у некоторых букв
+// длина в байтах при смене регистра меняется.
+func indexLower(s, pattern string) (int, int) {
+	for i := range s {
+		j, k := i, 0
+		for k < len(pattern) && j < len(s) {
+			r, size := utf8.DecodeRuneInString(s[j:])
+			p, psize := utf8.DecodeRuneInString(pattern[k:])
+			if unicode.ToLower(r) != p {
+				break
+			}
+			j, k = j+size, k+psize
+		}
+		if k == len(pattern) {
+			return i, j - i
+		}
+	}
+	return -1, 0
+}
+
+// printer печатает строки в формате из GrepConfig
+type printer struct {
+	config GrepConfig
+	out    *bufio.Writer
+	json   *json.Encoder
+	file   string            // имя файла для JSON
+	colors map[string]string // цвета GREP_COLORS, nil - без цвета
+}
+
+func newPrinter(config GrepConfig, out *bufio.Writer, file string) *printer {
+	p := &printer{config: config, out: out, json: json.NewEncoder(out), file: file}
+	p.json.SetEscapeHTML(false)
+	if !config.JSON && useColor(config.Color) {
+		p.colors = parseGrepColors(os.Getenv("GREP_COLORS"))
+	}
+	return p
+}
+
+// print печатает выбранную строку (selected) или строку контекста
+func (p *printer) print(line Line, selected bool) error {
+	switch {
+	case p.config.JSON:
+		return p.printJSON(line, selected)
+	case p.config.OnlyMatching:
+		// как в grep: без контекста и без строк, выбранных по -v
+		if !selected || p.config.Invert {
+			return nil
+		}
+		for _, m := range line.Matches {
+			text := p.prefix(line.Num, line.Offset+int64(m.Start)) + p.paint("ms", line.Text[m.Start:m.End]) + "\n"
+			if _, err := p.out.WriteString(text); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		_, err := p.out.WriteString(p.prefix(line.Num, line.Offset) + p.highlight(line, selected) + "\n")
 		return err
 	}
+}
+
+// prefix возвращает номер строки и смещение, если они включены
+func (p *printer) prefix(num int, offset int64) string {
+	var prefix string
+	if p.config.LineNum {
+		prefix += p.paint("ln", strconv.Itoa(num)) + p.paint("se", ":")
+	}
+	if p.config.ByteOffset {
+		prefix += p.paint("bn", strconv.FormatInt(offset, 10)) + p.paint("se", ":")
+	}
+	return prefix
+}
 
-	if config.Count {
-		fmt.Println(matchCount)
+// highlight раскрашивает совпадения: ms в выбранных строках, mc в
+// строках контекста, а остальной текст - sl или cx
+func (p *printer) highlight(line Line, selected bool) string {
+	if p.colors == nil {
+		return line.Text
+	}
+	match, rest := "mc", "cx"
+	if selected {
+		match, rest = "ms", "sl"
 	}
+	var b strings.Builder
+	last := 0
+	for _, m := range line.Matches {
+		b.WriteString(p.paint(rest, line.Text[last:m.Start]))
+		b.WriteString(p.paint(match, line.Text[m.Start:m.End]))
+		last = m.End
+	}
+	b.WriteString(p.paint(rest, line.Text[last:]))
+	return b.String()
+}
+
+// paint оборачивает текст в SGR-последовательность цвета name
+func (p *printer) paint(name, text string) string {
+	code := p.colors[name]
+	if code == "" || text == "" {
+		return text
+	}
+	erase := "\x1b[K"
+	if _, ok := p.colors["ne"]; ok {
+		erase = ""
+	}
+	return "\x1b[" + code + "m" + erase + text + "\x1b[m" + erase
+}
 
-	return nil
-}
\ No newline at end of file
+// jsonLine - строка вывода --json
+type jsonLine struct {
+	Type       string      `json:"type"` // match или context
+	File       string      `json:"file"`
+	LineNumber int         `json:"line_number"`
+	ByteOffset int64       `json:"byte_offset"`
+	Line       string      `json:"line"`
+	Submatches []jsonMatch `json:"submatches"`
+}
+
+// jsonMatch - совпадение в строке, смещения в байтах от начала строки
+type jsonMatch struct {
+	Match string `json:"match"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// jsonCount - итог -c в формате --json
+type jsonCount struct {
+	Type  string `json:"type"` // count
+	File  string `json:"file"`
+	Count int    `json:"count"`
+}
+
+func (p *printer) printJSON(line Line, selected bool) error {
+	result := jsonLine{
+		Type:       "context",
+		File:       p.file,
+		LineNumber: line.Num,
+		ByteOffset: line.Offset,
+		Line:       line.Text,
+		Submatches: make([]jsonMatch, 0, len(line.Matches)),
+	}
+	if selected {
+		result.Type = "match"
+	}
+	for _, m := range line.Matches {
+		result.Submatches = append(result.Submatches, jsonMatch{Match: line.Text[m.Start:m.End], Start: m.Start, End: m.End})
+	}
+	return p.json.Encode(result)
+}
+
+// count печатает число выбранных строк для -c
+func (p *printer) count(n int) error {
+	if p.config.JSON {
+		return p.json.Encode(jsonCount{Type: "count", File: p.file, Count: n})
+	}
+	_, err := fmt.Fprintln(p.out, n)
+	return err
+}
+
+// defaultGrepColors - цвета GNU grep по умолчанию
+const defaultGrepColors = "ms=01;31:mc=01;31:sl=:cx=:fn=35:ln=32:bn=32:se=36"
+
+// parseGrepColors разбирает GREP_COLORS вида "ms=01;31:ln=32:ne" поверх
+// цветов по умолчанию. mt задает сразу ms и mc, ne отключает стирание ESC[K.
+func parseGrepColors(spec string) map[string]string {
+	colors := make(map[string]string)
+	for _, list := range []string{defaultGrepColors, spec} {
+		for _, item := range strings.Split(list, ":") {
+			name, value, _ := strings.Cut(item, "=")
+			switch name {
+			case "":
+			case "mt":
+				colors["ms"], colors["mc"] = value, value
+			default:
+				colors[name] = value
+			}
+		}
+	}
+	return colors
+}
+
+// useColor сообщает, раскрашивать ли вывод: auto - только в терминал
+func useColor(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "auto":
+		if os.Getenv("TERM") == "dumb" {
+			return false
+		}
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+	return false
+}
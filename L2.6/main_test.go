@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runGrep запускает grep на input и возвращает напечатанное в stdout
+func runGrep(t *testing.T, config GrepConfig, input string) string {
+	t.Helper()
+	dir := t.TempDir()
+	config.InputFile = filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(config.InputFile, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	err = grep(config)
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatalf("grep: %v", err)
+	}
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// имя временного файла заменяется постоянным для сравнения
+	return strings.ReplaceAll(string(data), config.InputFile, "input.txt")
+}
+
+func TestGrepOutput(t *testing.T) {
+	const input = "foo bar foo\nbaz\nFoo.x\nqux\n"
+	tests := []struct {
+		name     string
+		config   GrepConfig
+		input    string
+		expected string
+	}{
+		{"подстрока", GrepConfig{Pattern: "foo"}, input, "foo bar foo\n"},
+		{"точка - не метасимвол", GrepConfig{Pattern: "o.x"}, input, "Foo.x\n"},
+		{"-F", GrepConfig{Pattern: "o.", Fixed: true}, input, "Foo.x\n"},
+		{"-i", GrepConfig{Pattern: "FOO", IgnoreCase: true}, input, "foo bar foo\nFoo.x\n"},
+		{"-v", GrepConfig{Pattern: "foo", Invert: true, LineNum: true}, input, "2:baz\n3:Foo.x\n4:qux\n"},
+		{"-c", GrepConfig{Pattern: "o", Count: true}, input, "2\n"},
+		{"-n -b", GrepConfig{Pattern: "qux", LineNum: true, ByteOffset: true}, input, "4:22:qux\n"},
+		{"-o", GrepConfig{Pattern: "foo", OnlyMatching: true}, input, "foo\nfoo\n"},
+		{"-o -b - смещения совпадений", GrepConfig{Pattern: "foo", OnlyMatching: true, ByteOffset: true}, input, "0:foo\n8:foo\n"},
+		{"-o -i сохраняет регистр строки", GrepConfig{Pattern: "foo", OnlyMatching: true, IgnoreCase: true}, input, "foo\nfoo\nFoo\n"},
+		{"-o -v ничего не печатает", GrepConfig{Pattern: "foo", OnlyMatching: true, Invert: true}, input, ""},
+		{"-o без строк контекста", GrepConfig{Pattern: "baz", OnlyMatching: true, Context: 1}, input, "baz\n"},
+		{"-C 1", GrepConfig{Pattern: "baz", Context: 1, LineNum: true}, input, "1:foo bar foo\n2:baz\n3:Foo.x\n"},
+		{"-b с CRLF", GrepConfig{Pattern: "b", ByteOffset: true}, "a\r\nb\r\nab\r\n", "3:b\n6:ab\n"},
+		{"-o -b с CRLF", GrepConfig{Pattern: "b", OnlyMatching: true, ByteOffset: true}, "a\r\nb\r\nab\r\n", "3:b\n7:b\n"},
+	}
+	for _, test := range tests {
+		if result := runGrep(t, test.config, test.input); result != test.expected {
+			t.Errorf("%s: получили %q, ожидалось %q", test.name, result, test.expected)
+		}
+	}
+}
+
+func TestGrepJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   GrepConfig
+		input    string
+		expected string
+	}{
+		{
+			"совпадения и контекст",
+			GrepConfig{Pattern: "ab", JSON: true, After: 1},
+			"xabab\r\n<c>\nd\n",
+			`{"type":"match","file":"input.txt","line_number":1,"byte_offset":0,"line":"xabab","submatches":[{"match":"ab","start":1,"end":3},{"match":"ab","start":3,"end":5}]}` + "\n" +
+				`{"type":"context","file":"input.txt","line_number":2,"byte_offset":7,"line":"<c>","submatches":[]}` + "\n",
+		},
+		{
+			"-i",
+			GrepConfig{Pattern: "AB", JSON: true, IgnoreCase: true},
+			"aB\n",
+			`{"type":"match","file":"input.txt","line_number":1,"byte_offset":0,"line":"aB","submatches":[{"match":"aB","start":0,"end":2}]}` + "\n",
+		},
+		{
+			"-c",
+			GrepConfig{Pattern: "a", JSON: true, Count: true},
+			"a\nb\na\n",
+			`{"type":"count","file":"input.txt","count":2}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		if result := runGrep(t, test.config, test.input); result != test.expected {
+			t.Errorf("%s: получили %s, ожидалось %s", test.name, result, test.expected)
+		}
+	}
+}
+
+func TestParseGrepColors(t *testing.T) {
+	tests := []struct {
+		spec     string
+		name     string
+		expected string
+	}{
+		{"", "ms", "01;31"},
+		{"", "ln", "32"},
+		{"", "sl", ""},
+		{"mt=01;32", "ms", "01;32"},
+		{"mt=01;32", "mc", "01;32"},
+		{"ms=34:ln=33", "ln", "33"},
+		{"ms=34:ln=33", "mc", "01;31"},
+	}
+	for _, test := range tests {
+		if result := parseGrepColors(test.spec)[test.name]; result != test.expected {
+			t.Errorf("parseGrepColors(%q)[%q] = %q, ожидалось %q", test.spec, test.name, result, test.expected)
+		}
+	}
+	if _, ok := parseGrepColors("")["ne"]; ok {
+		t.Error("ne включен по умолчанию")
+	}
+	if _, ok := parseGrepColors("ms=34:ne")["ne"]; !ok {
+		t.Error("ne из GREP_COLORS не разобран")
+	}
+}
+
+func TestGrepColor(t *testing.T) {
+	const input = "a foo\nbar\n"
+	tests := []struct {
+		name     string
+		colors   string
+		config   GrepConfig
+		expected string
+	}{
+		{
+			"цвета по умолчанию",
+			"",
+			GrepConfig{Pattern: "foo", LineNum: true},
+			"\x1b[32m\x1b[K1\x1b[m\x1b[K\x1b[36m\x1b[K:\x1b[m\x1b[Ka \x1b[01;31m\x1b[Kfoo\x1b[m\x1b[K\n",
+		},
+		{
+			"mt и ne",
+			"mt=01;32:ne",
+			GrepConfig{Pattern: "foo", After: 1},
+			"a \x1b[01;32mfoo\x1b[m\nbar\n",
+		},
+		{
+			"-o -b",
+			"ms=34:bn=35:se=:ne",
+			GrepConfig{Pattern: "foo", OnlyMatching: true, ByteOffset: true},
+			"\x1b[35m2\x1b[m:\x1b[34mfoo\x1b[m\n",
+		},
+		{
+			"--json без цвета",
+			"",
+			GrepConfig{Pattern: "bar", JSON: true},
+			`{"type":"match","file":"input.txt","line_number":2,"byte_offset":6,"line":"bar","submatches":[{"match":"bar","start":0,"end":3}]}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Setenv("GREP_COLORS", test.colors)
+		test.config.Color = "always"
+		if result := runGrep(t, test.config, input); result != test.expected {
+			t.Errorf("%s: получили %q, ожидалось %q", test.name, result, test.expected)
+		}
+	}
+
+	never := GrepConfig{Pattern: "foo", Color: "never"}
+	if result := runGrep(t, never, input); result != "a foo\n" {
+		t.Errorf("--color=never: получили %q", result)
+	}
+}
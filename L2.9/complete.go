@@ -0,0 +1,126 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "shell/interp"
+)
+
+// shellCompleter возвращает дополнение для интерпретатора sh: пути
+// отсчитываются от его рабочего каталога, программы ищутся в его PATH
+func shellCompleter(sh *interp.Shell) Completer {
+    return func(line []rune, pos int) (int, []string) {
+        return completeLine(line, pos, sh.Dir(), sh.Getenv("PATH"))
+    }
+}
+
+// completeLine дополняет слово под курсором. Первое слово команды
+// (в начале строки и после |, ;, &, && и ||) дополняется именами встроенных команд и исполняемых файлов из PATH,
+// остальные слова - путями в файловой системе относительно cwd.
+// Возвращает индекс начала слова и полные варианты замены для него.
+func completeLine(line []rune, pos int, cwd, path string) (int, []string) {
+    start := pos
+    for start > 0 && !isWordBreak(line[start-1]) {
+        start--
+    }
+    word := string(line[start:pos])
+
+    before := strings.TrimSpace(string(line[:start]))
+    isCommand := before == "" || strings.ContainsAny(before[len(before)-1:], "|;&")
+    if isCommand && !strings.Contains(word, "/") {
+        return start, completeCommand(word, path)
+    }
+    return start, completePath(word, cwd)
+}
+
+func isWordBreak(r rune) bool {
+    return r == ' ' || r == '\t' || r == '|' || r == ';' || r == '&'
+}
+
+// completeCommand ищет встроенные команды и исполняемые файлы из PATH
+func completeCommand(prefix, path string) []string {
+    seen := make(map[string]bool)
+    var result []string
+    add := func(name string) {
+        if strings.HasPrefix(name, prefix) && !seen[name] {
+            seen[name] = true
+            result = append(result, name)
+        }
+    }
+
+    for _, name := range interp.BuiltinNames() {
+        add(name)
+    }
+
+    for _, dir := range filepath.SplitList(path) {
+        entries, err := os.ReadDir(dir)
+        if err != nil {
+            continue
+        }
+        for _, entry := range entries {
+            if !strings.HasPrefix(entry.Name(), prefix) {
+                continue
+            }
+            info, err := os.Stat(filepath.Join(dir, entry.Name()))
+            if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+                continue
+            }
+            add(entry.Name())
+        }
+    }
+
+    sort.Strings(result)
+    return result
+}
+
+// completePath ищет файлы и каталоги, имя которых начинается с word.
+// К каталогам добавляется "/", чтобы можно было продолжить дополнение.
+func completePath(word, cwd string) []string {
+    dir, base := filepath.Split(word)
+    searchDir := dir
+    if !filepath.IsAbs(searchDir) {
+        searchDir = filepath.Join(cwd, dir)
+    }
+
+    entries, err := os.ReadDir(searchDir)
+    if err != nil {
+        return nil
+    }
+
+    var result []string
+    for _, entry := range entries {
+        name := entry.Name()
+        if !strings.HasPrefix(name, base) {
+            continue
+        }
+        // Скрытые файлы показываем, только если их явно запросили
+        if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+            continue
+        }
+        candidate := dir + name
+        if info, err := os.Stat(filepath.Join(searchDir, name)); err == nil && info.IsDir() {
+            candidate += "/"
+        }
+        result = append(result, candidate)
+    }
+
+    sort.Strings(result)
+    return result
+}
+
+// commonPrefix возвращает общий префикс всех строк
+func commonPrefix(words []string) string {
+    if len(words) == 0 {
+        return ""
+    }
+    prefix := []rune(words[0])
+    for _, w := range words[1:] {
+        for !strings.HasPrefix(w, string(prefix)) {
+            prefix = prefix[:len(prefix)-1]
+        }
+    }
+    return string(prefix)
+}
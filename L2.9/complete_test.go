@@ -0,0 +1,83 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "slices"
+    "testing"
+)
+
+func TestCompleteLine(t *testing.T) {
+    bin, cwd := t.TempDir(), t.TempDir()
+    for name, mode := range map[string]os.FileMode{"mycmd": 0755, "mytool": 0755, "mydata": 0644} {
+        if err := os.WriteFile(filepath.Join(bin, name), nil, mode); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for _, name := range []string{"myfile", "notes.txt", ".hidden"} {
+        if err := os.WriteFile(filepath.Join(cwd, name), nil, 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := os.Mkdir(filepath.Join(cwd, "node"), 0755); err != nil {
+        t.Fatal(err)
+    }
+
+    commands := []string{"mycmd", "mytool"}
+    tests := []struct {
+        line     string
+        pos      int // -1 - конец строки
+        start    int
+        expected []string
+    }{
+        // позиция команды
+        {"my", -1, 0, commands},
+        {"  my", -1, 2, commands},
+        {"ls | my", -1, 5, commands},
+        {"ls|my", -1, 3, commands},
+        {"true; my", -1, 6, commands},
+        {"true;my", -1, 5, commands},
+        {"true && my", -1, 8, commands},
+        {"false || my", -1, 9, commands},
+        {"sleep 1 & my", -1, 10, commands},
+        {"my echo", 2, 0, commands},
+        {"ex", -1, 0, []string{"exit", "export"}},
+        // аргументы - пути
+        {"echo my", -1, 5, []string{"myfile"}},
+        {"ls; echo no", -1, 9, []string{"node/", "notes.txt"}},
+        {"echo ", -1, 5, []string{"myfile", "node/", "notes.txt"}},
+        {"echo .h", -1, 5, []string{".hidden"}},
+        {"./my", -1, 0, []string{"./myfile"}},
+        {"cat " + cwd + "/no", -1, 4, []string{cwd + "/node/", cwd + "/notes.txt"}},
+        {"echo missing/", -1, 5, nil},
+    }
+    for _, test := range tests {
+        line := []rune(test.line)
+        pos := test.pos
+        if pos < 0 {
+            pos = len(line)
+        }
+        start, result := completeLine(line, pos, cwd, bin)
+        if start != test.start || !slices.Equal(result, test.expected) {
+            t.Errorf("%q: получили (%d, %q), ожидали (%d, %q)", test.line, start, result, test.start, test.expected)
+        }
+    }
+}
+
+func TestCommonPrefix(t *testing.T) {
+    tests := []struct {
+        words    []string
+        expected string
+    }{
+        {nil, ""},
+        {[]string{"abc"}, "abc"},
+        {[]string{"abc", "abd", "ab"}, "ab"},
+        {[]string{"abc", "xyz"}, ""},
+        {[]string{"привет", "приход"}, "при"},
+    }
+    for _, test := range tests {
+        if result := commonPrefix(test.words); result != test.expected {
+            t.Errorf("commonPrefix(%q) = %q, ожидали %q", test.words, result, test.expected)
+        }
+    }
+}
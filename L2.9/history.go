@@ -0,0 +1,129 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// History - история введенных команд, сохраняемая в файл между сессиями
+type History struct {
+    entries []string
+    path    string
+    max     int
+}
+
+// historyPath возвращает путь к файлу истории: $HISTFILE или ~/.shell_history
+func historyPath() string {
+    if path := os.Getenv("HISTFILE"); path != "" {
+        return path
+    }
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return ""
+    }
+    return filepath.Join(home, ".shell_history")
+}
+
+// LoadHistory читает историю из файла, оставляя не более max последних записей.
+// Даже при ошибке чтения возвращает пригодную к использованию историю.
+func LoadHistory(path string, max int) (*History, error) {
+    h := &History{path: path, max: max}
+    if path == "" {
+        return h, nil
+    }
+
+    file, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return h, nil
+    }
+    if err != nil {
+        return h, fmt.Errorf("история: %v", err)
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        if line := scanner.Text(); line != "" {
+            h.entries = append(h.entries, line)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return h, fmt.Errorf("история: %v", err)
+    }
+
+    // Файл разросся - обрезаем его до max записей
+    if len(h.entries) > max {
+        h.entries = h.entries[len(h.entries)-max:]
+        if err := h.rewrite(); err != nil {
+            return h, err
+        }
+    }
+    return h, nil
+}
+
+// Len возвращает количество записей
+func (h *History) Len() int {
+    return len(h.entries)
+}
+
+// Get возвращает запись по индексу, 0 - самая старая
+func (h *History) Get(i int) string {
+    return h.entries[i]
+}
+
+// Add добавляет строку в историю и дописывает ее в файл.
+// Пустые строки и повтор предыдущей команды не сохраняются.
+func (h *History) Add(line string) error {
+    line = strings.TrimSpace(line)
+    if line == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == line) {
+        return nil
+    }
+
+    h.entries = append(h.entries, line)
+    if len(h.entries) > h.max {
+        h.entries = h.entries[1:]
+    }
+    if h.path == "" {
+        return nil
+    }
+
+    file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+    if err != nil {
+        return fmt.Errorf("история: %v", err)
+    }
+    defer file.Close()
+    if _, err := fmt.Fprintln(file, line); err != nil {
+        return fmt.Errorf("история: %v", err)
+    }
+    return nil
+}
+
+// Search ищет запись, содержащую query, двигаясь от индекса from к началу.
+// Возвращает -1, если ничего не найдено.
+func (h *History) Search(query string, from int) int {
+    if from >= len(h.entries) {
+        from = len(h.entries) - 1
+    }
+    for i := from; i >= 0; i-- {
+        if strings.Contains(h.entries[i], query) {
+            return i
+        }
+    }
+    return -1
+}
+
+// rewrite перезаписывает файл истории текущими записями
+func (h *History) rewrite() error {
+    tmp := h.path + ".tmp"
+    data := strings.Join(h.entries, "\n") + "\n"
+    if err := os.WriteFile(tmp, []byte(data), 0600); err != nil {
+        return fmt.Errorf("история: %v", err)
+    }
+    if err := os.Rename(tmp, h.path); err != nil {
+        return fmt.Errorf("история: %v", err)
+    }
+    return nil
+}
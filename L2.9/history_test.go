@@ -0,0 +1,105 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "slices"
+    "testing"
+)
+
+// entries возвращает все записи истории
+func entries(h *History) []string {
+    var result []string
+    for i := 0; i < h.Len(); i++ {
+        result = append(result, h.Get(i))
+    }
+    return result
+}
+
+func TestLoadHistory(t *testing.T) {
+    dir := t.TempDir()
+    tests := []struct {
+        name     string
+        data     string // "" - файла нет
+        max      int
+        expected []string
+        file     string // содержимое файла после загрузки
+    }{
+        {"нет файла", "", 10, nil, ""},
+        {"пустые строки пропускаются", "ls\n\npwd\n", 10, []string{"ls", "pwd"}, "ls\n\npwd\n"},
+        {"лишние записи обрезаются", "a\nb\nc\nd\n", 2, []string{"c", "d"}, "c\nd\n"},
+    }
+    for _, test := range tests {
+        path := filepath.Join(dir, test.name)
+        if test.data != "" {
+            if err := os.WriteFile(path, []byte(test.data), 0600); err != nil {
+                t.Fatal(err)
+            }
+        }
+        h, err := LoadHistory(path, test.max)
+        if err != nil {
+            t.Errorf("%s: %v", test.name, err)
+            continue
+        }
+        if result := entries(h); !slices.Equal(result, test.expected) {
+            t.Errorf("%s: записи %q, ожидали %q", test.name, result, test.expected)
+        }
+        if data, _ := os.ReadFile(path); string(data) != test.file {
+            t.Errorf("%s: файл %q, ожидали %q", test.name, data, test.file)
+        }
+    }
+}
+
+func TestHistoryAdd(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "history")
+    h, err := LoadHistory(path, 3)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, line := range []string{"ls", "ls", "  ls  ", "", "   ", "pwd", "ls", "cd /", "echo"} {
+        if err := h.Add(line); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // повтор предыдущей команды и пустые строки не сохраняются,
+    // в памяти остаются max последних записей
+    if result := entries(h); !slices.Equal(result, []string{"ls", "cd /", "echo"}) {
+        t.Errorf("записи %q", result)
+    }
+    if data, _ := os.ReadFile(path); string(data) != "ls\npwd\nls\ncd /\necho\n" {
+        t.Errorf("файл %q", data)
+    }
+    // при следующем запуске файл обрезается до max
+    h, err = LoadHistory(path, 3)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result := entries(h); !slices.Equal(result, []string{"ls", "cd /", "echo"}) {
+        t.Errorf("после загрузки записи %q", result)
+    }
+}
+
+func TestHistorySearch(t *testing.T) {
+    h := &History{max: 10}
+    for _, line := range []string{"git status", "ls -l", "git commit", "pwd"} {
+        h.Add(line)
+    }
+    tests := []struct {
+        query    string
+        from     int
+        expected int
+    }{
+        {"git", 3, 2},
+        {"git", 1, 0},
+        {"git", 100, 2},
+        {"ls", 0, -1},
+        {"", 3, 3},
+        {"missing", 3, -1},
+        {"pwd", -1, -1},
+    }
+    for _, test := range tests {
+        if result := h.Search(test.query, test.from); result != test.expected {
+            t.Errorf("Search(%q, %d) = %d, ожидали %d", test.query, test.from, result, test.expected)
+        }
+    }
+}
@@ -0,0 +1,524 @@
+package interp
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+    "syscall"
+)
+
+// Stdio - потоки ввода-вывода, с которыми запускается команда
+type Stdio struct {
+    Stdin  io.Reader
+    Stdout io.Writer
+    Stderr io.Writer
+}
+
+// Builtin - встроенная команда, выполняемая внутри процесса шелла.
+// Работает только через переданные ей потоки, поэтому может стоять
+// в любом месте конвейера.
+type Builtin interface {
+    Run(sh *Shell, args []string, stdio Stdio) error
+}
+
+// BuiltinFunc позволяет использовать обычную функцию как Builtin
+type BuiltinFunc func(sh *Shell, args []string, stdio Stdio) error
+
+func (f BuiltinFunc) Run(sh *Shell, args []string, stdio Stdio) error {
+    return f(sh, args, stdio)
+}
+
+// ExitStatus - ошибка, которая передает только код завершения,
+// без сообщения (как у false или exit 3)
+type ExitStatus int
+
+func (e ExitStatus) Error() string {
+    return fmt.Sprintf("exit status %d", int(e))
+}
+
+var builtins map[string]Builtin
+
+func init() {
+    builtins = map[string]Builtin{
+        "cd":       BuiltinFunc(builtinCd),
+        "pwd":      BuiltinFunc(builtinPwd),
+        "echo":     BuiltinFunc(builtinEcho),
+        "kill":     BuiltinFunc(builtinKill),
+        "jobs":     BuiltinFunc(builtinJobs),
+        "fg":       BuiltinFunc(builtinFg),
+        "bg":       BuiltinFunc(builtinBg),
+        "ps":       BuiltinFunc(builtinPs),
+        "top":      BuiltinFunc(builtinTop),
+        "exit":     BuiltinFunc(builtinExit),
+        "return":   BuiltinFunc(builtinReturn),
+        "break":    BuiltinFunc(builtinBreak),
+        "continue": BuiltinFunc(builtinBreak),
+        "export":   BuiltinFunc(builtinExport),
+        "true":     BuiltinFunc(builtinTrue),
+        ":":        BuiltinFunc(builtinTrue),
+        "false":    BuiltinFunc(builtinFalse),
+        "alias":    BuiltinFunc(builtinAlias),
+        "unalias":  BuiltinFunc(builtinUnalias),
+        "shopt":    BuiltinFunc(builtinShopt),
+        "set":      BuiltinFunc(builtinSet),
+        "source":   BuiltinFunc(builtinSource),
+        ".":        BuiltinFunc(builtinSource),
+    }
+}
+
+// BuiltinNames возвращает имена встроенных команд
+func BuiltinNames() []string {
+    names := make([]string, 0, len(builtins))
+    for name := range builtins {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// lookupBuiltin возвращает встроенную команду по имени
+func lookupBuiltin(name string) (Builtin, bool) {
+    b, ok := builtins[name]
+    return b, ok
+}
+
+// builtinCd меняет рабочий каталог интерпретатора, а не процесса:
+// cd [каталог | -]
+func builtinCd(sh *Shell, args []string, stdio Stdio) error {
+    dir := sh.lookupVar("HOME")
+    if len(args) >= 2 {
+        dir = args[1]
+    }
+    if dir == "-" {
+        if dir = sh.lookupVar("OLDPWD"); dir == "" {
+            return fmt.Errorf("cd: OLDPWD не задан")
+        }
+        fmt.Fprintln(stdio.Stdout, dir)
+    }
+    if dir == "" {
+        return fmt.Errorf("cd: HOME не задан")
+    }
+
+    target := filepath.Clean(sh.path(dir))
+    info, err := os.Stat(target)
+    if err != nil {
+        return fmt.Errorf("cd: %v", err)
+    }
+    if !info.IsDir() {
+        return fmt.Errorf("cd: %s: это не каталог", dir)
+    }
+    sh.env["OLDPWD"] = sh.dir
+    sh.env["PWD"] = target
+    sh.dir = target
+    return nil
+}
+
+func builtinPwd(sh *Shell, args []string, stdio Stdio) error {
+    _, err := fmt.Fprintln(stdio.Stdout, sh.dir)
+    return err
+}
+
+func builtinEcho(sh *Shell, args []string, stdio Stdio) error {
+    _, err := fmt.Fprintln(stdio.Stdout, strings.Join(args[1:], " "))
+    return err
+}
+
+// builtinKill посылает сигнал процессам и заданиям:
+// kill [-s СИГНАЛ | -СИГНАЛ] pid|%задание ..., kill -l
+func builtinKill(sh *Shell, args []string, stdio Stdio) error {
+    sig := syscall.SIGTERM
+    args = args[1:]
+    if len(args) > 0 {
+        switch {
+        case args[0] == "-l" || args[0] == "-L":
+            _, err := fmt.Fprintln(stdio.Stdout, strings.Join(signalList(), "\n"))
+            return err
+        case args[0] == "-s" || args[0] == "-n":
+            if len(args) < 2 {
+                return fmt.Errorf("kill: %s: требуется аргумент", args[0])
+            }
+            parsed, err := parseSignal(args[1])
+            if err != nil {
+                return fmt.Errorf("kill: %v", err)
+            }
+            sig, args = parsed, args[2:]
+        case args[0] == "--":
+            args = args[1:]
+        case strings.HasPrefix(args[0], "-"):
+            parsed, err := parseSignal(args[0][1:])
+            if err != nil {
+                return fmt.Errorf("kill: %v", err)
+            }
+            sig, args = parsed, args[1:]
+        }
+    }
+    if len(args) == 0 {
+        return fmt.Errorf("kill: использование: kill [-s сигнал | -сигнал] pid | %%задание ...")
+    }
+
+    var failed bool
+    for _, target := range args {
+        if err := sh.signalTarget(target, sig); err != nil {
+            fmt.Fprintf(stdio.Stderr, "kill: %v\n", err)
+            failed = true
+        }
+    }
+    if failed {
+        return ExitStatus(1)
+    }
+    return nil
+}
+
+// signalTarget посылает сигнал процессу по PID или группе процессов задания
+func (sh *Shell) signalTarget(target string, sig syscall.Signal) error {
+    if !strings.HasPrefix(target, "%") {
+        pid, err := strconv.Atoi(target)
+        if err != nil {
+            return fmt.Errorf("%s: аргументы должны быть PID или заданиями", target)
+        }
+        return syscall.Kill(pid, sig)
+    }
+
+    job, err := sh.jobs.find(target)
+    if err != nil {
+        return err
+    }
+    if sig == syscall.SIGCONT {
+        return job.resume(false)
+    }
+    if err := job.signal(sig); err != nil {
+        return err
+    }
+    // Остановленное задание не обработает сигнал, пока его не продолжить
+    if job.State() == JobStopped && sig != syscall.SIGSTOP && sig != syscall.SIGTSTP {
+        return job.resume(false)
+    }
+    return nil
+}
+
+// jobArg возвращает задание из аргумента fg/bg или текущее задание
+func (sh *Shell) jobArg(args []string) (*Job, error) {
+    spec := "%+"
+    if len(args) > 1 {
+        spec = args[1]
+    }
+    job, err := sh.jobs.find(spec)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", args[0], err)
+    }
+    return job, nil
+}
+
+func builtinJobs(sh *Shell, args []string, stdio Stdio) error {
+    long := len(args) > 1 && args[1] == "-l"
+    for _, job := range sh.jobs.list() {
+        line := sh.jobs.format(job)
+        if long {
+            line = fmt.Sprintf("%s  (pgid %d)", line, job.Pgid())
+        }
+        fmt.Fprintln(stdio.Stdout, line)
+    }
+    return nil
+}
+
+// builtinFg продолжает задание на переднем плане и ждет его
+func builtinFg(sh *Shell, args []string, stdio Stdio) error {
+    job, err := sh.jobArg(args)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintln(stdio.Stdout, job.Command)
+    if err := job.resume(true); err != nil {
+        return fmt.Errorf("fg: %v", err)
+    }
+    if status := sh.waitForeground(job, stdio); status != 0 {
+        return ExitStatus(status)
+    }
+    return nil
+}
+
+// builtinBg продолжает остановленное задание в фоне
+func builtinBg(sh *Shell, args []string, stdio Stdio) error {
+    job, err := sh.jobArg(args)
+    if err != nil {
+        return err
+    }
+    if err := job.resume(false); err != nil {
+        return fmt.Errorf("bg: %v", err)
+    }
+    fmt.Fprintf(stdio.Stdout, "[%d] %s &\n", job.ID, job.Command)
+    return nil
+}
+
+// statusArg разбирает необязательный числовой аргумент exit и return
+func statusArg(sh *Shell, args []string) (int, error) {
+    if len(args) < 2 {
+        return sh.status, nil
+    }
+    code, err := strconv.Atoi(args[1])
+    if err != nil {
+        return 2, fmt.Errorf("%s: %s: требуется числовой аргумент", args[0], args[1])
+    }
+    return code & 0xff, nil
+}
+
+func builtinExit(sh *Shell, args []string, stdio Stdio) error {
+    code, err := statusArg(sh, args)
+    if err != nil {
+        fmt.Fprintln(stdio.Stderr, err)
+    }
+    sh.flow = flowExit
+    sh.exitCode = code
+    return ExitStatus(code)
+}
+
+func builtinReturn(sh *Shell, args []string, stdio Stdio) error {
+    if sh.funcDepth == 0 {
+        return fmt.Errorf("return: можно использовать только в функции")
+    }
+    code, err := statusArg(sh, args)
+    if err != nil {
+        fmt.Fprintln(stdio.Stderr, err)
+    }
+    sh.flow = flowReturn
+    return ExitStatus(code)
+}
+
+// builtinBreak реализует break [N] и continue [N]
+func builtinBreak(sh *Shell, args []string, stdio Stdio) error {
+    if sh.loops == 0 {
+        return fmt.Errorf("%s: имеет смысл только внутри цикла for или while", args[0])
+    }
+    n := 1
+    if len(args) > 1 {
+        var err error
+        if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+            return fmt.Errorf("%s: %s: неверное число циклов", args[0], args[1])
+        }
+    }
+    if n > sh.loops {
+        n = sh.loops
+    }
+
+    sh.flow = flowBreak
+    if args[0] == "continue" {
+        sh.flow = flowContinue
+    }
+    sh.flowDepth = n
+    return nil
+}
+
+// builtinExport переносит переменные шелла в окружение дочерних процессов
+func builtinExport(sh *Shell, args []string, stdio Stdio) error {
+    for _, arg := range args[1:] {
+        name, value, hasValue := strings.Cut(arg, "=")
+        if !isName(name) {
+            return fmt.Errorf("export: `%s': неверный идентификатор", arg)
+        }
+        if !hasValue {
+            value = sh.lookupVar(name)
+        }
+        delete(sh.vars, name)
+        sh.env[name] = value
+    }
+    return nil
+}
+
+func builtinTrue(sh *Shell, args []string, stdio Stdio) error {
+    return nil
+}
+
+func builtinFalse(sh *Shell, args []string, stdio Stdio) error {
+    return ExitStatus(1)
+}
+
+// builtinAlias выводит или задает псевдонимы: alias [имя[=значение] ...]
+func builtinAlias(sh *Shell, args []string, stdio Stdio) error {
+    if len(args) == 1 {
+        names := make([]string, 0, len(sh.aliases))
+        for name := range sh.aliases {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        for _, name := range names {
+            fmt.Fprintf(stdio.Stdout, "alias %s=%s\n", name, shellQuote(sh.aliases[name]))
+        }
+        return nil
+    }
+
+    var failed bool
+    for _, arg := range args[1:] {
+        name, value, hasValue := strings.Cut(arg, "=")
+        if !hasValue {
+            if value, ok := sh.aliases[name]; ok {
+                fmt.Fprintf(stdio.Stdout, "alias %s=%s\n", name, shellQuote(value))
+            } else {
+                fmt.Fprintf(stdio.Stderr, "alias: %s: не найден\n", name)
+                failed = true
+            }
+            continue
+        }
+        if name == "" || strings.ContainsAny(name, " \t\n/$`'\"=|&;()<>") {
+            fmt.Fprintf(stdio.Stderr, "alias: `%s': неверное имя псевдонима\n", name)
+            failed = true
+            continue
+        }
+        sh.aliases[name] = value
+    }
+    if failed {
+        return ExitStatus(1)
+    }
+    return nil
+}
+
+// builtinUnalias удаляет псевдонимы: unalias [-a] имя ...
+func builtinUnalias(sh *Shell, args []string, stdio Stdio) error {
+    if len(args) == 1 {
+        return fmt.Errorf("unalias: использование: unalias [-a] имя ...")
+    }
+    if args[1] == "-a" {
+        for name := range sh.aliases {
+            delete(sh.aliases, name)
+        }
+        return nil
+    }
+    var failed bool
+    for _, name := range args[1:] {
+        if _, ok := sh.aliases[name]; !ok {
+            fmt.Fprintf(stdio.Stderr, "unalias: %s: не найден\n", name)
+            failed = true
+            continue
+        }
+        delete(sh.aliases, name)
+    }
+    if failed {
+        return ExitStatus(1)
+    }
+    return nil
+}
+
+// shellQuote заключает строку в одинарные кавычки так, чтобы ее можно
+// было снова ввести в шелл
+func shellQuote(s string) string {
+    return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellOptions - параметры, которые переключает shopt
+var shellOptions = []string{"dotglob", "failglob", "nullglob"}
+
+// builtinShopt включает и выключает параметры: shopt [-s|-u] [параметр ...]
+func builtinShopt(sh *Shell, args []string, stdio Stdio) error {
+    args = args[1:]
+    set, unset := false, false
+    if len(args) > 0 && (args[0] == "-s" || args[0] == "-u") {
+        set, unset = args[0] == "-s", args[0] == "-u"
+        args = args[1:]
+    }
+    for _, name := range args {
+        if !slices.Contains(shellOptions, name) {
+            return fmt.Errorf("shopt: %s: неверное имя параметра", name)
+        }
+    }
+
+    names := args
+    if len(names) == 0 {
+        names = shellOptions
+    }
+    for _, name := range names {
+        switch {
+        case set:
+            sh.options[name] = true
+        case unset:
+            delete(sh.options, name)
+        case len(args) > 0 || !set && !unset:
+            state := "off"
+            if sh.options[name] {
+                state = "on"
+            }
+            fmt.Fprintf(stdio.Stdout, "%-15s\t%s\n", name, state)
+        }
+    }
+    // shopt имя возвращает 1, если параметр выключен
+    if !set && !unset && len(args) > 0 {
+        for _, name := range args {
+            if !sh.options[name] {
+                return ExitStatus(1)
+            }
+        }
+    }
+    return nil
+}
+
+// setOptions - параметры, которые переключает set -o
+var setOptions = []string{"pipefail"}
+
+// builtinSet переключает параметры шелла и задает позиционные параметры:
+// set -o|+o [параметр], set [--] аргументы ...
+func builtinSet(sh *Shell, args []string, stdio Stdio) error {
+    args = args[1:]
+    for len(args) > 0 {
+        switch args[0] {
+        case "-o", "+o":
+            enable := args[0] == "-o"
+            if len(args) == 1 {
+                for _, name := range setOptions {
+                    if enable {
+                        state := "off"
+                        if sh.options[name] {
+                            state = "on"
+                        }
+                        fmt.Fprintf(stdio.Stdout, "%-15s\t%s\n", name, state)
+                    } else if sh.options[name] {
+                        fmt.Fprintf(stdio.Stdout, "set -o %s\n", name)
+                    } else {
+                        fmt.Fprintf(stdio.Stdout, "set +o %s\n", name)
+                    }
+                }
+                return nil
+            }
+            if !slices.Contains(setOptions, args[1]) {
+                return fmt.Errorf("set: %s: неверное имя параметра", args[1])
+            }
+            if enable {
+                sh.options[args[1]] = true
+            } else {
+                delete(sh.options, args[1])
+            }
+            args = args[2:]
+        case "--":
+            sh.params = args[1:]
+            return nil
+        default:
+            if strings.HasPrefix(args[0], "-") || strings.HasPrefix(args[0], "+") {
+                return fmt.Errorf("set: %s: неверный параметр", args[0])
+            }
+            sh.params = args
+            return nil
+        }
+    }
+    return nil
+}
+
+// builtinSource выполняет файл в текущем шелле: source файл [аргументы]
+func builtinSource(sh *Shell, args []string, stdio Stdio) error {
+    if len(args) < 2 {
+        return fmt.Errorf("%s: требуется имя файла", args[0])
+    }
+    if len(args) > 2 {
+        saved := sh.params
+        sh.params = args[2:]
+        defer func() { sh.params = saved }()
+    }
+    if err := sh.source(args[1], stdio); err != nil {
+        return fmt.Errorf("%s: %v", args[0], err)
+    }
+    if sh.status != 0 {
+        return ExitStatus(sh.status)
+    }
+    return nil
+}
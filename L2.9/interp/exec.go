@@ -0,0 +1,711 @@
+package interp
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "syscall"
+)
+
+// flow - нелокальный переход, запрошенный break, continue, return или exit
+type flow int
+
+const (
+    flowNone flow = iota
+    flowBreak
+    flowContinue
+    flowReturn
+    flowExit
+    flowInterrupt // командная строка прервана по Ctrl+C
+)
+
+// Shell - состояние интерпретатора: переменные, функции, параметры
+// и код завершения последней команды
+type Shell struct {
+    name       string   // $0
+    params     []string // $1, $2, ...
+    vars       map[string]string
+    funcs      map[string]*FuncDef
+    status     int
+    flow       flow
+    flowDepth  int // на сколько циклов действует break/continue
+    loops      int // вложенность выполняемых циклов
+    funcDepth  int // вложенность вызовов функций
+    exitCode   int
+    jobs       *jobTable
+    job        *Job // задание, в которое входят запускаемые процессы; nil - каждый конвейер становится своим заданием
+    lastBg     *Job // последнее фоновое задание, для $!
+    aliases    map[string]string
+    options    map[string]bool // shopt: nullglob, failglob, dotglob; set -o: pipefail
+    pipeStatus []int           // коды звеньев последнего конвейера, для PIPESTATUS
+    env        map[string]string // экспортированные переменные, передаются программам
+    dir        string            // рабочий каталог; процесс шелла его не меняет
+    executor   Executor
+    stdio      Stdio
+}
+
+// Config - настройки интерпретатора. Незаданные поля берутся
+// из процесса: os.Args[0], os.Environ(), текущий каталог, os.Stdin...
+type Config struct {
+    Name     string   // $0
+    Args     []string // $1, $2, ...
+    Env      []string // окружение в виде NAME=value
+    Dir      string   // рабочий каталог
+    Stdin    io.Reader
+    Stdout   io.Writer
+    Stderr   io.Writer
+    Executor Executor // по умолчанию RealExecutor
+}
+
+// New создает интерпретатор. Несколько интерпретаторов в одном
+// процессе независимы: у каждого свои переменные, окружение,
+// рабочий каталог и потоки.
+func New(cfg Config) *Shell {
+    sh := newShell(cfg.Name, cfg.Args)
+    if sh.name == "" && len(os.Args) > 0 {
+        sh.name = os.Args[0]
+    }
+
+    env := cfg.Env
+    if env == nil {
+        env = os.Environ()
+    }
+    for _, kv := range env {
+        if name, value, ok := strings.Cut(kv, "="); ok {
+            sh.env[name] = value
+        }
+    }
+
+    sh.dir = cfg.Dir
+    if sh.dir == "" {
+        sh.dir, _ = os.Getwd()
+    } else if abs, err := filepath.Abs(sh.dir); err == nil {
+        sh.dir = abs
+    }
+
+    sh.stdio = Stdio{Stdin: cfg.Stdin, Stdout: cfg.Stdout, Stderr: cfg.Stderr}
+    if sh.stdio.Stdin == nil {
+        sh.stdio.Stdin = os.Stdin
+    }
+    if sh.stdio.Stdout == nil {
+        sh.stdio.Stdout = os.Stdout
+    }
+    if sh.stdio.Stderr == nil {
+        sh.stdio.Stderr = os.Stderr
+    }
+
+    sh.executor = cfg.Executor
+    if sh.executor == nil {
+        sh.executor = RealExecutor{}
+    }
+    return sh
+}
+
+func newShell(name string, params []string) *Shell {
+    return &Shell{
+        name:    name,
+        params:  params,
+        vars:    make(map[string]string),
+        funcs:   make(map[string]*FuncDef),
+        jobs:    newJobTable(),
+        aliases: make(map[string]string),
+        options: make(map[string]bool),
+        env:     make(map[string]string),
+    }
+}
+
+// Dir возвращает рабочий каталог интерпретатора
+func (sh *Shell) Dir() string {
+    return sh.dir
+}
+
+// Getenv возвращает значение переменной шелла или окружения
+func (sh *Shell) Getenv(name string) string {
+    return sh.lookupVar(name)
+}
+
+// Environ возвращает окружение, которое получат запускаемые программы
+func (sh *Shell) Environ() []string {
+    env := make([]string, 0, len(sh.env))
+    for name, value := range sh.env {
+        env = append(env, name+"="+value)
+    }
+    sort.Strings(env)
+    return env
+}
+
+// path разрешает путь относительно рабочего каталога интерпретатора
+func (sh *Shell) path(name string) string {
+    if filepath.IsAbs(name) {
+        return name
+    }
+    return filepath.Join(sh.dir, name)
+}
+
+// EnableJobControl включает управление заданиями и обработку сигналов
+// для интерактивной работы на терминале tty
+func (sh *Shell) EnableJobControl(tty int) {
+    sh.jobs.enableControl(tty)
+}
+
+// subshell возвращает копию шелла для выполнения звена конвейера:
+// изменения переменных внутри звена не видны снаружи
+func (sh *Shell) subshell() *Shell {
+    sub := newShell(sh.name, sh.params)
+    for k, v := range sh.vars {
+        sub.vars[k] = v
+    }
+    for k, v := range sh.funcs {
+        sub.funcs[k] = v
+    }
+    for k, v := range sh.aliases {
+        sub.aliases[k] = v
+    }
+    for k, v := range sh.options {
+        sub.options[k] = v
+    }
+    for k, v := range sh.env {
+        sub.env[k] = v
+    }
+    sub.dir = sh.dir
+    sub.executor = sh.executor
+    sub.stdio = sh.stdio
+    sub.status = sh.status
+    sub.jobs = sh.jobs
+    sub.job = sh.job
+    sub.lastBg = sh.lastBg
+    return sub
+}
+
+// Exited сообщает, что была выполнена команда exit, и возвращает ее код
+func (sh *Shell) Exited() (int, bool) {
+    return sh.exitCode, sh.flow == flowExit
+}
+
+// Run разбирает и выполняет текст команд на потоках интерпретатора.
+// Возвращает код завершения (после exit - его код) или синтаксическую
+// ошибку; незавершенный текст тоже считается ошибкой.
+func (sh *Shell) Run(src string) (int, error) {
+    list, err := Parse(src, sh.aliases)
+    if err == errIncomplete {
+        err = fmt.Errorf("синтаксическая ошибка: неожиданный конец файла")
+    }
+    if err != nil {
+        sh.status = 2
+        return sh.status, err
+    }
+    sh.runList(list, sh.stdio)
+    if code, exited := sh.Exited(); exited {
+        return code, nil
+    }
+    if sh.flow == flowInterrupt {
+        sh.flow = flowNone
+    }
+    return sh.status, nil
+}
+
+func (sh *Shell) runList(list List, stdio Stdio) int {
+    for _, item := range list {
+        if sh.jobs.interrupted.Swap(false) {
+            sh.flow = flowInterrupt
+        }
+        if sh.flow != flowNone {
+            break
+        }
+        if item.Background {
+            sh.runBackground(item, stdio)
+            sh.status = 0
+            continue
+        }
+        sh.runAndOr(item, stdio)
+    }
+    return sh.status
+}
+
+func (sh *Shell) runAndOr(item *AndOr, stdio Stdio) int {
+    status := sh.runPipeline(item.First, stdio)
+    for _, part := range item.Rest {
+        if sh.flow != flowNone {
+            break
+        }
+        if (part.Op == "&&") == (status == 0) {
+            status = sh.runPipeline(part.Pipeline, stdio)
+        }
+    }
+    return status
+}
+
+func (sh *Shell) runPipeline(p *Pipeline, stdio Stdio) int {
+    var status int
+    if len(p.Commands) == 1 {
+        status = sh.runCommand(p.Commands[0], stdio)
+        sh.pipeStatus = []int{status}
+    } else {
+        status = sh.runStages(p, stdio)
+    }
+    if p.Negate {
+        if status == 0 {
+            status = 1
+        } else {
+            status = 0
+        }
+    }
+    sh.status = status
+    return status
+}
+
+func (sh *Shell) runCommand(cmd Command, stdio Stdio) int {
+    switch c := cmd.(type) {
+    case *SimpleCommand:
+        args, err := sh.expandWords(c.Args)
+        if err != nil {
+            fmt.Fprintln(stdio.Stderr, err)
+            return 1
+        }
+        return sh.runArgs(args, c.Assigns, stdio)
+    case *IfClause:
+        return sh.runIf(c, stdio)
+    case *WhileClause:
+        return sh.runWhile(c, stdio)
+    case *ForClause:
+        return sh.runFor(c, stdio)
+    case *BraceGroup:
+        return sh.runList(c.Body, stdio)
+    case *FuncDef:
+        sh.funcs[c.Name] = c
+        return 0
+    }
+    return 0
+}
+
+func (sh *Shell) runIf(c *IfClause, stdio Stdio) int {
+    cond := sh.runList(c.Cond, stdio)
+    if sh.flow != flowNone {
+        return cond
+    }
+    if cond == 0 {
+        return sh.runList(c.Then, stdio)
+    }
+    if c.Else != nil {
+        return sh.runList(c.Else, stdio)
+    }
+    return 0
+}
+
+func (sh *Shell) runWhile(c *WhileClause, stdio Stdio) int {
+    sh.loops++
+    defer func() { sh.loops-- }()
+
+    status := 0
+    for {
+        cond := sh.runList(c.Cond, stdio)
+        if sh.loopFlow() {
+            break
+        }
+        if cond != 0 {
+            break
+        }
+        status = sh.runList(c.Body, stdio)
+        if sh.loopFlow() {
+            break
+        }
+    }
+    return status
+}
+
+func (sh *Shell) runFor(c *ForClause, stdio Stdio) int {
+    sh.loops++
+    defer func() { sh.loops-- }()
+
+    items := sh.params
+    if c.InSet {
+        var err error
+        if items, err = sh.expandWords(c.Items); err != nil {
+            fmt.Fprintln(stdio.Stderr, err)
+            return 1
+        }
+    }
+
+    status := 0
+    for _, item := range items {
+        sh.setVar(c.Var, item)
+        status = sh.runList(c.Body, stdio)
+        if sh.loopFlow() {
+            break
+        }
+    }
+    return status
+}
+
+// loopFlow обрабатывает break и continue на текущем уровне цикла.
+// Возвращает true, если цикл нужно прервать.
+func (sh *Shell) loopFlow() bool {
+    switch sh.flow {
+    case flowNone:
+        return false
+    case flowBreak, flowContinue:
+        // break N / continue N передаются во внешние циклы
+        if sh.flowDepth > 1 {
+            sh.flowDepth--
+            return true
+        }
+        stop := sh.flow == flowBreak
+        sh.flow = flowNone
+        return stop
+    }
+    return true
+}
+
+// runArgs выполняет простую команду с уже раскрытыми аргументами:
+// функцию, встроенную команду или внешнюю программу
+func (sh *Shell) runArgs(args []string, assigns []Assign, stdio Stdio) int {
+    // фоновое задание без процессов не должно ждать их запуска
+    if sh.job != nil && (len(args) == 0 || sh.isInternal(args[0])) {
+        sh.job.markStarted()
+    }
+    if len(args) == 0 {
+        for _, a := range assigns {
+            sh.setVar(a.Name, sh.expandString(a.Value))
+        }
+        return 0
+    }
+
+    if fn, ok := sh.funcs[args[0]]; ok {
+        defer sh.tempAssign(assigns)()
+        return sh.callFunc(fn, args, stdio)
+    }
+    if b, ok := lookupBuiltin(args[0]); ok {
+        defer sh.tempAssign(assigns)()
+        return sh.runBuiltin(b, args, stdio)
+    }
+
+    st := sh.processStage(args, assigns, stdio)
+    return sh.runJob(strings.Join(args, " "), []stage{st}, func(int) {}, stdio)
+}
+
+// tempAssign выставляет переменные на время выполнения встроенной
+// команды или функции и возвращает функцию, возвращающую старые значения
+func (sh *Shell) tempAssign(assigns []Assign) func() {
+    type saved struct {
+        value  string
+        exists bool
+    }
+    old := make(map[string]saved)
+    for _, a := range assigns {
+        if _, seen := old[a.Name]; !seen {
+            value, exists := sh.vars[a.Name]
+            old[a.Name] = saved{value, exists}
+        }
+        sh.vars[a.Name] = sh.expandString(a.Value)
+    }
+    return func() {
+        for name, s := range old {
+            if s.exists {
+                sh.vars[name] = s.value
+            } else {
+                delete(sh.vars, name)
+            }
+        }
+    }
+}
+
+func (sh *Shell) callFunc(fn *FuncDef, args []string, stdio Stdio) int {
+    savedParams, savedLoops := sh.params, sh.loops
+    sh.params = args[1:]
+    sh.loops = 0
+    sh.funcDepth++
+    defer func() {
+        sh.params, sh.loops = savedParams, savedLoops
+        sh.funcDepth--
+    }()
+
+    status := sh.runCommand(fn.Body, stdio)
+    if sh.flow == flowReturn {
+        sh.flow = flowNone
+        status = sh.status
+    }
+    return status
+}
+
+func (sh *Shell) runBuiltin(b Builtin, args []string, stdio Stdio) int {
+    err := b.Run(sh, args, stdio)
+    var code ExitStatus
+    if errors.As(err, &code) {
+        return int(code)
+    }
+    // Читатель конвейера закрыл канал: звено завершается молча,
+    // как процесс, убитый SIGPIPE
+    if errors.Is(err, syscall.EPIPE) {
+        sh.flow = flowExit
+        sh.exitCode = 128 + int(syscall.SIGPIPE)
+        return sh.exitCode
+    }
+    if err != nil {
+        fmt.Fprintln(stdio.Stderr, err)
+        return 1
+    }
+    return 0
+}
+
+// isInternal сообщает, выполняется ли команда внутри шелла
+func (sh *Shell) isInternal(name string) bool {
+    if _, ok := sh.funcs[name]; ok {
+        return true
+    }
+    _, ok := lookupBuiltin(name)
+    return ok
+}
+
+// stage - одно звено конвейера
+type stage interface {
+    Start(job *Job) error
+    Wait() int
+    Name() string
+    // SharesStdio сообщает, что звено работает с потоками шелла
+    // напрямую, а не с копиями дескрипторов в дочернем процессе
+    SharesStdio() bool
+}
+
+// goroutineStage выполняет звено внутри шелла в отдельной горутине
+type goroutineStage struct {
+    run  func(job *Job) int
+    done chan int
+}
+
+func (s *goroutineStage) Start(job *Job) error {
+    s.done = make(chan int, 1)
+    go func() {
+        s.done <- s.run(job)
+    }()
+    return nil
+}
+
+func (s *goroutineStage) Name() string {
+    return ""
+}
+
+func (s *goroutineStage) SharesStdio() bool {
+    return true
+}
+
+func (s *goroutineStage) Wait() int {
+    return <-s.done
+}
+
+// processStage - внешняя программа, запускаемая исполнителем
+type processStage struct {
+    exec *Exec
+    proc Process
+    sh   *Shell
+}
+
+func (s *processStage) Start(job *Job) error {
+    proc, err := job.start(s.exec, s.sh.executor)
+    s.proc = proc
+    return err
+}
+
+func (s *processStage) Wait() int {
+    return s.proc.Wait()
+}
+
+func (s *processStage) Name() string {
+    return s.exec.Args[0]
+}
+
+// SharesStdio: у программы без процесса ОС (поддельный исполнитель)
+// нет своих копий дескрипторов
+func (s *processStage) SharesStdio() bool {
+    return s.proc == nil || s.proc.Pid() == 0
+}
+
+func (sh *Shell) processStage(args []string, assigns []Assign, stdio Stdio) *processStage {
+    e := &Exec{
+        Args:   args,
+        Env:    sh.Environ(),
+        Dir:    sh.dir,
+        Stdin:  stdio.Stdin,
+        Stdout: stdio.Stdout,
+        Stderr: stdio.Stderr,
+    }
+    for _, a := range assigns {
+        e.Env = append(e.Env, a.Name+"="+sh.expandString(a.Value))
+    }
+    return &processStage{exec: e, sh: sh}
+}
+
+// newStage готовит звено конвейера. Внешние программы запускаются напрямую,
+// все остальное (встроенные команды, функции, составные команды)
+// выполняется в горутине на копии шелла, как в отдельном подпроцессе.
+// Процессы, запущенные такой копией, входят в задание конвейера.
+func (sh *Shell) newStage(cmd Command, stdio Stdio) stage {
+    sub := sh.subshell()
+    if simple, ok := cmd.(*SimpleCommand); ok {
+        args, err := sh.expandWords(simple.Args)
+        if err != nil {
+            return &goroutineStage{run: func(*Job) int {
+                fmt.Fprintln(stdio.Stderr, err)
+                return 1
+            }}
+        }
+        if len(args) > 0 && !sh.isInternal(args[0]) {
+            return sh.processStage(args, simple.Assigns, stdio)
+        }
+        return &goroutineStage{run: func(job *Job) int {
+            sub.job = job
+            return sub.runArgs(args, simple.Assigns, stdio)
+        }}
+    }
+    return &goroutineStage{run: func(job *Job) int {
+        sub.job = job
+        return sub.runCommand(cmd, stdio)
+    }}
+}
+
+// runStages запускает команды, соединяя stdout каждой со stdin следующей
+// через каналы ОС, и возвращает код завершения конвейера
+func (sh *Shell) runStages(p *Pipeline, stdio Stdio) int {
+    commands := p.Commands
+    readers := make([]*os.File, len(commands)-1)
+    writers := make([]*os.File, len(commands)-1)
+
+    // closeEnds закрывает концы каналов, принадлежащие i-й команде,
+    // чтобы соседи получили EOF или SIGPIPE
+    closeEnds := func(i int) {
+        if i > 0 && readers[i-1] != nil {
+            readers[i-1].Close()
+        }
+        if i < len(writers) && writers[i] != nil {
+            writers[i].Close()
+        }
+    }
+
+    // Создаем каналы между командами
+    for i := range readers {
+        var err error
+        if readers[i], writers[i], err = os.Pipe(); err != nil {
+            fmt.Fprintf(stdio.Stderr, "pipe: %v\n", err)
+            for j := range commands {
+                closeEnds(j)
+            }
+            return 1
+        }
+    }
+
+    stages := make([]stage, len(commands))
+    for i, command := range commands {
+        stageIO := stdio
+        if i > 0 {
+            stageIO.Stdin = readers[i-1]
+        }
+        if i < len(commands)-1 {
+            stageIO.Stdout = writers[i]
+        }
+        stages[i] = sh.newStage(command, stageIO)
+    }
+
+    return sh.runJob(strings.TrimSpace(p.Text), stages, closeEnds, stdio)
+}
+
+// runJob запускает звенья как одно задание и возвращает код завершения
+// конвейера; коды всех звеньев сохраняются в PIPESTATUS.
+// closeEnds(i) вызывается, когда i-му звену больше не нужны его концы
+// каналов: у процесса - сразу после запуска (у него свои копии
+// дескрипторов), у звена внутри шелла - после завершения. Если звено
+// не запустилось, его концы закрываются сразу, и соседи не зависают.
+// Внутри фонового задания или звена конвейера процессы присоединяются
+// к уже существующему заданию, иначе создается задание переднего плана.
+func (sh *Shell) runJob(text string, stages []stage, closeEnds func(int), stdio Stdio) int {
+    job := sh.job
+    if job == nil {
+        job = sh.jobs.add(text, true)
+    }
+
+    // Запускаем все команды и ждем завершения каждой, даже если
+    // какая-то из них не запустилась или завершилась с ошибкой
+    statuses := make([]int, len(stages))
+    var wg sync.WaitGroup
+    for i, st := range stages {
+        if err := st.Start(job); err != nil {
+            statuses[i] = startFailed(st.Name(), err, stdio)
+            closeEnds(i)
+            continue
+        }
+        if !st.SharesStdio() {
+            closeEnds(i)
+        }
+        wg.Add(1)
+        go func(i int, st stage) {
+            defer wg.Done()
+            statuses[i] = st.Wait()
+            if st.SharesStdio() {
+                closeEnds(i)
+            }
+        }(i, st)
+    }
+
+    pipefail := sh.options["pipefail"]
+    if job == sh.job {
+        wg.Wait()
+        sh.pipeStatus = statuses
+        return pipelineStatus(statuses, pipefail)
+    }
+    go func() {
+        wg.Wait()
+        job.finish(pipelineStatus(statuses, pipefail))
+    }()
+    status := sh.waitForeground(job, stdio)
+    if job.State() == JobDone {
+        sh.pipeStatus = statuses
+    } else {
+        sh.pipeStatus = []int{status}
+    }
+    return status
+}
+
+// pipelineStatus возвращает код конвейера: код последнего звена,
+// а с pipefail - последний ненулевой код
+func pipelineStatus(statuses []int, pipefail bool) int {
+    if pipefail {
+        for i := len(statuses) - 1; i >= 0; i-- {
+            if statuses[i] != 0 {
+                return statuses[i]
+            }
+        }
+        return 0
+    }
+    return statuses[len(statuses)-1]
+}
+
+// startFailed сообщает об ошибке запуска программы и возвращает код как в sh:
+// 127 - команда не найдена, 126 - не удалось выполнить
+func startFailed(name string, err error, stdio Stdio) int {
+    if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+        fmt.Fprintf(stdio.Stderr, "%s: команда не найдена\n", name)
+        return 127
+    }
+    fmt.Fprintf(stdio.Stderr, "ошибка запуска команды: %v\n", err)
+    return 126
+}
+
+// exitStatus переводит результат Wait в код завершения;
+// для процессов, убитых сигналом, это 128+номер сигнала
+func exitStatus(err error) int {
+    if err == nil {
+        return 0
+    }
+    var exitErr *exec.ExitError
+    if errors.As(err, &exitErr) {
+        if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+            return 128 + int(ws.Signal())
+        }
+        return exitErr.ExitCode()
+    }
+    return 1
+}
@@ -0,0 +1,262 @@
+package interp
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "slices"
+    "strings"
+    "sync"
+    "syscall"
+)
+
+// Exec описывает запуск внешней программы: аргументы, окружение,
+// рабочий каталог и потоки. Все поля заполняет интерпретатор.
+type Exec struct {
+    Args   []string
+    Env    []string
+    Dir    string
+    Stdin  io.Reader
+    Stdout io.Writer
+    Stderr io.Writer
+
+    // SysProcAttr задает группу процессов при управлении заданиями;
+    // исполнители без настоящих процессов его игнорируют
+    SysProcAttr *syscall.SysProcAttr
+    // Stopped, если задан, вызывается при каждой остановке процесса сигналом
+    Stopped func()
+}
+
+// Lookup возвращает значение переменной из окружения запуска
+func (e *Exec) Lookup(name string) string {
+    for i := len(e.Env) - 1; i >= 0; i-- {
+        if value, ok := strings.CutPrefix(e.Env[i], name+"="); ok {
+            return value
+        }
+    }
+    return ""
+}
+
+// Process - запущенная программа
+type Process interface {
+    // Pid возвращает PID процесса ОС или 0, если процесса нет
+    Pid() int
+    // Wait ждет завершения и возвращает код завершения как в sh
+    Wait() int
+}
+
+// Executor запускает внешние программы для интерпретатора.
+// Ошибка exec.ErrNotFound означает, что программа не найдена (код 127),
+// любая другая - что ее не удалось выполнить (код 126).
+type Executor interface {
+    Start(e *Exec) (Process, error)
+}
+
+// RealExecutor запускает настоящие процессы ОС
+type RealExecutor struct{}
+
+func (RealExecutor) Start(e *Exec) (Process, error) {
+    path, err := lookPath(e.Args[0], e.Lookup("PATH"), e.Dir)
+    if err != nil {
+        return nil, err
+    }
+    cmd := &exec.Cmd{
+        Path:        path,
+        Args:        e.Args,
+        Env:         e.Env,
+        Dir:         e.Dir,
+        Stdin:       e.Stdin,
+        Stdout:      e.Stdout,
+        Stderr:      e.Stderr,
+        SysProcAttr: e.SysProcAttr,
+    }
+    if err := cmd.Start(); err != nil {
+        return nil, err
+    }
+    return &osProcess{cmd: cmd, stopped: e.Stopped}, nil
+}
+
+// lookPath ищет программу в каталогах path окружения интерпретатора,
+// а не процесса; имена с "/" отсчитываются от рабочего каталога dir
+func lookPath(name, path, dir string) (string, error) {
+    if strings.Contains(name, "/") {
+        full := name
+        if !filepath.IsAbs(full) {
+            full = filepath.Join(dir, name)
+        }
+        if _, err := os.Stat(full); err != nil {
+            return "", err
+        }
+        return full, nil
+    }
+    for _, d := range filepath.SplitList(path) {
+        if d == "" {
+            d = "."
+        }
+        if !filepath.IsAbs(d) {
+            d = filepath.Join(dir, d)
+        }
+        full := filepath.Join(d, name)
+        if info, err := os.Stat(full); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+            return full, nil
+        }
+    }
+    return "", exec.ErrNotFound
+}
+
+type osProcess struct {
+    cmd     *exec.Cmd
+    stopped func()
+}
+
+func (p *osProcess) Pid() int {
+    return p.cmd.Process.Pid
+}
+
+// Wait ждет завершения процесса. Если нужно следить за остановками
+// (Ctrl+Z), сообщает о каждой через stopped.
+func (p *osProcess) Wait() int {
+    if p.stopped != nil {
+        for {
+            stopped, err := waitStopped(p.cmd.Process.Pid)
+            if err != nil || !stopped {
+                break
+            }
+            p.stopped()
+        }
+    }
+    return exitStatus(p.cmd.Wait())
+}
+
+// FakeFunc - поддельная программа: получает параметры запуска
+// и возвращает код завершения
+type FakeFunc func(e *Exec) int
+
+// FakeExecutor выполняет программы в памяти, не запуская процессов.
+// Неизвестные программы считаются ненайденными. Все запуски
+// записываются в Calls.
+type FakeExecutor struct {
+    Commands map[string]FakeFunc
+
+    mu    sync.Mutex
+    calls [][]string
+}
+
+// NewFakeExecutor создает исполнитель с заданными программами
+func NewFakeExecutor(commands map[string]FakeFunc) *FakeExecutor {
+    if commands == nil {
+        commands = make(map[string]FakeFunc)
+    }
+    return &FakeExecutor{Commands: commands}
+}
+
+func (f *FakeExecutor) Start(e *Exec) (Process, error) {
+    f.mu.Lock()
+    f.calls = append(f.calls, append([]string{}, e.Args...))
+    f.mu.Unlock()
+
+    fn, ok := f.Commands[e.Args[0]]
+    if !ok {
+        return nil, exec.ErrNotFound
+    }
+    p := &fakeProcess{done: make(chan int, 1)}
+    go func() {
+        p.done <- fn(e)
+    }()
+    return p, nil
+}
+
+// Calls возвращает аргументы всех запусков по порядку
+func (f *FakeExecutor) Calls() [][]string {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return append([][]string{}, f.calls...)
+}
+
+type fakeProcess struct {
+    done   chan int
+    status int
+    once   sync.Once
+}
+
+func (p *fakeProcess) Pid() int {
+    return 0
+}
+
+func (p *fakeProcess) Wait() int {
+    p.once.Do(func() { p.status = <-p.done })
+    return p.status
+}
+
+// ErrNotPermitted возвращает SandboxExecutor для запрещенных программ
+var ErrNotPermitted = errors.New("запрещено политикой песочницы")
+
+// SandboxExecutor пропускает к Executor только разрешенные программы
+// и не дает запускать их вне каталога Root. Программы без "/" в имени
+// ищутся только в Path: PATH, заданный сценарием, не действует, иначе
+// разрешенное имя запустило бы чужую программу.
+type SandboxExecutor struct {
+    Executor Executor // по умолчанию RealExecutor
+    Allow    []string // разрешенные имена программ или абсолютные пути к ним
+    Root     string   // если задан, рабочий каталог должен быть внутри Root
+    Env      []string // если задано, заменяет окружение программ
+    Path     string   // каталоги поиска программ; по умолчанию PATH процесса
+}
+
+func (s *SandboxExecutor) Start(e *Exec) (Process, error) {
+    // имя с "/" разрешается только абсолютным путем из Allow
+    name := e.Args[0]
+    if strings.Contains(name, "/") && !filepath.IsAbs(name) {
+        name = filepath.Join(e.Dir, name)
+    }
+    if !slices.Contains(s.Allow, filepath.Clean(name)) && !slices.Contains(s.Allow, name) {
+        return nil, fmt.Errorf("%s: %w", e.Args[0], ErrNotPermitted)
+    }
+    if s.Root != "" {
+        // символические ссылки не должны выводить за Root
+        root, err := filepath.EvalSymlinks(s.Root)
+        if err != nil {
+            return nil, fmt.Errorf("%s: каталог %s: %w", e.Args[0], s.Root, ErrNotPermitted)
+        }
+        dir, err := filepath.EvalSymlinks(e.Dir)
+        if err != nil {
+            return nil, fmt.Errorf("%s: каталог %s: %w", e.Args[0], e.Dir, ErrNotPermitted)
+        }
+        rel, err := filepath.Rel(root, dir)
+        if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+            return nil, fmt.Errorf("%s: каталог %s вне %s: %w", e.Args[0], e.Dir, s.Root, ErrNotPermitted)
+        }
+    }
+
+    limited := *e
+    if s.Env != nil {
+        limited.Env = s.Env
+    }
+    // последнее значение PATH перекрывает заданные сценарием
+    limited.Env = append(slices.Clip(limited.Env), "PATH="+s.searchPath())
+    e = &limited
+    next := s.Executor
+    if next == nil {
+        next = RealExecutor{}
+    }
+    return next.Start(e)
+}
+
+// searchPath возвращает Path без относительных каталогов: они
+// отсчитывались бы от рабочего каталога, который задает сценарий
+func (s *SandboxExecutor) searchPath() string {
+    path := s.Path
+    if path == "" {
+        path = os.Getenv("PATH")
+    }
+    var dirs []string
+    for _, d := range filepath.SplitList(path) {
+        if filepath.IsAbs(d) {
+            dirs = append(dirs, d)
+        }
+    }
+    return strings.Join(dirs, string(filepath.ListSeparator))
+}
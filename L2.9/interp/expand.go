@@ -0,0 +1,418 @@
+package interp
+
+import (
+    "os"
+    "os/user"
+    "strconv"
+    "strings"
+)
+
+// lookupVar возвращает значение переменной: специальной ($?, $#, $1...),
+// переменной шелла или переменной окружения
+func (sh *Shell) lookupVar(name string) string {
+    switch name {
+    case "?":
+        return strconv.Itoa(sh.status)
+    case "#":
+        return strconv.Itoa(len(sh.params))
+    case "$":
+        return strconv.Itoa(os.Getpid())
+    case "0":
+        return sh.name
+    case "@", "*":
+        return strings.Join(sh.params, " ")
+    case "!":
+        if sh.lastBg != nil && sh.lastBg.Pgid() > 0 {
+            return strconv.Itoa(sh.lastBg.Pgid())
+        }
+        return ""
+    }
+    if name == "PIPESTATUS" || strings.HasPrefix(name, "PIPESTATUS[") {
+        return sh.pipeStatusVar(name)
+    }
+    if n, err := strconv.Atoi(name); err == nil {
+        if n >= 1 && n <= len(sh.params) {
+            return sh.params[n-1]
+        }
+        return ""
+    }
+    if value, ok := sh.vars[name]; ok {
+        return value
+    }
+    return sh.env[name]
+}
+
+// pipeStatusVar возвращает коды звеньев последнего конвейера:
+// ${PIPESTATUS[N]} - код N-го звена, ${PIPESTATUS[@]} - все коды,
+// $PIPESTATUS - код первого звена, как в bash
+func (sh *Shell) pipeStatusVar(name string) string {
+    index := "0"
+    if name != "PIPESTATUS" {
+        index = strings.TrimSuffix(strings.TrimPrefix(name, "PIPESTATUS["), "]")
+    }
+    if index == "@" || index == "*" {
+        codes := make([]string, len(sh.pipeStatus))
+        for i, code := range sh.pipeStatus {
+            codes[i] = strconv.Itoa(code)
+        }
+        return strings.Join(codes, " ")
+    }
+    n, err := strconv.Atoi(index)
+    if err != nil || n < 0 || n >= len(sh.pipeStatus) {
+        return ""
+    }
+    return strconv.Itoa(sh.pipeStatus[n])
+}
+
+// setVar присваивает переменную. Переменные, уже находящиеся
+// в окружении, обновляются там, чтобы их видели дочерние процессы.
+func (sh *Shell) setVar(name, value string) {
+    if _, ok := sh.env[name]; ok {
+        sh.env[name] = value
+        return
+    }
+    sh.vars[name] = value
+}
+
+// expandWords выполняет подстановки над словами команды в порядке sh:
+// фигурные скобки, тильда, переменные, разбиение на слова и шаблоны имен
+// файлов. Ошибка возвращается, только если включен failglob.
+func (sh *Shell) expandWords(words []Word) ([]string, error) {
+    var result []string
+    for _, w := range words {
+        for _, bw := range braceExpand(w) {
+            for _, f := range sh.expandFields(sh.expandTilde(bw)) {
+                if !f.glob {
+                    result = append(result, f.text)
+                    continue
+                }
+                matches, err := sh.globField(f)
+                if err != nil {
+                    return nil, err
+                }
+                result = append(result, matches...)
+            }
+        }
+    }
+    return result, nil
+}
+
+// field - поле после разбиения на слова. В pattern символы, бывшие
+// в кавычках, экранированы; glob означает, что в поле есть символы
+// шаблона вне кавычек.
+type field struct {
+    text    string
+    pattern string
+    glob    bool
+}
+
+// expandFields раскрывает одно слово в ноль или больше полей.
+// Результат подстановки без кавычек разбивается по пробелам,
+// в кавычках - остается одним полем ("$@" дает поле на каждый параметр).
+func (sh *Shell) expandFields(w Word) []field {
+    var fields []field
+    var text, pattern strings.Builder
+    hasCur, glob := false, false
+    endField := func() {
+        if hasCur {
+            fields = append(fields, field{text: text.String(), pattern: pattern.String(), glob: glob})
+        }
+        text.Reset()
+        pattern.Reset()
+        hasCur, glob = false, false
+    }
+    write := func(s string, quoted bool) {
+        text.WriteString(s)
+        if quoted {
+            pattern.WriteString(escapeGlob(s))
+        } else {
+            pattern.WriteString(s)
+            glob = glob || strings.ContainsAny(s, "*?[")
+        }
+        hasCur = true
+    }
+
+    for _, part := range w {
+        if part.kind == partLit {
+            if part.quoted || part.text != "" {
+                write(part.text, part.quoted)
+            }
+            continue
+        }
+
+        if part.quoted && part.text == "@" {
+            for i, param := range sh.params {
+                if i > 0 {
+                    endField()
+                }
+                write(param, true)
+            }
+            continue
+        }
+
+        value := sh.lookupVar(part.text)
+        if part.quoted {
+            write(value, true)
+            continue
+        }
+
+        // Разбиваем значение по пробельным символам
+        pieces := strings.Fields(value)
+        if len(pieces) == 0 {
+            continue
+        }
+        if strings.IndexAny(value[:1], " \t\n") == 0 {
+            endField()
+        }
+        for i, piece := range pieces {
+            if i > 0 {
+                endField()
+            }
+            write(piece, false)
+        }
+        if strings.IndexAny(value[len(value)-1:], " \t\n") == 0 {
+            endField()
+        }
+    }
+    endField()
+    return fields
+}
+
+// expandString раскрывает слово в одну строку без разбиения и шаблонов -
+// так раскрываются значения присваиваний
+func (sh *Shell) expandString(w Word) string {
+    var b strings.Builder
+    for _, part := range sh.expandTilde(w) {
+        if part.kind == partLit {
+            b.WriteString(part.text)
+        } else {
+            b.WriteString(sh.lookupVar(part.text))
+        }
+    }
+    return b.String()
+}
+
+// expandTilde заменяет ~ и ~user в начале слова домашним каталогом,
+// ~+ и ~- - текущим и предыдущим каталогом
+func (sh *Shell) expandTilde(w Word) Word {
+    if len(w) == 0 || w[0].kind != partLit || w[0].quoted || !strings.HasPrefix(w[0].text, "~") {
+        return w
+    }
+    text := w[0].text
+    name, rest := text[1:], ""
+    if i := strings.IndexByte(text, '/'); i >= 0 {
+        name, rest = text[1:i], text[i:]
+    } else if len(w) > 1 {
+        // Имя пользователя продолжается в кавычках или переменной - не раскрываем
+        return w
+    }
+
+    var dir string
+    switch name {
+    case "":
+        dir = sh.lookupVar("HOME")
+        if dir == "" {
+            dir, _ = os.UserHomeDir()
+        }
+    case "+":
+        dir = sh.dir
+    case "-":
+        dir = sh.lookupVar("OLDPWD")
+    default:
+        if u, err := user.Lookup(name); err == nil {
+            dir = u.HomeDir
+        }
+    }
+    if dir == "" {
+        return w
+    }
+
+    result := Word{{kind: partLit, text: dir, quoted: true}}
+    if rest != "" {
+        result = append(result, wordPart{kind: partLit, text: rest})
+    }
+    return append(result, w[1:]...)
+}
+
+// braceUnit - один символ слова (или подстановка переменной целиком)
+// при раскрытии фигурных скобок
+type braceUnit struct {
+    r      rune
+    quoted bool
+    v      *wordPart
+}
+
+func (u braceUnit) is(r rune) bool {
+    return u.v == nil && !u.quoted && u.r == r
+}
+
+// braceExpand раскрывает {a,b,c} и {1..5}/{a..e} в несколько слов.
+// Скобки без запятых и без диапазона остаются как есть: {} в find -exec.
+func braceExpand(w Word) []Word {
+    hasBrace := false
+    for _, p := range w {
+        if p.kind == partLit && !p.quoted && strings.ContainsRune(p.text, '{') {
+            hasBrace = true
+            break
+        }
+    }
+    if !hasBrace {
+        return []Word{w}
+    }
+
+    var units []braceUnit
+    for i := range w {
+        if w[i].kind == partVar {
+            units = append(units, braceUnit{v: &w[i]})
+            continue
+        }
+        if w[i].text == "" {
+            units = append(units, braceUnit{r: -1, quoted: w[i].quoted})
+        }
+        for _, r := range w[i].text {
+            units = append(units, braceUnit{r: r, quoted: w[i].quoted})
+        }
+    }
+
+    var result []Word
+    for _, us := range expandBraceUnits(units) {
+        result = append(result, unitsToWord(us))
+    }
+    return result
+}
+
+func expandBraceUnits(units []braceUnit) [][]braceUnit {
+    for i := range units {
+        if !units[i].is('{') {
+            continue
+        }
+
+        // Ищем парную скобку и запятые верхнего уровня
+        depth, end := 0, -1
+        var commas []int
+        for j := i + 1; j < len(units) && end < 0; j++ {
+            switch {
+            case units[j].is('{'):
+                depth++
+            case units[j].is('}'):
+                if depth == 0 {
+                    end = j
+                }
+                depth--
+            case units[j].is(',') && depth == 0:
+                commas = append(commas, j)
+            }
+        }
+        if end < 0 {
+            break
+        }
+
+        var alternatives [][]braceUnit
+        if len(commas) > 0 {
+            from := i + 1
+            for _, c := range append(commas, end) {
+                alternatives = append(alternatives, units[from:c])
+                from = c + 1
+            }
+        } else if alternatives = braceSequence(units[i+1 : end]); alternatives == nil {
+            continue
+        }
+
+        var result [][]braceUnit
+        for _, alt := range alternatives {
+            combined := make([]braceUnit, 0, len(units))
+            combined = append(combined, units[:i]...)
+            combined = append(combined, alt...)
+            combined = append(combined, units[end+1:]...)
+            result = append(result, expandBraceUnits(combined)...)
+        }
+        return result
+    }
+    return [][]braceUnit{units}
+}
+
+// braceSequence раскрывает диапазон a..b[..шаг] из чисел или одиночных букв
+func braceSequence(units []braceUnit) [][]braceUnit {
+    var b strings.Builder
+    for _, u := range units {
+        if u.v != nil || u.quoted {
+            return nil
+        }
+        b.WriteRune(u.r)
+    }
+    bounds := strings.Split(b.String(), "..")
+    if len(bounds) != 2 && len(bounds) != 3 {
+        return nil
+    }
+
+    step := 1
+    if len(bounds) == 3 {
+        n, err := strconv.Atoi(bounds[2])
+        if err != nil || n == 0 {
+            return nil
+        }
+        if step = n; step < 0 {
+            step = -step
+        }
+    }
+
+    var items []string
+    from, errFrom := strconv.Atoi(bounds[0])
+    to, errTo := strconv.Atoi(bounds[1])
+    switch {
+    case errFrom == nil && errTo == nil:
+        for n := from; ; {
+            items = append(items, strconv.Itoa(n))
+            if from <= to {
+                if n += step; n > to {
+                    break
+                }
+            } else if n -= step; n < to {
+                break
+            }
+        }
+    case len(bounds[0]) == 1 && len(bounds[1]) == 1:
+        from, to := int(bounds[0][0]), int(bounds[1][0])
+        for n := from; ; {
+            items = append(items, string(rune(n)))
+            if from <= to {
+                if n += step; n > to {
+                    break
+                }
+            } else if n -= step; n < to {
+                break
+            }
+        }
+    default:
+        return nil
+    }
+
+    result := make([][]braceUnit, len(items))
+    for i, item := range items {
+        for _, r := range item {
+            result[i] = append(result[i], braceUnit{r: r})
+        }
+    }
+    return result
+}
+
+// unitsToWord собирает слово обратно из символов
+func unitsToWord(units []braceUnit) Word {
+    var w Word
+    for _, u := range units {
+        if u.v != nil {
+            w = append(w, *u.v)
+            continue
+        }
+        if len(w) > 0 && w[len(w)-1].kind == partLit && w[len(w)-1].quoted == u.quoted && u.r >= 0 {
+            w[len(w)-1].text += string(u.r)
+            continue
+        }
+        part := wordPart{kind: partLit, quoted: u.quoted}
+        if u.r >= 0 {
+            part.text = string(u.r)
+        }
+        w = append(w, part)
+    }
+    return w
+}
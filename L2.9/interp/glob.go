@@ -0,0 +1,180 @@
+package interp
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// escapeGlob экранирует символы шаблона, чтобы они сопоставлялись буквально
+func escapeGlob(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        if strings.ContainsRune("*?[]\\", r) {
+            b.WriteByte('\\')
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+// globField раскрывает поле с шаблоном в отсортированный список имен файлов.
+// Без совпадений поле остается как есть, с nullglob - пропадает,
+// с failglob - это ошибка.
+func (sh *Shell) globField(f field) ([]string, error) {
+    matches := globPattern(f.pattern, sh.dir, sh.options["dotglob"])
+    if len(matches) > 0 {
+        sort.Strings(matches)
+        return matches, nil
+    }
+    switch {
+    case sh.options["failglob"]:
+        return nil, fmt.Errorf("нет совпадений: %s", f.text)
+    case sh.options["nullglob"]:
+        return nil, nil
+    }
+    return []string{f.text}, nil
+}
+
+// globPattern сопоставляет шаблон с файлами, проходя путь по компонентам.
+// Файлы, начинающиеся с точки, подходят, только если точка указана
+// в шаблоне явно (или включен dotglob). Относительные пути отсчитываются
+// от dir, но возвращаются относительными.
+func globPattern(pattern, dir string, dotglob bool) []string {
+    dirOnly := strings.HasSuffix(pattern, "/")
+    pattern = strings.TrimRight(pattern, "/")
+
+    var prefixes []string
+    rest := pattern
+    if strings.HasPrefix(pattern, "/") {
+        prefixes = []string{"/"}
+        rest = strings.TrimLeft(pattern, "/")
+    } else {
+        prefixes = []string{""}
+    }
+
+    segments := strings.Split(rest, "/")
+    for i, seg := range segments {
+        last := i == len(segments)-1
+        var next []string
+        for _, prefix := range prefixes {
+            next = append(next, globSegment(prefix, seg, dir, dotglob, !last || dirOnly)...)
+        }
+        if len(next) == 0 {
+            return nil
+        }
+        prefixes = next
+    }
+
+    if dirOnly {
+        for i := range prefixes {
+            prefixes[i] += "/"
+        }
+    }
+    return prefixes
+}
+
+// globSegment ищет в каталоге prefix записи, подходящие под один компонент
+// шаблона. Компонент без метасимволов просто проверяется на существование.
+func globSegment(prefix, seg, dir string, dotglob, wantDir bool) []string {
+    join := func(name string) string {
+        if prefix == "" {
+            return name
+        }
+        if strings.HasSuffix(prefix, "/") {
+            return prefix + name
+        }
+        return prefix + "/" + name
+    }
+    abs := func(path string) string {
+        if filepath.IsAbs(path) {
+            return path
+        }
+        return filepath.Join(dir, path)
+    }
+
+    if !hasGlobMeta(seg) {
+        path := join(unescapeGlob(seg))
+        info, err := os.Stat(abs(path))
+        if err != nil || (wantDir && !info.IsDir()) {
+            return nil
+        }
+        return []string{path}
+    }
+
+    entries, err := os.ReadDir(abs(prefix))
+    if err != nil {
+        return nil
+    }
+
+    seg = negateBrackets(seg)
+    var matches []string
+    for _, entry := range entries {
+        name := entry.Name()
+        if strings.HasPrefix(name, ".") && !strings.HasPrefix(seg, ".") && !strings.HasPrefix(seg, "\\.") {
+            if !dotglob || name == "." || name == ".." {
+                continue
+            }
+        }
+        if ok, err := filepath.Match(seg, name); err != nil || !ok {
+            continue
+        }
+        path := join(name)
+        if wantDir {
+            if info, err := os.Stat(abs(path)); err != nil || !info.IsDir() {
+                continue
+            }
+        }
+        matches = append(matches, path)
+    }
+    return matches
+}
+
+// hasGlobMeta сообщает, есть ли в шаблоне неэкранированные метасимволы
+func hasGlobMeta(pattern string) bool {
+    for i := 0; i < len(pattern); i++ {
+        switch pattern[i] {
+        case '\\':
+            i++
+        case '*', '?', '[':
+            return true
+        }
+    }
+    return false
+}
+
+// negateBrackets переводит отрицание [!...] из sh в [^...] filepath.Match.
+// Экранированные \[! и "!" внутри скобок не меняются.
+func negateBrackets(pattern string) string {
+    b := []byte(pattern)
+    inClass := false
+    for i := 0; i < len(b); i++ {
+        switch {
+        case b[i] == '\\':
+            i++
+        case b[i] == '[' && !inClass:
+            inClass = true
+            if i+1 < len(b) && b[i+1] == '!' {
+                b[i+1] = '^'
+                i++
+            }
+        case b[i] == ']':
+            inClass = false
+        }
+    }
+    return string(b)
+}
+
+// unescapeGlob убирает экранирование, добавленное escapeGlob
+func unescapeGlob(pattern string) string {
+    var b strings.Builder
+    for i := 0; i < len(pattern); i++ {
+        if pattern[i] == '\\' && i+1 < len(pattern) {
+            i++
+        }
+        b.WriteByte(pattern[i])
+    }
+    return b.String()
+}
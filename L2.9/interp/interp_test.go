@@ -0,0 +1,434 @@
+package interp
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestRunWithFakeExecutor(t *testing.T) {
+    fake := NewFakeExecutor(map[string]FakeFunc{
+        "hello": func(e *Exec) int {
+            e.Stdout.Write([]byte("hello " + strings.Join(e.Args[1:], " ") + "\n"))
+            return 0
+        },
+        "fail": func(e *Exec) int { return 3 },
+    })
+    var out, errOut bytes.Buffer
+    sh := New(Config{Env: []string{}, Dir: "/", Stdout: &out, Stderr: &errOut, Executor: fake})
+
+    tests := []struct {
+        src    string
+        status int
+        output string
+    }{
+        {"hello world", 0, "hello world\n"},
+        {"hello a | cat", 127, ""},
+        {"fail || echo ok", 0, "ok\n"},
+        {"fail; echo $?", 0, "3\n"},
+        {"missing", 127, ""},
+    }
+    for _, test := range tests {
+        out.Reset()
+        status, err := sh.Run(test.src)
+        if err != nil {
+            t.Errorf("%q: ошибка %v", test.src, err)
+            continue
+        }
+        if status != test.status || out.String() != test.output {
+            t.Errorf("%q: получили (%d, %q), ожидали (%d, %q)", test.src, status, out.String(), test.status, test.output)
+        }
+    }
+}
+
+func TestCdDoesNotChangeProcessDir(t *testing.T) {
+    root := t.TempDir()
+    if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+        t.Fatal(err)
+    }
+    before, _ := os.Getwd()
+
+    var out bytes.Buffer
+    sh := New(Config{Env: []string{}, Dir: root, Stdout: &out, Executor: NewFakeExecutor(nil)})
+    if _, err := sh.Run("cd sub && pwd"); err != nil {
+        t.Fatal(err)
+    }
+
+    want := filepath.Join(root, "sub")
+    if sh.Dir() != want || strings.TrimSpace(out.String()) != want {
+        t.Errorf("каталог интерпретатора: %q, pwd: %q, ожидали %q", sh.Dir(), out.String(), want)
+    }
+    if after, _ := os.Getwd(); after != before {
+        t.Errorf("каталог процесса изменился: %q -> %q", before, after)
+    }
+}
+
+func TestSandboxExecutor(t *testing.T) {
+    fake := NewFakeExecutor(map[string]FakeFunc{
+        "ok":  func(e *Exec) int { return 0 },
+        "bad": func(e *Exec) int { return 0 },
+    })
+    var errOut bytes.Buffer
+    sh := New(Config{
+        Env:      []string{},
+        Dir:      "/tmp",
+        Stderr:   &errOut,
+        Executor: &SandboxExecutor{Executor: fake, Allow: []string{"ok"}, Root: "/tmp"},
+    })
+
+    if status, _ := sh.Run("ok"); status != 0 {
+        t.Errorf("ok: код %d", status)
+    }
+    if status, _ := sh.Run("bad"); status != 126 {
+        t.Errorf("bad: код %d, ожидали 126", status)
+    }
+    if calls := fake.Calls(); len(calls) != 1 || calls[0][0] != "ok" {
+        t.Errorf("запуски: %v", calls)
+    }
+}
+
+func TestSandboxPath(t *testing.T) {
+    // в каталогах host и evil лежат программы ls с разным выводом
+    root := t.TempDir()
+    host, evil := filepath.Join(root, "host"), filepath.Join(root, "evil")
+    for _, dir := range []string{host, evil} {
+        if err := os.Mkdir(dir, 0755); err != nil {
+            t.Fatal(err)
+        }
+        script := "#!/bin/sh\necho " + filepath.Base(dir) + "\n"
+        if err := os.WriteFile(filepath.Join(dir, "ls"), []byte(script), 0755); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // ссылка из Root наружу
+    outside := t.TempDir()
+    if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+        t.Fatal(err)
+    }
+
+    var out bytes.Buffer
+    sh := New(Config{
+        Env:      []string{},
+        Dir:      root,
+        Stdout:   &out,
+        Stderr:   io.Discard,
+        Executor: &SandboxExecutor{Allow: []string{"ls", filepath.Join(host, "ls")}, Root: root, Path: host},
+    })
+    tests := []struct {
+        src    string
+        status int
+        output string
+    }{
+        {"ls", 0, "host\n"},
+        {"export PATH=" + evil + "; ls", 0, "host\n"},
+        {"PATH=" + evil + " ls", 0, "host\n"},
+        {"export PATH=.; cd evil && ls; cd ..", 0, "host\n"},
+        {evil + "/ls", 126, ""},
+        {"evil/ls", 126, ""},
+        {host + "/ls", 0, "host\n"},
+        {"cd out && ls", 126, ""},
+    }
+    for _, test := range tests {
+        out.Reset()
+        status, err := sh.Run(test.src)
+        if err != nil {
+            t.Errorf("%q: ошибка %v", test.src, err)
+            continue
+        }
+        if status != test.status || out.String() != test.output {
+            t.Errorf("%q: получили (%d, %q), ожидали (%d, %q)", test.src, status, out.String(), test.status, test.output)
+        }
+    }
+}
+
+// argsExecutor - исполнитель с командой args, которая печатает каждый
+// аргумент в скобках, командами exitN, завершающимися с кодом N, и
+// вспомогательными eq и lines
+func argsExecutor() *FakeExecutor {
+    return NewFakeExecutor(map[string]FakeFunc{
+        "args": func(e *Exec) int {
+            for _, arg := range e.Args[1:] {
+                e.Stdout.Write([]byte("[" + arg + "]"))
+            }
+            e.Stdout.Write([]byte("\n"))
+            return 0
+        },
+        "exit2": func(e *Exec) int { return 2 },
+        "exit3": func(e *Exec) int { return 3 },
+        // eq a b - код 0, если аргументы равны
+        "eq": func(e *Exec) int {
+            if len(e.Args) == 3 && e.Args[1] == e.Args[2] {
+                return 0
+            }
+            return 1
+        },
+        // lines выводит число строк ввода
+        "lines": func(e *Exec) int {
+            data, _ := io.ReadAll(e.Stdin)
+            fmt.Fprintln(e.Stdout, bytes.Count(data, []byte("\n")))
+            return 0
+        },
+    })
+}
+
+func TestExpansion(t *testing.T) {
+    var out bytes.Buffer
+    sh := New(Config{Env: []string{"X=a  b", "EMPTY="}, Dir: "/", Stdout: &out, Executor: argsExecutor()})
+
+    tests := []struct {
+        src    string
+        output string
+    }{
+        // кавычки
+        {`args 'a  b' "c  d" e\ f`, "[a  b][c  d][e f]\n"},
+        {`args '$X' "$X" $X`, "[$X][a  b][a][b]\n"},
+        {`args "a"'b'c "" ''`, "[abc][][]\n"},
+        {`args "\$X \"q\" \\" 'it''s'`, "[$X \"q\" \\][its]\n"},
+        {`args $EMPTY "$EMPTY"`, "[]\n"},
+        // фигурные скобки
+        {`args {a,b,c}`, "[a][b][c]\n"},
+        {`args x{1..3}y`, "[x1y][x2y][x3y]\n"},
+        {`args {3..1}`, "[3][2][1]\n"},
+        {`args {1..10..4}`, "[1][5][9]\n"},
+        {`args {a..e..2}`, "[a][c][e]\n"},
+        {`args {c..a}{1,2}`, "[c1][c2][b1][b2][a1][a2]\n"},
+        {`args "{1..3}" {1..} {a,}`, "[{1..3}][{1..}][a]\n"},
+    }
+    for _, test := range tests {
+        out.Reset()
+        if status, err := sh.Run(test.src); err != nil || status != 0 {
+            t.Errorf("%q: код %d, ошибка %v", test.src, status, err)
+            continue
+        }
+        if out.String() != test.output {
+            t.Errorf("%q: получили %q, ожидали %q", test.src, out.String(), test.output)
+        }
+    }
+}
+
+func TestGlob(t *testing.T) {
+    root := t.TempDir()
+    for _, name := range []string{"a1.txt", "b2.txt", "c3.log", "[!x].txt", ".hidden.txt"} {
+        if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    var out bytes.Buffer
+    sh := New(Config{Env: []string{}, Dir: root, Stdout: &out, Executor: argsExecutor()})
+
+    tests := []struct {
+        src    string
+        output string
+    }{
+        {`args *.txt`, "[[!x].txt][a1.txt][b2.txt]\n"},
+        {`args ?[0-9].*`, "[a1.txt][b2.txt][c3.log]\n"},
+        {`args [ab]*`, "[a1.txt][b2.txt]\n"},
+        {`args [!ab]*`, "[[!x].txt][c3.log]\n"},
+        {`args [a-b][0-9].txt`, "[a1.txt][b2.txt]\n"},
+        {`args [!a-b][!a-z].*`, "[c3.log]\n"},
+        // экранированная скобка ищет имя буквально, а не отрицание
+        {`args \[!x\].txt`, "[[!x].txt]\n"},
+        {`args '[!x]'.txt`, "[[!x].txt]\n"},
+        {`args \[!x\]*`, "[[!x].txt]\n"},
+        {`args "*.txt" z*`, "[*.txt][z*]\n"},
+        {`args .*.txt`, "[.hidden.txt]\n"},
+    }
+    for _, test := range tests {
+        out.Reset()
+        if status, err := sh.Run(test.src); err != nil || status != 0 {
+            t.Errorf("%q: код %d, ошибка %v", test.src, status, err)
+            continue
+        }
+        if out.String() != test.output {
+            t.Errorf("%q: получили %q, ожидали %q", test.src, out.String(), test.output)
+        }
+    }
+}
+
+func TestPipeStatus(t *testing.T) {
+    var out bytes.Buffer
+    sh := New(Config{Env: []string{}, Dir: "/", Stdout: &out, Executor: argsExecutor()})
+
+    tests := []struct {
+        src    string
+        status int
+        output string
+    }{
+        {"exit3 | true", 0, ""},
+        {"true | exit3", 3, ""},
+        {"exit2 | exit3 | true; echo ${PIPESTATUS[@]}", 0, "2 3 0\n"},
+        {"exit2 | true; echo $PIPESTATUS ${PIPESTATUS[1]}", 0, "2 0\n"},
+        {"exit3; echo ${PIPESTATUS[@]}", 0, "3\n"},
+        {"set -o pipefail; exit2 | exit3 | true", 3, ""},
+        {"set -o pipefail; exit3 | exit2 | true; echo $?", 0, "2\n"},
+        {"set -o pipefail; true | true", 0, ""},
+        {"set +o pipefail; exit3 | true", 0, ""},
+        {"! exit3 | true", 1, ""},
+    }
+    for _, test := range tests {
+        out.Reset()
+        status, err := sh.Run(test.src)
+        if err != nil {
+            t.Errorf("%q: ошибка %v", test.src, err)
+            continue
+        }
+        if status != test.status || out.String() != test.output {
+            t.Errorf("%q: получили (%d, %q), ожидали (%d, %q)", test.src, status, out.String(), test.status, test.output)
+        }
+    }
+}
+
+func TestControlFlow(t *testing.T) {
+    tests := []struct {
+        src    string
+        status int
+        output string
+    }{
+        // if
+        {"if true; then echo yes; else echo no; fi", 0, "yes\n"},
+        {"if false; then echo yes; elif true; then echo elif; else echo no; fi", 0, "elif\n"},
+        {"if false; then echo yes; fi", 0, ""},
+        {"if exit3; then :; else echo $?; fi", 0, "3\n"},
+        // while
+        {"i=; while ! eq $i xxx; do i=x$i; echo $i; done", 0, "x\nxx\nxxx\n"},
+        {"while true; do echo once; break; done", 0, "once\n"},
+        {"while false; do echo never; done", 0, ""},
+        // for
+        {"for x in a b c; do echo $x; done", 0, "a\nb\nc\n"},
+        {"for x in a b c; do if eq $x b; then continue; fi; echo $x; done", 0, "a\nc\n"},
+        {"for x in; do echo $x; done", 0, ""},
+        // функции
+        {"f() { echo in f $1; }; f arg", 0, "in f arg\n"},
+        {"function g { return 3; echo no; }; g; echo $?", 0, "3\n"},
+        {"f() { exit3; }; f", 3, ""},
+        // группы и вложенность
+        {"{ echo a; echo b; } | lines", 0, "2\n"},
+        {"{ false; }", 1, ""},
+        {"for i in 1 2; do for j in a b; do echo $i$j; done; done", 0, "1a\n1b\n2a\n2b\n"},
+        {"for i in 1 2 3; do while true; do break 2; done; echo no; done; echo $i", 0, "1\n"},
+        {"f() { if ! eq $1 xxx; then echo $1; f x$1; fi; }; f x", 0, "x\nxx\n"},
+        {"if true; then if false; then echo a; else { echo b; }; fi; fi", 0, "b\n"},
+        // многострочный текст
+        {"if true\nthen\n  echo multi\nfi", 0, "multi\n"},
+        {"for x in 1 2\ndo\n  echo $x\ndone", 0, "1\n2\n"},
+        {"f() {\n  echo body\n}\nf", 0, "body\n"},
+    }
+    for _, test := range tests {
+        var out bytes.Buffer
+        sh := New(Config{Env: []string{}, Dir: "/", Stdout: &out, Executor: argsExecutor()})
+        status, err := sh.Run(test.src)
+        if err != nil {
+            t.Errorf("%q: ошибка %v", test.src, err)
+            continue
+        }
+        if status != test.status || out.String() != test.output {
+            t.Errorf("%q: получили (%d, %q), ожидали (%d, %q)", test.src, status, out.String(), test.status, test.output)
+        }
+    }
+}
+
+func TestSyntaxErrors(t *testing.T) {
+    tests := []struct {
+        src string
+        err string
+    }{
+        {"if true; then echo", "неожиданный конец файла"},
+        {"while true; do echo x", "неожиданный конец файла"},
+        {"f() {", "неожиданный конец файла"},
+        {"echo 'unterminated", "неожиданный конец файла"},
+        {"echo a |", "неожиданный конец файла"},
+        {"fi", "неожиданным токеном `fi'"},
+        {"if true; fi", "неожиданным токеном `fi'"},
+        {"for 1x in a; do :; done", "неожиданным токеном"},
+        {"| echo", "неожиданным токеном `|'"},
+        {"echo a > file", "перенаправления не поддерживаются"},
+    }
+    for _, test := range tests {
+        var out bytes.Buffer
+        sh := New(Config{Env: []string{}, Dir: "/", Stdout: &out, Executor: argsExecutor()})
+        status, err := sh.Run(test.src)
+        if status != 2 || err == nil || !strings.Contains(err.Error(), test.err) {
+            t.Errorf("%q: получили (%d, %v), ожидали (2, %q)", test.src, status, err, test.err)
+        }
+        if out.Len() != 0 {
+            t.Errorf("%q: при синтаксической ошибке выполнено %q", test.src, out.String())
+        }
+    }
+}
+
+func TestRunLines(t *testing.T) {
+    tests := []struct {
+        name   string
+        input  string
+        status int
+        output string
+        errOut string
+    }{
+        {"конструкция на нескольких строках", "if true\nthen\n  echo a\nfi\necho b\n", 0, "a\nb\n", ""},
+        {"продолжение после |", "echo x |\nlines\n", 0, "1\n", ""},
+        {"строка в кавычках", "args 'a\nb'\n", 0, "[a\nb]\n", ""},
+        {"обрыв посреди конструкции", "echo a\nwhile true; do\n", 2, "a\n", "синтаксическая ошибка: неожиданный конец файла\n"},
+        {"синтаксическая ошибка", "echo a\nfi\necho b\n", 2, "a\n", "синтаксическая ошибка рядом с неожиданным токеном `fi'\n"},
+        {"код последней команды", "true\nexit3\n", 3, "", ""},
+        {"exit N", "echo a\nexit 5\necho b\n", 5, "a\n", ""},
+        {"exit без аргумента", "exit2\nexit\n", 2, "", ""},
+        {"exit в функции", "f() { exit 4; }\nf\necho no\n", 4, "", ""},
+        {"exit в конвейере завершает только его", "exit 7 | true\necho $?\n", 0, "0\n", ""},
+    }
+    for _, test := range tests {
+        var out, errOut bytes.Buffer
+        sh := New(Config{Env: []string{}, Dir: "/", Stdout: &out, Stderr: &errOut, Executor: argsExecutor()})
+        status := sh.RunLines(ReaderSource(strings.NewReader(test.input)), false)
+        if status != test.status || out.String() != test.output || errOut.String() != test.errOut {
+            t.Errorf("%s: получили (%d, %q, %q), ожидали (%d, %q, %q)", test.name,
+                status, out.String(), errOut.String(), test.status, test.output, test.errOut)
+        }
+    }
+}
+
+func TestPipelineBuiltins(t *testing.T) {
+    root := t.TempDir()
+    if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        src    string
+        output string
+        calls  []string // запущенные внешние команды
+    }{
+        {"echo hi | lines", "1\n", []string{"lines"}},
+        {"echo a | echo b | lines", "1\n", []string{"lines"}},
+        {"pwd | lines", "1\n", []string{"lines"}},
+        {"f() { echo a; echo b; }; f | lines", "2\n", []string{"lines"}},
+        {"echo x | { echo a; lines; }", "a\n1\n", []string{"lines"}},
+        // звенья - копии шелла: cd и переменные не меняют родителя
+        {"cd sub | true; pwd", root + "\n", nil},
+        {"true | cd sub; pwd", root + "\n", nil},
+        {"X=1; X=2 | true; echo $X", "1\n", nil},
+        {"export Y=1 | true; echo $Y", "\n", nil},
+        {"true | f() { echo no; }; f", "", []string{"f"}},
+    }
+    for _, test := range tests {
+        var out bytes.Buffer
+        fake := argsExecutor()
+        sh := New(Config{Env: []string{}, Dir: root, Stdout: &out, Stderr: io.Discard, Executor: fake})
+        if _, err := sh.Run(test.src); err != nil {
+            t.Errorf("%q: ошибка %v", test.src, err)
+            continue
+        }
+        var calls []string
+        for _, call := range fake.Calls() {
+            calls = append(calls, call[0])
+        }
+        if out.String() != test.output || strings.Join(calls, " ") != strings.Join(test.calls, " ") {
+            t.Errorf("%q: получили %q, запуски %q, ожидали %q, %q", test.src, out.String(), calls, test.output, test.calls)
+        }
+        if sh.Dir() != root {
+            t.Errorf("%q: каталог шелла изменился на %q", test.src, sh.Dir())
+        }
+    }
+}
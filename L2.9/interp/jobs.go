@@ -0,0 +1,449 @@
+package interp
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "os/signal"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "syscall"
+    "unsafe"
+)
+
+// JobState - состояние задания
+type JobState int
+
+const (
+    JobRunning JobState = iota
+    JobStopped
+    JobDone
+)
+
+func (s JobState) String() string {
+    switch s {
+    case JobRunning:
+        return "Запущен"
+    case JobStopped:
+        return "Остановлен"
+    }
+    return "Завершен"
+}
+
+// Job - задание: процессы одного конвейера (или фоновой команды),
+// объединенные в группу процессов
+type Job struct {
+    ID         int
+    Command    string
+    foreground bool
+
+    table       *jobTable
+    mu          sync.Mutex
+    cond        *sync.Cond
+    pgid        int
+    pids        []int
+    state       JobState
+    status      int
+    started     chan struct{} // закрывается при запуске первого процесса или внутренней команды либо при завершении
+    startedOnce sync.Once
+}
+
+func (j *Job) markStarted() {
+    j.startedOnce.Do(func() { close(j.started) })
+}
+
+// Pgid возвращает группу процессов задания или 0, если процессы еще не запускались
+func (j *Job) Pgid() int {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    return j.pgid
+}
+
+// State возвращает текущее состояние задания
+func (j *Job) State() JobState {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    return j.state
+}
+
+// start запускает программу в группе задания. Первый процесс становится
+// лидером группы, а у задания переднего плана еще и получает терминал.
+func (j *Job) start(e *Exec, executor Executor) (Process, error) {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+
+    if j.table.control {
+        attr := &syscall.SysProcAttr{Setpgid: true, Pgid: j.pgid}
+        if j.pgid == 0 && j.foreground {
+            attr.Foreground = true
+            attr.Ctty = j.table.tty
+        }
+        e.SysProcAttr = attr
+        e.Stopped = j.stopped
+    }
+    proc, err := executor.Start(e)
+    if err != nil {
+        return nil, err
+    }
+    if pid := proc.Pid(); pid > 0 {
+        j.pids = append(j.pids, pid)
+        if j.pgid == 0 {
+            j.pgid = pid
+        }
+    }
+    j.markStarted()
+    return proc, nil
+}
+
+// signal посылает сигнал процессам задания. Без управления заданиями
+// процессы не выделены в свою группу, поэтому сигнал идет каждому PID.
+func (j *Job) signal(sig syscall.Signal) error {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+
+    if len(j.pids) == 0 {
+        return fmt.Errorf("%%%d: у задания нет процессов", j.ID)
+    }
+    if j.table.control {
+        return syscall.Kill(-j.pgid, sig)
+    }
+    var firstErr error
+    for _, pid := range j.pids {
+        if err := syscall.Kill(pid, sig); err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    return firstErr
+}
+
+// stopped отмечает, что процесс задания остановлен сигналом
+func (j *Job) stopped() {
+    j.mu.Lock()
+    if j.state == JobRunning {
+        j.state = JobStopped
+        j.cond.Broadcast()
+    }
+    j.mu.Unlock()
+}
+
+// finish отмечает завершение задания с кодом status
+func (j *Job) finish(status int) {
+    j.mu.Lock()
+    j.state = JobDone
+    j.status = status
+    j.cond.Broadcast()
+    j.mu.Unlock()
+    j.markStarted()
+}
+
+// wait ждет, пока задание не завершится или не будет остановлено
+func (j *Job) wait() (JobState, int) {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    for j.state == JobRunning {
+        j.cond.Wait()
+    }
+    return j.state, j.status
+}
+
+// resume продолжает остановленное задание сигналом SIGCONT
+func (j *Job) resume(foreground bool) error {
+    j.mu.Lock()
+    j.foreground = foreground
+    if j.state == JobDone || j.pgid == 0 {
+        j.mu.Unlock()
+        return nil
+    }
+    j.state = JobRunning
+    pgid := j.pgid
+    j.mu.Unlock()
+
+    if foreground && j.table.control {
+        if err := tcsetpgrp(j.table.tty, pgid); err != nil {
+            return err
+        }
+    }
+    return j.signal(syscall.SIGCONT)
+}
+
+// jobTable - таблица заданий шелла, общая для всех его копий
+type jobTable struct {
+    mu          sync.Mutex
+    jobs        []*Job
+    fg          *Job
+    control     bool // управление заданиями: группы процессов и передача терминала
+    tty         int
+    shellPgid   int
+    interrupted atomic.Bool
+}
+
+func newJobTable() *jobTable {
+    return &jobTable{tty: -1}
+}
+
+// enableControl включает управление заданиями для интерактивного шелла
+// на терминале tty. SIGINT, SIGQUIT и SIGTSTP больше не завершают и не
+// останавливают шелл, а пересылаются группе процессов переднего плана.
+func (t *jobTable) enableControl(tty int) {
+    t.control = true
+    t.tty = tty
+    t.shellPgid = syscall.Getpgrp()
+
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTSTP)
+    go func() {
+        for sig := range signals {
+            t.forward(sig.(syscall.Signal))
+        }
+    }()
+}
+
+// forward передает сигнал заданию переднего плана. Если на переднем плане
+// нет процессов (выполняются встроенные команды), SIGINT прерывает
+// текущую командную строку.
+func (t *jobTable) forward(sig syscall.Signal) {
+    t.mu.Lock()
+    fg := t.fg
+    t.mu.Unlock()
+
+    if fg != nil {
+        if pgid := fg.Pgid(); pgid > 0 {
+            syscall.Kill(-pgid, sig)
+            return
+        }
+    }
+    if sig == syscall.SIGINT {
+        t.interrupted.Store(true)
+    }
+}
+
+// add регистрирует новое задание
+func (t *jobTable) add(command string, foreground bool) *Job {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    id := 1
+    for _, j := range t.jobs {
+        if j.ID >= id {
+            id = j.ID + 1
+        }
+    }
+    job := &Job{ID: id, Command: command, foreground: foreground, table: t, started: make(chan struct{})}
+    job.cond = sync.NewCond(&job.mu)
+    t.jobs = append(t.jobs, job)
+    return job
+}
+
+func (t *jobTable) remove(job *Job) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    for i, j := range t.jobs {
+        if j == job {
+            t.jobs = append(t.jobs[:i], t.jobs[i+1:]...)
+            return
+        }
+    }
+}
+
+func (t *jobTable) setForeground(job *Job) {
+    t.mu.Lock()
+    t.fg = job
+    t.mu.Unlock()
+}
+
+// list возвращает копию списка заданий
+func (t *jobTable) list() []*Job {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    return append([]*Job{}, t.jobs...)
+}
+
+// marker возвращает отметку задания в выводе jobs:
+// "+" - текущее задание, "-" - предыдущее
+func (t *jobTable) marker(job *Job) string {
+    jobs := t.list()
+    switch {
+    case len(jobs) > 0 && jobs[len(jobs)-1] == job:
+        return "+"
+    case len(jobs) > 1 && jobs[len(jobs)-2] == job:
+        return "-"
+    }
+    return " "
+}
+
+// format возвращает строку о задании в формате вывода jobs
+func (t *jobTable) format(job *Job) string {
+    return fmt.Sprintf("[%d]%s  %-12s %s", job.ID, t.marker(job), job.State(), job.Command)
+}
+
+// find находит задание по спецификации: %N, %%, %+, %-, %строка
+func (t *jobTable) find(spec string) (*Job, error) {
+    jobs := t.list()
+    if !strings.HasPrefix(spec, "%") {
+        return nil, fmt.Errorf("%s: неверная спецификация задания", spec)
+    }
+    spec = spec[1:]
+
+    switch spec {
+    case "", "%", "+":
+        if len(jobs) > 0 {
+            return jobs[len(jobs)-1], nil
+        }
+    case "-":
+        if len(jobs) > 1 {
+            return jobs[len(jobs)-2], nil
+        }
+    default:
+        if id, err := strconv.Atoi(spec); err == nil {
+            for _, j := range jobs {
+                if j.ID == id {
+                    return j, nil
+                }
+            }
+            break
+        }
+        for i := len(jobs) - 1; i >= 0; i-- {
+            if strings.HasPrefix(jobs[i].Command, spec) {
+                return jobs[i], nil
+            }
+        }
+    }
+    return nil, fmt.Errorf("%%%s: нет такого задания", spec)
+}
+
+// hasStopped сообщает, есть ли остановленные задания
+func (t *jobTable) hasStopped() bool {
+    for _, j := range t.list() {
+        if j.State() == JobStopped {
+            return true
+        }
+    }
+    return false
+}
+
+// notify сообщает о завершившихся фоновых заданиях и удаляет их из таблицы
+func (t *jobTable) notify(w io.Writer) {
+    for _, j := range t.list() {
+        if j.State() == JobDone {
+            fmt.Fprintln(w, t.format(j))
+            t.remove(j)
+        }
+    }
+}
+
+// takeTerminal возвращает терминал группе процессов шелла.
+// Шелл в этот момент не на переднем плане, поэтому на время
+// вызова SIGTTOU игнорируется, иначе ядро остановило бы шелл.
+func (t *jobTable) takeTerminal() {
+    if !t.control {
+        return
+    }
+    signal.Ignore(syscall.SIGTTOU)
+    tcsetpgrp(t.tty, t.shellPgid)
+    signal.Reset(syscall.SIGTTOU)
+}
+
+func tcsetpgrp(fd, pgid int) error {
+    p := int32(pgid)
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCSPGRP, uintptr(unsafe.Pointer(&p)))
+    if errno != 0 {
+        return errno
+    }
+    return nil
+}
+
+const (
+    pPid       = 1 // P_PID для waitid
+    cldStopped = 5 // CLD_STOPPED в si_code
+)
+
+// waitStopped ждет, пока процесс не завершится или не будет остановлен.
+// Завершившийся процесс не снимается с учета (WNOWAIT), чтобы его код
+// завершения затем забрал cmd.Wait. Возвращает true, если процесс остановлен.
+func waitStopped(pid int) (bool, error) {
+    var info [128]byte // siginfo_t
+    for {
+        _, _, errno := syscall.Syscall6(syscall.SYS_WAITID, pPid, uintptr(pid),
+            uintptr(unsafe.Pointer(&info[0])), syscall.WEXITED|syscall.WSTOPPED|syscall.WNOWAIT, 0, 0)
+        if errno == syscall.EINTR {
+            continue
+        }
+        if errno != 0 {
+            return false, errno
+        }
+        break
+    }
+
+    code := *(*int32)(unsafe.Pointer(&info[8]))
+    if code != cldStopped {
+        return false, nil
+    }
+    // Забираем событие остановки, чтобы следующий waitid ждал нового
+    syscall.Syscall6(syscall.SYS_WAITID, pPid, uintptr(pid),
+        uintptr(unsafe.Pointer(&info[0])), syscall.WSTOPPED|syscall.WNOHANG, 0, 0)
+    return true, nil
+}
+
+// runBackground запускает команду в фоне как отдельное задание
+func (sh *Shell) runBackground(item *AndOr, stdio Stdio) {
+    job := sh.jobs.add(strings.TrimSpace(item.Text), false)
+    sub := sh.subshell()
+    sub.job = job
+    sh.lastBg = job
+
+    // Без управления заданиями фоновая команда не должна читать терминал
+    var devNull *os.File
+    if !sh.jobs.control {
+        if f, err := os.Open(os.DevNull); err == nil {
+            devNull = f
+            stdio.Stdin = f
+        }
+    }
+
+    go func() {
+        status := sub.runAndOr(item, stdio)
+        if devNull != nil {
+            devNull.Close()
+        }
+        job.finish(status)
+    }()
+
+    // Если задание начинается с внешней программы, дожидаемся ее запуска,
+    // чтобы $! и сообщение о задании содержали PID. Внутренняя команда
+    // отмечает задание запущенным сразу после раскрытия слов в копии
+    // шелла, поэтому здесь они второй раз не раскрываются.
+    if _, ok := item.First.Commands[0].(*SimpleCommand); ok {
+        <-job.started
+    }
+    if sh.jobs.control {
+        if pgid := job.Pgid(); pgid > 0 {
+            fmt.Fprintf(stdio.Stderr, "[%d] %d\n", job.ID, pgid)
+        } else {
+            fmt.Fprintf(stdio.Stderr, "[%d]\n", job.ID)
+        }
+    }
+}
+
+// waitForeground ждет задание переднего плана. Остановленное задание
+// остается в таблице, завершившееся - удаляется.
+func (sh *Shell) waitForeground(job *Job, stdio Stdio) int {
+    sh.jobs.setForeground(job)
+    state, status := job.wait()
+    sh.jobs.setForeground(nil)
+    sh.jobs.takeTerminal()
+
+    if state == JobStopped {
+        fmt.Fprintf(stdio.Stderr, "\n%s\n", sh.jobs.format(job))
+        return 128 + int(syscall.SIGTSTP)
+    }
+
+    sh.jobs.remove(job)
+    if sh.jobs.control && status == 128+int(syscall.SIGINT) {
+        // Процесс прерван с терминала - прерываем и остаток командной строки
+        fmt.Fprintln(stdio.Stderr)
+        sh.flow = flowInterrupt
+    }
+    return status
+}
@@ -0,0 +1,181 @@
+package interp
+
+import (
+    "bytes"
+    "fmt"
+    "os"
+    "os/exec"
+    "strings"
+    "syscall"
+    "testing"
+)
+
+func TestParseSignal(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected syscall.Signal
+        err      string
+    }{
+        {"9", syscall.SIGKILL, ""},
+        {"0", 0, ""},
+        {"KILL", syscall.SIGKILL, ""},
+        {"term", syscall.SIGTERM, ""},
+        {"SIGINT", syscall.SIGINT, ""},
+        {"SigUsr1", syscall.SIGUSR1, ""},
+        {"65", 0, "неверный номер сигнала"},
+        {"-1", 0, "неверный номер сигнала"},
+        {"BOGUS", 0, "неверная спецификация сигнала"},
+        {"SIG", 0, "неверная спецификация сигнала"},
+    }
+    for _, test := range tests {
+        sig, err := parseSignal(test.input)
+        switch {
+        case test.err == "" && (err != nil || sig != test.expected):
+            t.Errorf("parseSignal(%q) = %v, %v, ожидали %v", test.input, sig, err, test.expected)
+        case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+            t.Errorf("parseSignal(%q): ошибка %v, ожидали %q", test.input, err, test.err)
+        }
+    }
+}
+
+func TestJobFind(t *testing.T) {
+    jobs := newJobTable()
+    for _, command := range []string{"sleep 10", "make all", "sleep 20"} {
+        jobs.add(command, false)
+    }
+    tests := []struct {
+        spec string
+        id   int // 0 - задание не найдено
+    }{
+        {"%1", 1},
+        {"%3", 3},
+        {"%", 3},
+        {"%%", 3},
+        {"%+", 3},
+        {"%-", 2},
+        {"%make", 2},
+        {"%sleep", 3},
+        {"%sleep 1", 1},
+        {"%4", 0},
+        {"%vi", 0},
+        {"1", 0},
+    }
+    for _, test := range tests {
+        job, err := jobs.find(test.spec)
+        switch {
+        case test.id == 0 && err == nil:
+            t.Errorf("find(%q) = [%d], ожидали ошибку", test.spec, job.ID)
+        case test.id != 0 && (err != nil || job.ID != test.id):
+            t.Errorf("find(%q) = %v, %v, ожидали [%d]", test.spec, job, err, test.id)
+        }
+    }
+}
+
+func TestKill(t *testing.T) {
+    if _, err := exec.LookPath("sleep"); err != nil {
+        t.Skip("нет программы sleep")
+    }
+    var out, errOut bytes.Buffer
+    sh := New(Config{Env: []string{"PATH=" + os.Getenv("PATH")}, Dir: "/", Stdout: &out, Stderr: &errOut})
+
+    // сигнал процессу по PID: номером, именем и через -s
+    for _, opt := range []string{"-9", "-KILL", "-sigkill", "-s KILL", "-n 9"} {
+        cmd := exec.Command("sleep", "10")
+        if err := cmd.Start(); err != nil {
+            t.Fatal(err)
+        }
+        src := fmt.Sprintf("kill %s %d", opt, cmd.Process.Pid)
+        if status, err := sh.Run(src); status != 0 || err != nil {
+            t.Errorf("%q: код %d, ошибка %v, %s", src, status, err, errOut.String())
+        }
+        cmd.Wait()
+        if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); !ok || ws.Signal() != syscall.SIGKILL {
+            t.Errorf("%q: процесс завершился %v", src, cmd.ProcessState)
+        }
+    }
+
+    // сигнал заданию по спецификации
+    if _, err := sh.Run("sleep 10 &"); err != nil {
+        t.Fatal(err)
+    }
+    job, err := sh.jobs.find("%sleep")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if status, _ := sh.Run("kill -s INT %sleep"); status != 0 {
+        t.Errorf("kill %%sleep: код %d, %s", status, errOut.String())
+    }
+    if state, status := job.wait(); state != JobDone || status != 128+int(syscall.SIGINT) {
+        t.Errorf("задание после kill: %v, код %d", state, status)
+    }
+
+    failures := []struct {
+        src string
+        err string
+    }{
+        {"kill", "kill: использование"},
+        {"kill -s", "kill: -s: требуется аргумент"},
+        {"kill -BOGUS 1", "kill: BOGUS: неверная спецификация сигнала"},
+        {"kill %9", "kill: %9: нет такого задания"},
+        {"kill abc", "kill: abc: аргументы должны быть PID или заданиями"},
+    }
+    for _, test := range failures {
+        errOut.Reset()
+        if status, _ := sh.Run(test.src); status != 1 || !strings.Contains(errOut.String(), test.err) {
+            t.Errorf("%q: код %d, %q, ожидали %q", test.src, status, errOut.String(), test.err)
+        }
+    }
+
+    out.Reset()
+    if _, err := sh.Run("kill -l"); err != nil || !strings.Contains(out.String(), " 9) SIGKILL\n10) SIGUSR1") {
+        t.Errorf("kill -l: %v, %q", err, out.String())
+    }
+}
+
+func TestBackgroundInternal(t *testing.T) {
+    var out bytes.Buffer
+    fake := argsExecutor()
+    sh := New(Config{Env: []string{}, Dir: "/", Stdout: &out, Executor: fake})
+
+    // задания без внешних программ не ждут запуска процесса
+    src := "f() { echo f; }\necho a &\nX=1 &\nf &\nmissing$X &\nargs b &\n"
+    if status, err := sh.Run(src); status != 0 || err != nil {
+        t.Fatalf("код %d, ошибка %v", status, err)
+    }
+    for _, job := range sh.jobs.list() {
+        job.wait()
+    }
+    for _, line := range []string{"a\n", "f\n", "[b]\n"} {
+        if !strings.Contains(out.String(), line) {
+            t.Errorf("вывод %q без %q", out.String(), line)
+        }
+    }
+    if calls := fake.Calls(); len(calls) != 2 {
+        t.Errorf("запуски %v, ожидали missing и args", calls)
+    }
+}
+
+func TestExitWithStoppedJobs(t *testing.T) {
+    tests := []struct {
+        name   string
+        input  string
+        output string
+        warns  int
+    }{
+        {"конец ввода дважды", "", "exit\n", 1},
+        {"exit дважды", "exit\nexit\n", "", 1},
+        {"команда между exit", "exit\necho x\nexit\nexit\n", "x\n", 2},
+    }
+    for _, test := range tests {
+        var out, errOut bytes.Buffer
+        sh := New(Config{Env: []string{}, Dir: "/", Stdout: &out, Stderr: &errOut, Executor: NewFakeExecutor(nil)})
+        sh.jobs.add("sleep 10", false).stopped()
+
+        status := sh.RunLines(ReaderSource(strings.NewReader(test.input)), true)
+        warns := strings.Count(errOut.String(), "Есть остановленные задания.\n")
+        if status != 0 || out.String() != test.output || warns != test.warns {
+            t.Errorf("%s: код %d, вывод %q, предупреждений %d, ожидали %q и %d",
+                test.name, status, out.String(), warns, test.output, test.warns)
+        }
+    }
+}
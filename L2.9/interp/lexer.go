@@ -0,0 +1,312 @@
+package interp
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// errIncomplete означает, что ввод оборвался посреди конструкции
+// (незакрытая кавычка, if без fi и т.п.) и нужно дочитать строки
+var errIncomplete = errors.New("незавершенная команда")
+
+type tokenKind int
+
+const (
+    tokWord tokenKind = iota
+    tokOp
+    tokNewline
+    tokEOF
+)
+
+type token struct {
+    kind  tokenKind
+    op    string // для tokOp: "|", "||", "&", "&&", ";", "(", ")"
+    word  Word   // для tokWord
+    start int    // положение токена в исходном тексте, в рунах
+    end   int
+
+    aliases   []string // псевдонимы, из раскрытия которых получен токен
+    aliasNext bool     // предыдущий псевдоним кончался пробелом: слово тоже раскрывается
+}
+
+type partKind int
+
+const (
+    partLit partKind = iota // литеральный текст
+    partVar                 // подстановка переменной: $name, ${name}, $?
+)
+
+// wordPart - фрагмент слова; quoted означает, что фрагмент был
+// в кавычках или экранирован и не подлежит разбиению на слова
+type wordPart struct {
+    kind   partKind
+    text   string
+    quoted bool
+}
+
+// Word - слово командной строки до подстановок
+type Word []wordPart
+
+// literal возвращает текст слова, если оно целиком состоит
+// из литералов без кавычек - так распознаются ключевые слова
+func (w Word) literal() (string, bool) {
+    var b strings.Builder
+    for _, p := range w {
+        if p.kind != partLit || p.quoted {
+            return "", false
+        }
+        b.WriteString(p.text)
+    }
+    return b.String(), true
+}
+
+// lexer разбивает исходный текст на токены
+type lexer struct {
+    src []rune
+    pos int
+}
+
+func tokenize(src string) ([]token, error) {
+    l := &lexer{src: []rune(src)}
+    var tokens []token
+    for {
+        tok, err := l.next()
+        if err != nil {
+            return nil, err
+        }
+        tok.end = l.pos
+        tokens = append(tokens, tok)
+        if tok.kind == tokEOF {
+            return tokens, nil
+        }
+    }
+}
+
+func (l *lexer) peek(offset int) rune {
+    if l.pos+offset < len(l.src) {
+        return l.src[l.pos+offset]
+    }
+    return 0
+}
+
+func isMeta(r rune) bool {
+    switch r {
+    case ' ', '\t', '\n', '|', '&', ';', '(', ')', '<', '>':
+        return true
+    }
+    return false
+}
+
+func (l *lexer) next() (token, error) {
+    // Пропускаем пробелы, комментарии и продолжения строк
+    for l.pos < len(l.src) {
+        r := l.src[l.pos]
+        if r == ' ' || r == '\t' {
+            l.pos++
+        } else if r == '\\' && l.peek(1) == '\n' {
+            if l.pos+2 == len(l.src) {
+                return token{}, errIncomplete
+            }
+            l.pos += 2
+        } else if r == '#' {
+            for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+                l.pos++
+            }
+        } else {
+            break
+        }
+    }
+    start := l.pos
+    if l.pos >= len(l.src) {
+        return token{kind: tokEOF, start: start}, nil
+    }
+
+    r := l.src[l.pos]
+    switch r {
+    case '\n':
+        l.pos++
+        return token{kind: tokNewline, start: start}, nil
+    case '|', '&':
+        if l.peek(1) == r {
+            l.pos += 2
+            return token{kind: tokOp, op: string([]rune{r, r}), start: start}, nil
+        }
+        l.pos++
+        return token{kind: tokOp, op: string(r), start: start}, nil
+    case ';', '(', ')':
+        l.pos++
+        return token{kind: tokOp, op: string(r), start: start}, nil
+    case '<', '>':
+        return token{}, fmt.Errorf("синтаксическая ошибка: перенаправления не поддерживаются")
+    }
+
+    word, err := l.readWord()
+    if err != nil {
+        return token{}, err
+    }
+    return token{kind: tokWord, word: word, start: start}, nil
+}
+
+// readWord читает слово до ближайшего метасимвола вне кавычек
+func (l *lexer) readWord() (Word, error) {
+    var word Word
+    var lit strings.Builder
+    flush := func(quoted bool) {
+        if lit.Len() > 0 {
+            word = append(word, wordPart{kind: partLit, text: lit.String(), quoted: quoted})
+            lit.Reset()
+        }
+    }
+
+    for l.pos < len(l.src) && !isMeta(l.src[l.pos]) {
+        r := l.src[l.pos]
+        switch r {
+        case '\'':
+            flush(false)
+            end := l.pos + 1
+            for end < len(l.src) && l.src[end] != '\'' {
+                end++
+            }
+            if end >= len(l.src) {
+                return nil, errIncomplete
+            }
+            word = append(word, wordPart{kind: partLit, text: string(l.src[l.pos+1 : end]), quoted: true})
+            l.pos = end + 1
+        case '"':
+            flush(false)
+            l.pos++
+            if err := l.readDoubleQuoted(&word); err != nil {
+                return nil, err
+            }
+        case '\\':
+            if l.pos+1 >= len(l.src) {
+                return nil, errIncomplete
+            }
+            if l.src[l.pos+1] == '\n' {
+                if l.pos+2 == len(l.src) {
+                    return nil, errIncomplete
+                }
+                l.pos += 2
+                continue
+            }
+            flush(false)
+            word = append(word, wordPart{kind: partLit, text: string(l.src[l.pos+1]), quoted: true})
+            l.pos += 2
+        case '$':
+            if part, ok := l.readVar(false); ok {
+                flush(false)
+                word = append(word, part)
+                continue
+            }
+            lit.WriteRune(r)
+            l.pos++
+        default:
+            lit.WriteRune(r)
+            l.pos++
+        }
+    }
+    flush(false)
+    return word, nil
+}
+
+// readDoubleQuoted читает содержимое двойных кавычек после открывающей "
+func (l *lexer) readDoubleQuoted(word *Word) error {
+    var lit strings.Builder
+    start := len(*word)
+    flush := func() {
+        if lit.Len() > 0 {
+            *word = append(*word, wordPart{kind: partLit, text: lit.String(), quoted: true})
+            lit.Reset()
+        }
+    }
+
+    for l.pos < len(l.src) {
+        r := l.src[l.pos]
+        switch r {
+        case '"':
+            flush()
+            l.pos++
+            // Пустые кавычки "" все равно дают слово, пусть и пустое
+            if len(*word) == start {
+                *word = append(*word, wordPart{kind: partLit, quoted: true})
+            }
+            return nil
+        case '\\':
+            next := l.peek(1)
+            switch next {
+            case '$', '"', '\\', '`':
+                lit.WriteRune(next)
+                l.pos += 2
+            case '\n':
+                l.pos += 2
+            default:
+                lit.WriteRune(r)
+                l.pos++
+            }
+        case '$':
+            if part, ok := l.readVar(true); ok {
+                flush()
+                *word = append(*word, part)
+                continue
+            }
+            lit.WriteRune(r)
+            l.pos++
+        default:
+            lit.WriteRune(r)
+            l.pos++
+        }
+    }
+    return errIncomplete
+}
+
+// readVar разбирает подстановку переменной, начинающуюся с $
+func (l *lexer) readVar(quoted bool) (wordPart, bool) {
+    next := l.peek(1)
+    switch {
+    case next == '{':
+        end := l.pos + 2
+        for end < len(l.src) && l.src[end] != '}' {
+            end++
+        }
+        if end >= len(l.src) {
+            return wordPart{}, false
+        }
+        name := string(l.src[l.pos+2 : end])
+        l.pos = end + 1
+        return wordPart{kind: partVar, text: name, quoted: quoted}, true
+    case strings.ContainsRune("?#$@*!", next) || (next >= '0' && next <= '9'):
+        l.pos += 2
+        return wordPart{kind: partVar, text: string(next), quoted: quoted}, true
+    case isNameStart(next):
+        end := l.pos + 1
+        for end < len(l.src) && isNameChar(l.src[end]) {
+            end++
+        }
+        name := string(l.src[l.pos+1 : end])
+        l.pos = end
+        return wordPart{kind: partVar, text: name, quoted: quoted}, true
+    }
+    return wordPart{}, false
+}
+
+func isNameStart(r rune) bool {
+    return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isNameChar(r rune) bool {
+    return isNameStart(r) || (r >= '0' && r <= '9')
+}
+
+// isName проверяет, что строка - допустимое имя переменной или функции
+func isName(s string) bool {
+    if s == "" {
+        return false
+    }
+    for i, r := range s {
+        if i == 0 && !isNameStart(r) || !isNameChar(r) {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,514 @@
+package interp
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Command - узел синтаксического дерева, который можно выполнить:
+// *SimpleCommand, *IfClause, *WhileClause, *ForClause, *FuncDef или *BraceGroup
+type Command interface{}
+
+// List - последовательность команд, разделенных ";" или переводом строки
+type List []*AndOr
+
+// AndOr - цепочка конвейеров, связанных && и ||.
+// Background означает запуск в фоне (завершается символом &).
+type AndOr struct {
+    First      *Pipeline
+    Rest       []AndOrPart
+    Background bool
+    Text       string // исходный текст, для вывода в jobs
+}
+
+type AndOrPart struct {
+    Op       string // "&&" или "||"
+    Pipeline *Pipeline
+}
+
+// Pipeline - команды, соединенные через |
+type Pipeline struct {
+    Negate   bool
+    Commands []Command
+    Text     string
+}
+
+// Assign - присваивание NAME=value перед командой
+type Assign struct {
+    Name  string
+    Value Word
+}
+
+type SimpleCommand struct {
+    Assigns []Assign
+    Args    []Word
+}
+
+// IfClause - if/elif/else; elif разворачивается во вложенный IfClause в Else
+type IfClause struct {
+    Cond List
+    Then List
+    Else List
+}
+
+type WhileClause struct {
+    Cond List
+    Body List
+}
+
+type ForClause struct {
+    Var   string
+    Items []Word
+    InSet bool // false - перебираются позиционные параметры
+    Body  List
+}
+
+type FuncDef struct {
+    Name string
+    Body Command
+}
+
+type BraceGroup struct {
+    Body List
+}
+
+// parser - разбор токенов методом рекурсивного спуска
+type parser struct {
+    src     []rune
+    tokens  []token
+    pos     int
+    lastEnd int // конец последнего прочитанного токена
+    aliases map[string]string
+}
+
+// Parse разбирает исходный текст в список команд, раскрывая псевдонимы
+// из aliases. Если текст оборвался посреди конструкции, возвращает errIncomplete.
+func Parse(src string, aliases map[string]string) (List, error) {
+    tokens, err := tokenize(src)
+    if err != nil {
+        return nil, err
+    }
+    p := &parser{src: []rune(src), tokens: tokens, aliases: aliases}
+    list, err := p.parseList()
+    if err != nil {
+        return nil, err
+    }
+    if tok := p.peek(); tok.kind != tokEOF {
+        return nil, p.unexpected(tok)
+    }
+    return list, nil
+}
+
+func (p *parser) peek() token {
+    return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+    tok := p.tokens[p.pos]
+    if tok.kind != tokEOF {
+        p.pos++
+        p.lastEnd = tok.end
+    }
+    return tok
+}
+
+// keyword возвращает ключевое слово, если текущий токен им является
+func (p *parser) keyword() string {
+    tok := p.peek()
+    if tok.kind != tokWord {
+        return ""
+    }
+    s, ok := tok.word.literal()
+    if !ok {
+        return ""
+    }
+    switch s {
+    case "if", "then", "elif", "else", "fi", "while", "do", "done",
+        "for", "in", "function", "{", "}", "!":
+        return s
+    }
+    return ""
+}
+
+func (p *parser) isOp(op string) bool {
+    tok := p.peek()
+    return tok.kind == tokOp && tok.op == op
+}
+
+func (p *parser) unexpected(tok token) error {
+    if tok.kind == tokEOF {
+        return errIncomplete
+    }
+    var text string
+    switch tok.kind {
+    case tokNewline:
+        text = "newline"
+    case tokOp:
+        text = tok.op
+    default:
+        text, _ = tok.word.literal()
+    }
+    return fmt.Errorf("синтаксическая ошибка рядом с неожиданным токеном `%s'", text)
+}
+
+// skipNewlines пропускает пустые строки
+func (p *parser) skipNewlines() {
+    for p.peek().kind == tokNewline {
+        p.advance()
+    }
+}
+
+// expect потребляет обязательное ключевое слово
+func (p *parser) expect(kw string) error {
+    p.skipNewlines()
+    if p.keyword() != kw {
+        return p.unexpected(p.peek())
+    }
+    p.advance()
+    return nil
+}
+
+// isListEnd сообщает, что список команд закончился: дальше
+// закрывающее ключевое слово, ")" или конец ввода
+func (p *parser) isListEnd() bool {
+    if p.peek().kind == tokEOF || p.isOp(")") {
+        return true
+    }
+    switch p.keyword() {
+    case "then", "elif", "else", "fi", "do", "done", "}":
+        return true
+    }
+    return false
+}
+
+func (p *parser) parseList() (List, error) {
+    var list List
+    for {
+        for p.peek().kind == tokNewline || p.isOp(";") {
+            if p.isOp(";") && len(list) == 0 {
+                return nil, p.unexpected(p.peek())
+            }
+            p.advance()
+        }
+        if p.isListEnd() {
+            return list, nil
+        }
+
+        item, err := p.parseAndOr()
+        if err != nil {
+            return nil, err
+        }
+        list = append(list, item)
+
+        if p.isOp("&") {
+            p.advance()
+            item.Background = true
+            continue
+        }
+        if tok := p.peek(); tok.kind != tokNewline && !p.isOp(";") && !p.isListEnd() {
+            return nil, p.unexpected(tok)
+        }
+    }
+}
+
+// text возвращает исходный текст от позиции start до последнего прочитанного токена
+func (p *parser) text(start int) string {
+    return string(p.src[start:p.lastEnd])
+}
+
+func (p *parser) parseAndOr() (*AndOr, error) {
+    start := p.peek().start
+    first, err := p.parsePipeline()
+    if err != nil {
+        return nil, err
+    }
+    result := &AndOr{First: first}
+    for p.isOp("&&") || p.isOp("||") {
+        op := p.advance().op
+        p.skipNewlines()
+        next, err := p.parsePipeline()
+        if err != nil {
+            return nil, err
+        }
+        result.Rest = append(result.Rest, AndOrPart{Op: op, Pipeline: next})
+    }
+    result.Text = p.text(start)
+    return result, nil
+}
+
+func (p *parser) parsePipeline() (*Pipeline, error) {
+    start := p.peek().start
+    pipeline := &Pipeline{}
+    if p.keyword() == "!" {
+        p.advance()
+        pipeline.Negate = true
+    }
+    for {
+        cmd, err := p.parseCommand()
+        if err != nil {
+            return nil, err
+        }
+        pipeline.Commands = append(pipeline.Commands, cmd)
+        if !p.isOp("|") {
+            pipeline.Text = p.text(start)
+            return pipeline, nil
+        }
+        p.advance()
+        p.skipNewlines()
+    }
+}
+
+// expandAlias заменяет текущее слово значением псевдонима. Псевдоним
+// не раскрывается повторно внутри собственного значения, поэтому
+// alias ls='ls -F' не зацикливается.
+func (p *parser) expandAlias() error {
+    for {
+        tok := p.peek()
+        if tok.kind != tokWord {
+            return nil
+        }
+        name, ok := tok.word.literal()
+        if !ok {
+            return nil
+        }
+        value, found := p.aliases[name]
+        if !found {
+            return nil
+        }
+        for _, a := range tok.aliases {
+            if a == name {
+                return nil
+            }
+        }
+
+        expansion, err := tokenize(value)
+        if err != nil {
+            return fmt.Errorf("%s: ошибка в псевдониме: %v", name, err)
+        }
+        expansion = expansion[:len(expansion)-1] // без tokEOF
+        chain := append(append([]string{}, tok.aliases...), name)
+        for i := range expansion {
+            expansion[i].start, expansion[i].end = tok.start, tok.end
+            expansion[i].aliases = chain
+        }
+
+        rest := p.tokens[p.pos+1:]
+        if strings.HasSuffix(value, " ") || strings.HasSuffix(value, "\t") {
+            rest[0].aliasNext = true
+        }
+        tokens := append(append(append([]token{}, p.tokens[:p.pos]...), expansion...), rest...)
+        p.tokens = tokens
+    }
+}
+
+func (p *parser) parseCommand() (Command, error) {
+    if err := p.expandAlias(); err != nil {
+        return nil, err
+    }
+    switch p.keyword() {
+    case "if":
+        return p.parseIf()
+    case "while":
+        return p.parseWhile()
+    case "for":
+        return p.parseFor()
+    case "{":
+        return p.parseBraceGroup()
+    case "function":
+        p.advance()
+        return p.parseFuncDef(true)
+    }
+
+    tok := p.peek()
+    if tok.kind != tokWord {
+        return nil, p.unexpected(tok)
+    }
+    if p.keyword() != "" {
+        return nil, p.unexpected(tok)
+    }
+
+    // NAME() { ... } - определение функции
+    if name, ok := tok.word.literal(); ok && isName(name) &&
+        p.tokens[p.pos+1].kind == tokOp && p.tokens[p.pos+1].op == "(" {
+        return p.parseFuncDef(false)
+    }
+    return p.parseSimpleCommand()
+}
+
+func (p *parser) parseSimpleCommand() (*SimpleCommand, error) {
+    cmd := &SimpleCommand{}
+    for p.peek().kind == tokWord {
+        if p.peek().aliasNext {
+            if err := p.expandAlias(); err != nil {
+                return nil, err
+            }
+            if p.peek().kind != tokWord {
+                break
+            }
+        }
+        word := p.advance().word
+        if len(cmd.Args) == 0 {
+            if assign, ok := parseAssign(word); ok {
+                cmd.Assigns = append(cmd.Assigns, assign)
+                continue
+            }
+        }
+        cmd.Args = append(cmd.Args, word)
+    }
+    return cmd, nil
+}
+
+// parseAssign распознает слово вида NAME=value
+func parseAssign(word Word) (Assign, bool) {
+    if len(word) == 0 || word[0].kind != partLit || word[0].quoted {
+        return Assign{}, false
+    }
+    eq := strings.IndexByte(word[0].text, '=')
+    if eq <= 0 || !isName(word[0].text[:eq]) {
+        return Assign{}, false
+    }
+
+    value := Word{}
+    if rest := word[0].text[eq+1:]; rest != "" {
+        value = append(value, wordPart{kind: partLit, text: rest})
+    }
+    value = append(value, word[1:]...)
+    return Assign{Name: word[0].text[:eq], Value: value}, true
+}
+
+func (p *parser) parseIf() (*IfClause, error) {
+    p.advance() // if или elif
+    cond, err := p.parseList()
+    if err != nil {
+        return nil, err
+    }
+    if err := p.expect("then"); err != nil {
+        return nil, err
+    }
+    body, err := p.parseList()
+    if err != nil {
+        return nil, err
+    }
+    clause := &IfClause{Cond: cond, Then: body}
+
+    switch p.keyword() {
+    case "elif":
+        nested, err := p.parseIf()
+        if err != nil {
+            return nil, err
+        }
+        clause.Else = List{{First: &Pipeline{Commands: []Command{nested}}}}
+        return clause, nil
+    case "else":
+        p.advance()
+        if clause.Else, err = p.parseList(); err != nil {
+            return nil, err
+        }
+    }
+    if err := p.expect("fi"); err != nil {
+        return nil, err
+    }
+    return clause, nil
+}
+
+func (p *parser) parseWhile() (*WhileClause, error) {
+    p.advance()
+    cond, err := p.parseList()
+    if err != nil {
+        return nil, err
+    }
+    body, err := p.parseDoGroup()
+    if err != nil {
+        return nil, err
+    }
+    return &WhileClause{Cond: cond, Body: body}, nil
+}
+
+// parseDoGroup разбирает "do список done"
+func (p *parser) parseDoGroup() (List, error) {
+    if err := p.expect("do"); err != nil {
+        return nil, err
+    }
+    body, err := p.parseList()
+    if err != nil {
+        return nil, err
+    }
+    if err := p.expect("done"); err != nil {
+        return nil, err
+    }
+    return body, nil
+}
+
+func (p *parser) parseFor() (*ForClause, error) {
+    p.advance()
+    tok := p.advance()
+    name, ok := tok.word.literal()
+    if tok.kind != tokWord || !ok || !isName(name) {
+        return nil, p.unexpected(tok)
+    }
+    clause := &ForClause{Var: name}
+
+    p.skipNewlines()
+    if p.keyword() == "in" {
+        p.advance()
+        clause.InSet = true
+        for p.peek().kind == tokWord {
+            clause.Items = append(clause.Items, p.advance().word)
+        }
+        if tok := p.peek(); tok.kind != tokNewline && !p.isOp(";") {
+            return nil, p.unexpected(tok)
+        }
+        p.advance()
+    } else if p.isOp(";") {
+        p.advance()
+    }
+
+    body, err := p.parseDoGroup()
+    if err != nil {
+        return nil, err
+    }
+    clause.Body = body
+    return clause, nil
+}
+
+func (p *parser) parseBraceGroup() (*BraceGroup, error) {
+    p.advance()
+    body, err := p.parseList()
+    if err != nil {
+        return nil, err
+    }
+    if err := p.expect("}"); err != nil {
+        return nil, err
+    }
+    return &BraceGroup{Body: body}, nil
+}
+
+// parseFuncDef разбирает "name() тело" или, после function, "name [()] тело"
+func (p *parser) parseFuncDef(keyword bool) (*FuncDef, error) {
+    tok := p.advance()
+    name, ok := tok.word.literal()
+    if tok.kind != tokWord || !ok || !isName(name) {
+        return nil, p.unexpected(tok)
+    }
+
+    if p.isOp("(") {
+        p.advance()
+        if !p.isOp(")") {
+            return nil, p.unexpected(p.peek())
+        }
+        p.advance()
+    } else if !keyword {
+        return nil, p.unexpected(p.peek())
+    }
+
+    p.skipNewlines()
+    switch p.keyword() {
+    case "{", "if", "while", "for":
+        body, err := p.parseCommand()
+        if err != nil {
+            return nil, err
+        }
+        return &FuncDef{Name: name, Body: body}, nil
+    }
+    return nil, p.unexpected(p.peek())
+}
@@ -0,0 +1,260 @@
+package interp
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "os"
+    "os/user"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// procRoot - точка монтирования procfs; тесты подменяют ее каталогом
+// с поддельными файлами
+var procRoot = "/proc"
+
+// clockTicks - единица времени в /proc/<pid>/stat (USER_HZ).
+// В Linux она равна 100 на всех распространенных архитектурах.
+const clockTicks = 100
+
+// procInfo - сведения о процессе, прочитанные из /proc/<pid>
+type procInfo struct {
+    PID, PPID   int
+    PGID, SID   int
+    TPGID       int // группа процессов переднего плана терминала
+    TTY         int // номер устройства управляющего терминала, 0 - нет
+    UID         int
+    User        string
+    State       byte // R, S, D, T, Z...
+    Nice        int
+    Threads     int
+    Comm        string
+    Args        []string // пусто у потоков ядра и зомби
+    CPUTicks    uint64   // utime + stime
+    StartTicks  uint64   // время запуска в тиках от загрузки системы
+    VSZ, RSS    uint64   // память в КиБ
+    CPU, Memory float64  // доли процессора и памяти в процентах
+}
+
+// sysInfo - общие сведения о системе для расчета процентов и заголовка top
+type sysInfo struct {
+    Uptime       float64 // секунды с загрузки
+    BootTime     int64   // время загрузки, секунды Unix
+    Load         [3]float64
+    MemTotal     uint64 // КиБ
+    MemFree      uint64
+    MemAvailable uint64
+}
+
+func readSysInfo() (*sysInfo, error) {
+    sys := &sysInfo{}
+
+    data, err := os.ReadFile(filepath.Join(procRoot, "uptime"))
+    if err != nil {
+        return nil, err
+    }
+    if _, err := fmt.Sscan(string(data), &sys.Uptime); err != nil {
+        return nil, fmt.Errorf("uptime: %v", err)
+    }
+
+    if data, err := os.ReadFile(filepath.Join(procRoot, "loadavg")); err == nil {
+        fmt.Sscan(string(data), &sys.Load[0], &sys.Load[1], &sys.Load[2])
+    }
+
+    if data, err := os.ReadFile(filepath.Join(procRoot, "stat")); err == nil {
+        for _, line := range strings.Split(string(data), "\n") {
+            if value, ok := strings.CutPrefix(line, "btime "); ok {
+                sys.BootTime, _ = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+                break
+            }
+        }
+    }
+
+    file, err := os.Open(filepath.Join(procRoot, "meminfo"))
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) < 2 {
+            continue
+        }
+        value, _ := strconv.ParseUint(fields[1], 10, 64)
+        switch fields[0] {
+        case "MemTotal:":
+            sys.MemTotal = value
+        case "MemFree:":
+            sys.MemFree = value
+        case "MemAvailable:":
+            sys.MemAvailable = value
+        }
+    }
+    return sys, scanner.Err()
+}
+
+// readProcs читает все процессы системы, упорядоченные по PID.
+// Процессы, завершившиеся во время чтения, пропускаются.
+func readProcs(sys *sysInfo) ([]*procInfo, error) {
+    entries, err := os.ReadDir(procRoot)
+    if err != nil {
+        return nil, err
+    }
+    users := make(map[int]string)
+
+    var procs []*procInfo
+    for _, entry := range entries {
+        pid, err := strconv.Atoi(entry.Name())
+        if err != nil || !entry.IsDir() {
+            continue
+        }
+        p, err := readProc(pid)
+        if err != nil {
+            continue
+        }
+
+        name, ok := users[p.UID]
+        if !ok {
+            name = strconv.Itoa(p.UID)
+            if u, err := user.LookupId(name); err == nil {
+                name = u.Username
+            }
+            users[p.UID] = name
+        }
+        p.User = name
+
+        if elapsed := sys.Uptime - float64(p.StartTicks)/clockTicks; elapsed > 0 {
+            p.CPU = float64(p.CPUTicks) / clockTicks / elapsed * 100
+        }
+        if sys.MemTotal > 0 {
+            p.Memory = float64(p.RSS) / float64(sys.MemTotal) * 100
+        }
+        procs = append(procs, p)
+    }
+    sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+    return procs, nil
+}
+
+// readProc читает stat, status и cmdline одного процесса
+func readProc(pid int) (*procInfo, error) {
+    dir := filepath.Join(procRoot, strconv.Itoa(pid))
+
+    data, err := os.ReadFile(filepath.Join(dir, "stat"))
+    if err != nil {
+        return nil, err
+    }
+    p, err := parseStat(string(data))
+    if err != nil {
+        return nil, fmt.Errorf("%s/stat: %v", dir, err)
+    }
+
+    // Uid: реальный эффективный сохраненный файловый
+    if data, err := os.ReadFile(filepath.Join(dir, "status")); err == nil {
+        for _, line := range strings.Split(string(data), "\n") {
+            if value, ok := strings.CutPrefix(line, "Uid:"); ok {
+                if fields := strings.Fields(value); len(fields) > 1 {
+                    p.UID, _ = strconv.Atoi(fields[1])
+                }
+                break
+            }
+        }
+    }
+
+    if data, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(data) > 0 {
+        data = bytes.TrimRight(data, "\x00")
+        p.Args = strings.Split(string(data), "\x00")
+    }
+    return p, nil
+}
+
+// parseStat разбирает /proc/<pid>/stat. Имя команды стоит в скобках
+// и само может содержать пробелы и скобки, поэтому поля отсчитываются
+// от последней ")".
+func parseStat(stat string) (*procInfo, error) {
+    open := strings.IndexByte(stat, '(')
+    end := strings.LastIndexByte(stat, ')')
+    if open < 0 || end < open {
+        return nil, fmt.Errorf("неверный формат")
+    }
+    fields := strings.Fields(stat[end+1:])
+    if len(fields) < 22 || len(fields[0]) != 1 {
+        return nil, fmt.Errorf("неверный формат")
+    }
+
+    p := &procInfo{Comm: stat[open+1 : end], State: fields[0][0]}
+    var err error
+    if p.PID, err = strconv.Atoi(strings.TrimSpace(stat[:open])); err != nil {
+        return nil, err
+    }
+
+    num := func(i int) int64 {
+        n, _ := strconv.ParseInt(fields[i], 10, 64)
+        return n
+    }
+    p.PPID = int(num(1))
+    p.PGID = int(num(2))
+    p.SID = int(num(3))
+    p.TTY = int(num(4))
+    p.TPGID = int(num(5))
+    p.CPUTicks = uint64(num(11) + num(12))
+    p.Nice = int(num(16))
+    p.Threads = int(num(17))
+    p.StartTicks = uint64(num(19))
+    p.VSZ = uint64(num(20)) / 1024
+    p.RSS = uint64(num(21)) * uint64(os.Getpagesize()) / 1024
+    return p, nil
+}
+
+// ttyName возвращает имя терминала по номеру устройства из stat
+func ttyName(dev int) string {
+    if dev == 0 {
+        return "?"
+    }
+    major := (dev >> 8) & 0xfff
+    minor := (dev & 0xff) | ((dev >> 12) & 0xfff00)
+    switch {
+    case major >= 136 && major <= 143:
+        return fmt.Sprintf("pts/%d", minor+(major-136)*256)
+    case major == 4 && minor < 64:
+        return fmt.Sprintf("tty%d", minor)
+    case major == 4:
+        return fmt.Sprintf("ttyS%d", minor-64)
+    }
+    return fmt.Sprintf("%d,%d", major, minor)
+}
+
+// stat возвращает состояние процесса с признаками как в ps:
+// < - высокий приоритет, N - низкий, s - лидер сессии,
+// l - многопоточный, + - в группе переднего плана
+func (p *procInfo) stat() string {
+    s := string(p.State)
+    switch {
+    case p.Nice < 0:
+        s += "<"
+    case p.Nice > 0:
+        s += "N"
+    }
+    if p.PID == p.SID {
+        s += "s"
+    }
+    if p.Threads > 1 {
+        s += "l"
+    }
+    if p.TPGID > 0 && p.PGID == p.TPGID {
+        s += "+"
+    }
+    return s
+}
+
+// command возвращает командную строку процесса, а для потоков
+// ядра и зомби - имя в квадратных скобках
+func (p *procInfo) command() string {
+    if len(p.Args) == 0 {
+        return "[" + p.Comm + "]"
+    }
+    return strings.Join(p.Args, " ")
+}
@@ -0,0 +1,630 @@
+package interp
+
+import (
+    "cmp"
+    "fmt"
+    "io"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// psColumn - столбец вывода ps и top
+type psColumn struct {
+    header string
+    right  bool // числа выравниваются по правому краю
+    value  func(p *procInfo, sys *sysInfo) string
+    cmp    func(a, b *procInfo) int
+}
+
+func intColumn(header string, field func(p *procInfo) int) *psColumn {
+    return &psColumn{
+        header: header,
+        right:  true,
+        value:  func(p *procInfo, _ *sysInfo) string { return strconv.Itoa(field(p)) },
+        cmp:    func(a, b *procInfo) int { return cmp.Compare(field(a), field(b)) },
+    }
+}
+
+func kbColumn(header string, field func(p *procInfo) uint64) *psColumn {
+    return &psColumn{
+        header: header,
+        right:  true,
+        value:  func(p *procInfo, _ *sysInfo) string { return strconv.FormatUint(field(p), 10) },
+        cmp:    func(a, b *procInfo) int { return cmp.Compare(field(a), field(b)) },
+    }
+}
+
+func percentColumn(header string, field func(p *procInfo) float64) *psColumn {
+    return &psColumn{
+        header: header,
+        right:  true,
+        value:  func(p *procInfo, _ *sysInfo) string { return strconv.FormatFloat(field(p), 'f', 1, 64) },
+        cmp:    func(a, b *procInfo) int { return cmp.Compare(field(a), field(b)) },
+    }
+}
+
+func textColumn(header string, field func(p *procInfo) string) *psColumn {
+    return &psColumn{
+        header: header,
+        value:  func(p *procInfo, _ *sysInfo) string { return field(p) },
+        cmp:    func(a, b *procInfo) int { return strings.Compare(field(a), field(b)) },
+    }
+}
+
+// psColumns - столбцы, которые можно выбрать через ps -o и --sort
+var psColumns = map[string]*psColumn{
+    "pid":   intColumn("PID", func(p *procInfo) int { return p.PID }),
+    "ppid":  intColumn("PPID", func(p *procInfo) int { return p.PPID }),
+    "pgid":  intColumn("PGID", func(p *procInfo) int { return p.PGID }),
+    "sid":   intColumn("SID", func(p *procInfo) int { return p.SID }),
+    "uid":   intColumn("UID", func(p *procInfo) int { return p.UID }),
+    "ni":    intColumn("NI", func(p *procInfo) int { return p.Nice }),
+    "nlwp":  intColumn("NLWP", func(p *procInfo) int { return p.Threads }),
+    "user":  textColumn("USER", func(p *procInfo) string { return p.User }),
+    "tty":   textColumn("TTY", func(p *procInfo) string { return ttyName(p.TTY) }),
+    "stat":  textColumn("STAT", (*procInfo).stat),
+    "s":     textColumn("S", func(p *procInfo) string { return string(p.State) }),
+    "comm":  textColumn("COMMAND", func(p *procInfo) string { return p.Comm }),
+    "args":  textColumn("COMMAND", (*procInfo).command),
+    "pcpu":  percentColumn("%CPU", func(p *procInfo) float64 { return p.CPU }),
+    "pmem":  percentColumn("%MEM", func(p *procInfo) float64 { return p.Memory }),
+    "vsz":   kbColumn("VSZ", func(p *procInfo) uint64 { return p.VSZ }),
+    "rss":   kbColumn("RSS", func(p *procInfo) uint64 { return p.RSS }),
+    "time":  cpuTimeColumn(),
+    "start": startColumn(),
+    "etime": elapsedColumn(),
+}
+
+// psColumnAliases - другие имена столбцов, принятые в procps
+var psColumnAliases = map[string]string{
+    "%cpu":    "pcpu",
+    "%mem":    "pmem",
+    "command": "args",
+    "cmd":     "args",
+    "state":   "s",
+    "ucmd":    "comm",
+    "tname":   "tty",
+    "thcount": "nlwp",
+    "nice":    "ni",
+    "rssize":  "rss",
+    "vsize":   "vsz",
+    "cputime": "time",
+    "stime":   "start",
+}
+
+func cpuTimeColumn() *psColumn {
+    return &psColumn{
+        header: "TIME",
+        right:  true,
+        value: func(p *procInfo, _ *sysInfo) string {
+            seconds := p.CPUTicks / clockTicks
+            return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+        },
+        cmp: func(a, b *procInfo) int { return cmp.Compare(a.CPUTicks, b.CPUTicks) },
+    }
+}
+
+func startColumn() *psColumn {
+    return &psColumn{
+        header: "START",
+        value: func(p *procInfo, sys *sysInfo) string {
+            start := time.Unix(sys.BootTime+int64(p.StartTicks/clockTicks), 0)
+            if time.Since(start) < 24*time.Hour {
+                return start.Format("15:04")
+            }
+            return start.Format("Jan02")
+        },
+        cmp: func(a, b *procInfo) int { return cmp.Compare(a.StartTicks, b.StartTicks) },
+    }
+}
+
+// elapsedColumn выводит время с запуска процесса как [[ДД-]ЧЧ:]ММ:СС
+func elapsedColumn() *psColumn {
+    return &psColumn{
+        header: "ELAPSED",
+        right:  true,
+        value: func(p *procInfo, sys *sysInfo) string {
+            elapsed := int64(sys.Uptime) - int64(p.StartTicks/clockTicks)
+            if elapsed < 0 {
+                elapsed = 0
+            }
+            days, hours := elapsed/86400, elapsed/3600%24
+            minutes, seconds := elapsed/60%60, elapsed%60
+            switch {
+            case days > 0:
+                return fmt.Sprintf("%d-%02d:%02d:%02d", days, hours, minutes, seconds)
+            case hours > 0:
+                return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
+            }
+            return fmt.Sprintf("%02d:%02d", minutes, seconds)
+        },
+        cmp: func(a, b *procInfo) int { return cmp.Compare(b.StartTicks, a.StartTicks) },
+    }
+}
+
+// lookupColumn находит столбец по имени или его синониму
+func lookupColumn(name string) (*psColumn, error) {
+    name = strings.ToLower(name)
+    if alias, ok := psColumnAliases[name]; ok {
+        name = alias
+    }
+    col, ok := psColumns[name]
+    if !ok {
+        return nil, fmt.Errorf("%s: неизвестный столбец", name)
+    }
+    return col, nil
+}
+
+// psSortKey - ключ сортировки: столбец и направление
+type psSortKey struct {
+    col  *psColumn
+    desc bool
+}
+
+// procFilter отбирает процессы по PID, родителю, пользователю и имени
+// команды. Пустой фильтр пропускает все процессы.
+type procFilter struct {
+    pids  map[int]bool
+    ppids map[int]bool
+    users map[string]bool // имена или числовые UID
+    comms map[string]bool
+}
+
+func (f *procFilter) match(p *procInfo) bool {
+    if len(f.pids) > 0 && !f.pids[p.PID] {
+        return false
+    }
+    if len(f.ppids) > 0 && !f.ppids[p.PPID] {
+        return false
+    }
+    if len(f.users) > 0 && !f.users[p.User] && !f.users[strconv.Itoa(p.UID)] {
+        return false
+    }
+    if len(f.comms) > 0 && !f.comms[p.Comm] {
+        return false
+    }
+    return true
+}
+
+// psOptions - разобранные аргументы ps и top
+type psOptions struct {
+    columns   []*psColumn
+    sort      []psSortKey
+    filter    procFilter
+    noHeaders bool
+    batch     bool          // top: без очистки экрана
+    delay     time.Duration // top: пауза между обновлениями
+    frames    int           // top: число обновлений, 0 - пока не прервут
+    lines     int           // top: сколько процессов показывать
+}
+
+// psDefault - столбцы ps без -o, как у ps aux
+const psDefault = "user,pid,pcpu,pmem,vsz,rss,tty,stat,start,time,args"
+
+// topDefault - столбцы top
+const topDefault = "pid,user,ni,s,pcpu,pmem,rss,time,comm"
+
+// addColumns добавляет столбцы из списка -o. Как в procps, "столбец=заголовок"
+// задает заголовок последнему столбцу списка до конца аргумента, а "pid="
+// оставляет столбец без заголовка.
+func (o *psOptions) addColumns(list string) error {
+    names, header, renamed := strings.Cut(list, "=")
+    fields := splitList(names)
+    if renamed && len(fields) == 0 {
+        return fmt.Errorf("%s: не указан столбец", list)
+    }
+    for i, name := range fields {
+        col, err := lookupColumn(name)
+        if err != nil {
+            return err
+        }
+        if renamed && i == len(fields)-1 {
+            named := *col
+            named.header = header
+            col = &named
+        }
+        o.columns = append(o.columns, col)
+    }
+    return nil
+}
+
+func (o *psOptions) addSort(list string) error {
+    for _, name := range splitList(list) {
+        key := psSortKey{}
+        switch name[0] {
+        case '-':
+            key.desc, name = true, name[1:]
+        case '+':
+            name = name[1:]
+        }
+        col, err := lookupColumn(name)
+        if err != nil {
+            return err
+        }
+        key.col = col
+        o.sort = append(o.sort, key)
+    }
+    return nil
+}
+
+// splitList разбирает список через запятые или пробелы, как в -o и -p
+func splitList(list string) []string {
+    return strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+func addInts(set *map[int]bool, list string) error {
+    if *set == nil {
+        *set = make(map[int]bool)
+    }
+    for _, s := range splitList(list) {
+        n, err := strconv.Atoi(s)
+        if err != nil {
+            return fmt.Errorf("%s: неверный идентификатор процесса", s)
+        }
+        (*set)[n] = true
+    }
+    return nil
+}
+
+func addStrings(set *map[string]bool, list string) {
+    if *set == nil {
+        *set = make(map[string]bool)
+    }
+    for _, s := range splitList(list) {
+        (*set)[s] = true
+    }
+}
+
+// parsePsArgs разбирает параметры ps. Параметры со значением
+// принимают его слитно (-opid) или следующим аргументом (-o pid),
+// длинные - также через "=" (--sort=-pcpu). Короткие флаги можно
+// сливать: -ef, -eo pid; -aux понимается как aux.
+func parsePsArgs(args []string) (*psOptions, error) {
+    opts := &psOptions{}
+    for i := 0; i < len(args); i++ {
+        arg := args[i]
+        name, value, hasValue := arg, "", false
+        switch {
+        case strings.HasPrefix(arg, "--"):
+            name, value, hasValue = strings.Cut(arg, "=")
+        case strings.HasPrefix(arg, "-") && len(arg) > 2 && strings.Trim(arg[1:], "aux") == "":
+            name = arg[1:]
+        case strings.HasPrefix(arg, "-") && len(arg) > 2 && strings.ContainsRune("eAaxf", rune(arg[1])):
+            // остаток разбирается следующим аргументом: -ef как -e -f
+            args = slices.Insert(slices.Clone(args), i+1, "-"+arg[2:])
+            name = arg[:2]
+        case strings.HasPrefix(arg, "-") && len(arg) > 2 && strings.ContainsRune("opuC", rune(arg[1])):
+            name, value, hasValue = arg[:2], arg[2:], true
+        }
+
+        needValue := func() error {
+            if hasValue {
+                return nil
+            }
+            if i+1 >= len(args) {
+                return fmt.Errorf("%s: требуется аргумент", name)
+            }
+            i++
+            value = args[i]
+            return nil
+        }
+
+        var err error
+        switch name {
+        case "-o", "--format":
+            if err = needValue(); err == nil {
+                err = opts.addColumns(value)
+            }
+        case "-p", "--pid":
+            if err = needValue(); err == nil {
+                err = addInts(&opts.filter.pids, value)
+            }
+        case "--ppid":
+            if err = needValue(); err == nil {
+                err = addInts(&opts.filter.ppids, value)
+            }
+        case "-u", "-U", "--user":
+            if err = needValue(); err == nil {
+                addStrings(&opts.filter.users, value)
+            }
+        case "-C":
+            if err = needValue(); err == nil {
+                addStrings(&opts.filter.comms, value)
+            }
+        case "--sort":
+            if err = needValue(); err == nil {
+                err = opts.addSort(value)
+            }
+        case "--no-headers", "--no-heading":
+            opts.noHeaders = true
+        case "-e", "-A", "-a", "-x", "-f":
+            // все процессы выводятся и так
+        default:
+            // BSD-стиль без дефиса: ps aux, ps ax
+            if strings.Trim(name, "aux") != "" {
+                return nil, fmt.Errorf("%s: неверный параметр", name)
+            }
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if len(opts.columns) == 0 {
+        opts.addColumns(psDefault)
+    }
+    if len(opts.sort) == 0 {
+        opts.addSort("pid")
+    }
+    return opts, nil
+}
+
+// sortProcs упорядочивает процессы по ключам; при равенстве - по PID
+func sortProcs(procs []*procInfo, keys []psSortKey) {
+    slices.SortStableFunc(procs, func(a, b *procInfo) int {
+        for _, key := range keys {
+            c := key.col.cmp(a, b)
+            if key.desc {
+                c = -c
+            }
+            if c != 0 {
+                return c
+            }
+        }
+        return cmp.Compare(a.PID, b.PID)
+    })
+}
+
+// writeProcTable выводит процессы таблицей с выровненными столбцами.
+// Последний столбец не дополняется пробелами, чтобы длинные командные
+// строки не порождали хвостов.
+func writeProcTable(w io.Writer, cols []*psColumn, procs []*procInfo, sys *sysInfo, headers bool) error {
+    rows := make([][]string, 0, len(procs)+1)
+    if headers {
+        row := make([]string, len(cols))
+        for i, col := range cols {
+            row[i] = col.header
+        }
+        rows = append(rows, row)
+    }
+    for _, p := range procs {
+        row := make([]string, len(cols))
+        for i, col := range cols {
+            row[i] = col.value(p, sys)
+        }
+        rows = append(rows, row)
+    }
+
+    widths := make([]int, len(cols))
+    for _, row := range rows {
+        for i, cell := range row {
+            widths[i] = max(widths[i], len([]rune(cell)))
+        }
+    }
+
+    var b strings.Builder
+    for _, row := range rows {
+        for i, cell := range row {
+            if i > 0 {
+                b.WriteByte(' ')
+            }
+            pad := strings.Repeat(" ", widths[i]-len([]rune(cell)))
+            switch {
+            case cols[i].right:
+                b.WriteString(pad + cell)
+            case i == len(cols)-1:
+                b.WriteString(cell)
+            default:
+                b.WriteString(cell + pad)
+            }
+        }
+        b.WriteByte('\n')
+    }
+    _, err := io.WriteString(w, b.String())
+    return err
+}
+
+// builtinPs выводит процессы, читая /proc, без внешней программы ps:
+// ps [aux] [-o столбцы] [-p pid,...] [--ppid pid,...] [-u пользователь,...]
+// [-C команда,...] [--sort [-]столбец,...] [--no-headers]
+func builtinPs(sh *Shell, args []string, stdio Stdio) error {
+    opts, err := parsePsArgs(args[1:])
+    if err != nil {
+        return fmt.Errorf("ps: %v", err)
+    }
+    sys, err := readSysInfo()
+    if err != nil {
+        return fmt.Errorf("ps: %v", err)
+    }
+    all, err := readProcs(sys)
+    if err != nil {
+        return fmt.Errorf("ps: %v", err)
+    }
+
+    var procs []*procInfo
+    for _, p := range all {
+        if opts.filter.match(p) {
+            procs = append(procs, p)
+        }
+    }
+    sortProcs(procs, opts.sort)
+    // как procps: если все заголовки пусты, строка заголовков не выводится
+    headers := !opts.noHeaders && slices.ContainsFunc(opts.columns, func(col *psColumn) bool { return col.header != "" })
+    if err := writeProcTable(stdio.Stdout, opts.columns, procs, sys, headers); err != nil {
+        return err
+    }
+    // как procps: ничего не найдено - код 1
+    if len(procs) == 0 {
+        return ExitStatus(1)
+    }
+    return nil
+}
+
+// parseTopArgs разбирает параметры top:
+// [-b] [-n обновлений] [-d секунды] [-m строк] [-o [-]столбец]
+// [-p pid,...] [-u пользователь]
+func parseTopArgs(args []string) (*psOptions, error) {
+    opts := &psOptions{delay: 3 * time.Second, lines: 20}
+    for i := 0; i < len(args); i++ {
+        arg := args[i]
+        if arg == "-b" {
+            opts.batch = true
+            continue
+        }
+        if len(arg) < 2 || arg[0] != '-' || !strings.ContainsRune("ndmopu", rune(arg[1])) {
+            return nil, fmt.Errorf("%s: неверный параметр", arg)
+        }
+        value := arg[2:]
+        if value == "" && i+1 < len(args) {
+            i++
+            value = args[i]
+        }
+        if value == "" {
+            return nil, fmt.Errorf("%s: требуется аргумент", arg)
+        }
+
+        var err error
+        switch arg[1] {
+        case 'n', 'm':
+            n, convErr := strconv.Atoi(value)
+            if convErr != nil || n < 1 {
+                return nil, fmt.Errorf("-%c: %s: неверное число", arg[1], value)
+            }
+            if arg[1] == 'n' {
+                opts.frames = n
+            } else {
+                opts.lines = n
+            }
+        case 'd':
+            seconds, convErr := strconv.ParseFloat(value, 64)
+            if convErr != nil || seconds <= 0 {
+                return nil, fmt.Errorf("-d: %s: неверная задержка", value)
+            }
+            opts.delay = time.Duration(seconds * float64(time.Second))
+        case 'o':
+            // в top сортировка по умолчанию по убыванию
+            if value[0] != '+' && value[0] != '-' {
+                value = "-" + value
+            }
+            err = opts.addSort(value)
+        case 'p':
+            err = addInts(&opts.filter.pids, value)
+        case 'u':
+            addStrings(&opts.filter.users, value)
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    opts.addColumns(topDefault)
+    if len(opts.sort) == 0 {
+        opts.addSort("-pcpu")
+    }
+    return opts, nil
+}
+
+// builtinTop периодически выводит самые активные процессы и сводку
+// по системе, пока не выполнит -n обновлений или не будет прерван Ctrl+C.
+// Доля процессора считается по приросту времени между обновлениями.
+func builtinTop(sh *Shell, args []string, stdio Stdio) error {
+    opts, err := parseTopArgs(args[1:])
+    if err != nil {
+        return fmt.Errorf("top: %v", err)
+    }
+
+    prev := make(map[int]*procInfo)
+    var prevUptime float64
+    for frame := 1; ; frame++ {
+        sys, err := readSysInfo()
+        if err != nil {
+            return fmt.Errorf("top: %v", err)
+        }
+        all, err := readProcs(sys)
+        if err != nil {
+            return fmt.Errorf("top: %v", err)
+        }
+
+        seen := make(map[int]*procInfo, len(all))
+        var procs []*procInfo
+        for _, p := range all {
+            seen[p.PID] = p
+            // первое обновление показывает среднее с запуска процесса, как ps
+            if old, ok := prev[p.PID]; ok && old.StartTicks == p.StartTicks && sys.Uptime > prevUptime {
+                p.CPU = float64(p.CPUTicks-old.CPUTicks) / clockTicks / (sys.Uptime - prevUptime) * 100
+            }
+            if opts.filter.match(p) {
+                procs = append(procs, p)
+            }
+        }
+        prev, prevUptime = seen, sys.Uptime
+
+        sortProcs(procs, opts.sort)
+        if len(procs) > opts.lines {
+            procs = procs[:opts.lines]
+        }
+        if !opts.batch {
+            fmt.Fprint(stdio.Stdout, "\x1b[H\x1b[2J")
+        }
+        writeTopSummary(stdio.Stdout, sys, all)
+        if err := writeProcTable(stdio.Stdout, opts.columns, procs, sys, true); err != nil {
+            return err
+        }
+
+        if frame == opts.frames || !sh.sleepInterruptible(opts.delay) {
+            return nil
+        }
+        if opts.batch {
+            fmt.Fprintln(stdio.Stdout)
+        }
+    }
+}
+
+// writeTopSummary выводит заголовок top: время работы, нагрузку,
+// число процессов по состояниям и память
+func writeTopSummary(w io.Writer, sys *sysInfo, procs []*procInfo) {
+    uptime := int64(sys.Uptime)
+    days, hours, minutes := uptime/86400, uptime/3600%24, uptime/60%60
+    up := fmt.Sprintf("%d:%02d", hours, minutes)
+    if days > 0 {
+        up = fmt.Sprintf("%d дн. %s", days, up)
+    }
+    fmt.Fprintf(w, "top - %s, работает %s, нагрузка: %.2f, %.2f, %.2f\n",
+        time.Now().Format("15:04:05"), up, sys.Load[0], sys.Load[1], sys.Load[2])
+
+    var running, sleeping, stopped, zombie int
+    for _, p := range procs {
+        switch p.State {
+        case 'R':
+            running++
+        case 'S', 'D', 'I':
+            sleeping++
+        case 'T', 't':
+            stopped++
+        case 'Z':
+            zombie++
+        }
+    }
+    fmt.Fprintf(w, "Процессы: всего %d, выполняются %d, спят %d, остановлены %d, зомби %d\n",
+        len(procs), running, sleeping, stopped, zombie)
+    fmt.Fprintf(w, "Память, МиБ: всего %.1f, свободно %.1f, доступно %.1f\n\n",
+        float64(sys.MemTotal)/1024, float64(sys.MemFree)/1024, float64(sys.MemAvailable)/1024)
+}
+
+// sleepInterruptible ждет d и возвращает false, если ожидание прервано
+// Ctrl+C. Флаг прерывания не сбрасывается, чтобы остаток командной
+// строки тоже не выполнялся.
+func (sh *Shell) sleepInterruptible(d time.Duration) bool {
+    const step = 100 * time.Millisecond
+    for d > 0 {
+        if sh.jobs.interrupted.Load() {
+            return false
+        }
+        wait := min(d, step)
+        time.Sleep(wait)
+        d -= wait
+    }
+    return !sh.jobs.interrupted.Load()
+}
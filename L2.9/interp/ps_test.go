@@ -0,0 +1,76 @@
+package interp
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// fakeProc создает поддельную procfs с двумя процессами
+func fakeProc(t *testing.T) string {
+    root := t.TempDir()
+    files := map[string]string{
+        "uptime":     "1000.00 900.00\n",
+        "loadavg":    "0.50 0.25 0.10 1/100 42\n",
+        "stat":       "cpu 0 0 0 0\nbtime 1700000000\n",
+        "meminfo":    "MemTotal: 1000 kB\nMemFree: 500 kB\nMemAvailable: 700 kB\n",
+        "1/stat":     "1 (init) S 0 1 1 0 -1 0 0 0 0 0 300 200 0 0 20 0 1 0 10 4096000 50 0\n",
+        "1/status":   "Name:\tinit\nUid:\t0\t0\t0\t0\n",
+        "1/cmdline":  "/sbin/init\x00splash\x00",
+        "42/stat":    "42 (my (odd) cmd) R 1 42 1 34816 42 0 0 0 0 0 100 0 0 0 20 5 2 0 50000 8192000 100 0\n",
+        "42/status":  "Name:\todd\nUid:\t1000\t1000\t1000\t1000\n",
+        "42/cmdline": "",
+    }
+    for name, data := range files {
+        path := filepath.Join(root, name)
+        os.MkdirAll(filepath.Dir(path), 0755)
+        if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return root
+}
+
+func TestPs(t *testing.T) {
+    saved := procRoot
+    procRoot = fakeProc(t)
+    defer func() { procRoot = saved }()
+
+    var out bytes.Buffer
+    sh := New(Config{Env: []string{}, Dir: "/", Stdout: &out, Stderr: &out, Executor: NewFakeExecutor(nil)})
+
+    tests := []struct {
+        src    string
+        status int
+        output string
+    }{
+        {"ps -o pid,ppid,stat,tty,args", 0,
+            "PID PPID STAT TTY   COMMAND\n" +
+                "  1    0 Ss   ?     /sbin/init splash\n" +
+                " 42    1 RNl+ pts/0 [my (odd) cmd]\n"},
+        {"ps -o pid,uid,pmem,time --sort=-pid --no-headers", 0,
+            "42 1000 40.0 0:01\n 1    0 20.0 0:05\n"},
+        {"ps -o comm -p 1", 0, "COMMAND\ninit\n"},
+        {"ps -o pid -u 1000 --no-headers", 0, "42\n"},
+        {"ps -o pid -C nothing --no-headers", 1, ""},
+        {"ps -o pid,bogus", 1, "ps: bogus: неизвестный столбец\n"},
+        // слитные короткие флаги
+        {"ps -ef -o pid --no-headers", 0, " 1\n42\n"},
+        {"ps -aux -o pid --no-headers", 0, " 1\n42\n"},
+        {"ps -eopid --no-headers", 0, " 1\n42\n"},
+        {"ps -eq", 1, "ps: -q: неверный параметр\n"},
+        // свои и пустые заголовки
+        {"ps -o pid= -p 42", 0, "42\n"},
+        {"ps -o pid= -o comm=NAME", 0, "   NAME\n 1 init\n42 my (odd) cmd\n"},
+        {"ps -o 'pid,comm=Имя процесса' -p 1", 0, "PID Имя процесса\n  1 init\n"},
+        {"ps -o =X", 1, "ps: =X: не указан столбец\n"},
+    }
+    for _, test := range tests {
+        out.Reset()
+        status, _ := sh.Run(test.src)
+        if status != test.status || out.String() != test.output {
+            t.Errorf("%q: получили (%d, %q), ожидали (%d, %q)", test.src, status, out.String(), test.status, test.output)
+        }
+    }
+}
@@ -0,0 +1,137 @@
+package interp
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// Source выполняет команды из файла в интерпретаторе, как . и source.
+// Путь отсчитывается от рабочего каталога интерпретатора.
+func (sh *Shell) Source(path string) error {
+    err := sh.source(path, sh.stdio)
+    if sh.flow != flowExit {
+        sh.flow = flowNone
+    }
+    return err
+}
+
+func (sh *Shell) source(path string, stdio Stdio) error {
+    file, err := os.Open(sh.path(path))
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    sh.runLines(ReaderSource(file), stdio, false)
+    return nil
+}
+
+// LineSource возвращает очередную строку ввода; prompt выводится,
+// только если источник интерактивный
+type LineSource func(prompt string) (string, error)
+
+// ReaderSource читает строки из r без вывода приглашений
+func ReaderSource(r io.Reader) LineSource {
+    reader := bufio.NewReader(r)
+    return func(string) (string, error) {
+        line, err := reader.ReadString('\n')
+        if err != nil && (err != io.EOF || line == "") {
+            return "", err
+        }
+        return strings.TrimRight(line, "\r\n"), nil
+    }
+}
+
+// RunLines читает и выполняет команды, пока не закончится ввод или не
+// будет вызван exit. Многострочные конструкции (if, while, функции)
+// накапливаются, пока не станут синтаксически завершенными.
+// Возвращает код завершения шелла.
+func (sh *Shell) RunLines(read LineSource, interactive bool) int {
+    return sh.runLines(read, sh.stdio, interactive)
+}
+
+func (sh *Shell) runLines(read LineSource, stdio Stdio, interactive bool) int {
+    var pending strings.Builder
+    warnedStopped := false
+
+    // canExit не дает интерактивному шеллу с первой попытки выйти,
+    // пока есть остановленные задания, как это делает bash
+    canExit := func() bool {
+        if !interactive || warnedStopped || !sh.jobs.hasStopped() {
+            return true
+        }
+        fmt.Fprintln(stdio.Stderr, "Есть остановленные задания.")
+        warnedStopped = true
+        return false
+    }
+
+    for {
+        prompt := "$ " // shell prompt
+        if pending.Len() > 0 {
+            prompt = "> "
+        } else if interactive {
+            sh.jobs.notify(stdio.Stderr)
+        }
+
+        line, err := read(prompt)
+        if err == io.EOF {
+            if pending.Len() > 0 {
+                fmt.Fprintln(stdio.Stderr, "синтаксическая ошибка: неожиданный конец файла")
+                if interactive {
+                    pending.Reset()
+                    continue
+                }
+                return 2
+            }
+            if !canExit() {
+                continue
+            }
+            if interactive {
+                fmt.Fprintln(stdio.Stdout, "exit")
+            }
+            return sh.status
+        }
+        if err != nil {
+            fmt.Fprintln(stdio.Stderr, err)
+            return 1
+        }
+
+        if pending.Len() == 0 && strings.TrimSpace(line) == "\\quit" {
+            return sh.status
+        }
+
+        pending.WriteString(line)
+        pending.WriteString("\n")
+        list, err := Parse(pending.String(), sh.aliases)
+        if err == errIncomplete {
+            continue
+        }
+        pending.Reset()
+        if err != nil {
+            fmt.Fprintln(stdio.Stderr, err)
+            sh.status = 2
+            if !interactive {
+                return sh.status
+            }
+            continue
+        }
+
+        sh.runList(list, stdio)
+        if code, exited := sh.Exited(); exited {
+            if canExit() {
+                return code
+            }
+            sh.flow = flowNone
+            continue
+        }
+        if sh.flow == flowInterrupt {
+            if !interactive {
+                return sh.status
+            }
+            sh.flow = flowNone
+        }
+        warnedStopped = false
+    }
+}
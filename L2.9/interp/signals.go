@@ -0,0 +1,84 @@
+package interp
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "syscall"
+)
+
+// signalNames - имена сигналов без префикса SIG, понимаемые kill
+var signalNames = map[string]syscall.Signal{
+    "HUP":    syscall.SIGHUP,
+    "INT":    syscall.SIGINT,
+    "QUIT":   syscall.SIGQUIT,
+    "ILL":    syscall.SIGILL,
+    "TRAP":   syscall.SIGTRAP,
+    "ABRT":   syscall.SIGABRT,
+    "BUS":    syscall.SIGBUS,
+    "FPE":    syscall.SIGFPE,
+    "KILL":   syscall.SIGKILL,
+    "USR1":   syscall.SIGUSR1,
+    "SEGV":   syscall.SIGSEGV,
+    "USR2":   syscall.SIGUSR2,
+    "PIPE":   syscall.SIGPIPE,
+    "ALRM":   syscall.SIGALRM,
+    "TERM":   syscall.SIGTERM,
+    "CHLD":   syscall.SIGCHLD,
+    "CONT":   syscall.SIGCONT,
+    "STOP":   syscall.SIGSTOP,
+    "TSTP":   syscall.SIGTSTP,
+    "TTIN":   syscall.SIGTTIN,
+    "TTOU":   syscall.SIGTTOU,
+    "URG":    syscall.SIGURG,
+    "XCPU":   syscall.SIGXCPU,
+    "XFSZ":   syscall.SIGXFSZ,
+    "VTALRM": syscall.SIGVTALRM,
+    "PROF":   syscall.SIGPROF,
+    "WINCH":  syscall.SIGWINCH,
+    "IO":     syscall.SIGIO,
+    "PWR":    syscall.SIGPWR,
+    "SYS":    syscall.SIGSYS,
+}
+
+// parseSignal разбирает сигнал, заданный номером (9), именем (KILL)
+// или именем с префиксом (SIGKILL) в любом регистре
+func parseSignal(s string) (syscall.Signal, error) {
+    if n, err := strconv.Atoi(s); err == nil {
+        if n < 0 || n > 64 {
+            return 0, fmt.Errorf("%s: неверный номер сигнала", s)
+        }
+        return syscall.Signal(n), nil
+    }
+    name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+    if sig, ok := signalNames[name]; ok {
+        return sig, nil
+    }
+    return 0, fmt.Errorf("%s: неверная спецификация сигнала", s)
+}
+
+// signalName возвращает имя сигнала без префикса SIG
+func signalName(sig syscall.Signal) string {
+    for name, s := range signalNames {
+        if s == sig {
+            return name
+        }
+    }
+    return strconv.Itoa(int(sig))
+}
+
+// signalList возвращает список сигналов, упорядоченный по номеру, для kill -l
+func signalList() []string {
+    sigs := make([]int, 0, len(signalNames))
+    for _, sig := range signalNames {
+        sigs = append(sigs, int(sig))
+    }
+    sort.Ints(sigs)
+
+    list := make([]string, len(sigs))
+    for i, sig := range sigs {
+        list[i] = fmt.Sprintf("%2d) SIG%s", sig, signalName(syscall.Signal(sig)))
+    }
+    return list
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// Коды управляющих клавиш в raw-режиме
+const (
+    keyCtrlA     = 1
+    keyCtrlB     = 2
+    keyCtrlC     = 3
+    keyCtrlD     = 4
+    keyCtrlE     = 5
+    keyCtrlF     = 6
+    keyCtrlG     = 7
+    keyCtrlH     = 8
+    keyTab       = 9
+    keyCtrlJ     = 10
+    keyCtrlK     = 11
+    keyCtrlL     = 12
+    keyEnter     = 13
+    keyCtrlN     = 14
+    keyCtrlP     = 16
+    keyCtrlR     = 18
+    keyCtrlU     = 21
+    keyCtrlW     = 23
+    keyEsc       = 27
+    keyBackspace = 127
+)
+
+// Completer возвращает индекс начала дополняемого слова в line
+// и варианты, которыми это слово можно заменить
+type Completer func(line []rune, pos int) (int, []string)
+
+// LineEditor читает строки с терминала в raw-режиме с поддержкой
+// редактирования, истории команд и автодополнения.
+// Если ввод не является терминалом, строки читаются как есть.
+type LineEditor struct {
+    in       *os.File
+    reader   *bufio.Reader
+    out      io.Writer
+    history  *History
+    complete Completer
+    tty      bool
+}
+
+// NewLineEditor создает редактор строк поверх in
+func NewLineEditor(in *os.File, out io.Writer, history *History, complete Completer) *LineEditor {
+    return &LineEditor{
+        in:       in,
+        reader:   bufio.NewReader(in),
+        out:      out,
+        history:  history,
+        complete: complete,
+        tty:      isTerminal(in.Fd()),
+    }
+}
+
+// ReadLine выводит приглашение и читает одну строку.
+// Ctrl+D на пустой строке возвращает io.EOF.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+    if !e.tty {
+        fmt.Fprint(e.out, prompt)
+        line, err := e.reader.ReadString('\n')
+        if err != nil && (err != io.EOF || line == "") {
+            return "", err
+        }
+        return strings.TrimRight(line, "\r\n"), nil
+    }
+
+    restore, err := makeRaw(e.in.Fd())
+    if err != nil {
+        return "", err
+    }
+    defer restore()
+
+    s := &editState{editor: e, prompt: prompt, histIdx: e.history.Len()}
+    line, err := s.run()
+    if err != nil {
+        return "", err
+    }
+    if err := e.history.Add(line); err != nil {
+        fmt.Fprintf(e.out, "%v\r\n", err)
+    }
+    return line, nil
+}
+
+// editState - состояние редактирования одной строки
+type editState struct {
+    editor  *LineEditor
+    prompt  string
+    buf     []rune
+    pos     int
+    histIdx int
+    saved   []rune // строка, которую вводили до перехода по истории
+    lastKey rune
+}
+
+func (s *editState) write(str string) {
+    io.WriteString(s.editor.out, str)
+}
+
+// refresh перерисовывает строку и ставит курсор на место
+func (s *editState) refresh() {
+    var b strings.Builder
+    b.WriteString("\r")
+    b.WriteString(s.prompt)
+    b.WriteString(string(s.buf))
+    b.WriteString("\x1b[K")
+    if back := len(s.buf) - s.pos; back > 0 {
+        fmt.Fprintf(&b, "\x1b[%dD", back)
+    }
+    s.write(b.String())
+}
+
+func (s *editState) run() (string, error) {
+    s.refresh()
+    for {
+        r, _, err := s.editor.reader.ReadRune()
+        if err != nil {
+            return "", err
+        }
+
+        switch r {
+        case keyEnter, keyCtrlJ:
+            s.write("\r\n")
+            return string(s.buf), nil
+        case keyCtrlC:
+            // Отменяем ввод текущей строки
+            s.write("^C\r\n")
+            return "", nil
+        case keyCtrlD:
+            if len(s.buf) == 0 {
+                s.write("\r\n")
+                return "", io.EOF
+            }
+            s.deleteAt(s.pos)
+        case keyBackspace, keyCtrlH:
+            if s.pos > 0 {
+                s.pos--
+                s.deleteAt(s.pos)
+            }
+        case keyTab:
+            s.completeWord(s.lastKey == keyTab)
+        case keyCtrlA:
+            s.pos = 0
+        case keyCtrlE:
+            s.pos = len(s.buf)
+        case keyCtrlB:
+            s.moveLeft()
+        case keyCtrlF:
+            s.moveRight()
+        case keyCtrlK:
+            s.buf = s.buf[:s.pos]
+        case keyCtrlU:
+            s.buf = append([]rune{}, s.buf[s.pos:]...)
+            s.pos = 0
+        case keyCtrlW:
+            s.deleteWord()
+        case keyCtrlL:
+            s.write("\x1b[H\x1b[2J")
+        case keyCtrlP:
+            s.historyPrev()
+        case keyCtrlN:
+            s.historyNext()
+        case keyCtrlR:
+            execute, err := s.reverseSearch()
+            if err != nil {
+                return "", err
+            }
+            if execute {
+                s.refresh()
+                s.write("\r\n")
+                return string(s.buf), nil
+            }
+        case keyEsc:
+            s.handleEscape(s.readEscape())
+        default:
+            if r >= ' ' {
+                s.insert([]rune{r})
+            }
+        }
+
+        s.lastKey = r
+        s.refresh()
+    }
+}
+
+// readEscape читает остаток escape-последовательности после ESC
+func (s *editState) readEscape() string {
+    b, err := s.editor.reader.ReadByte()
+    if err != nil || (b != '[' && b != 'O') {
+        return ""
+    }
+    seq := []byte{b}
+    for {
+        c, err := s.editor.reader.ReadByte()
+        if err != nil {
+            return ""
+        }
+        seq = append(seq, c)
+        if c >= 0x40 && c <= 0x7e {
+            return string(seq)
+        }
+    }
+}
+
+func (s *editState) handleEscape(seq string) {
+    switch seq {
+    case "[A", "OA":
+        s.historyPrev()
+    case "[B", "OB":
+        s.historyNext()
+    case "[C", "OC":
+        s.moveRight()
+    case "[D", "OD":
+        s.moveLeft()
+    case "[H", "OH", "[1~", "[7~":
+        s.pos = 0
+    case "[F", "OF", "[4~", "[8~":
+        s.pos = len(s.buf)
+    case "[3~":
+        s.deleteAt(s.pos)
+    }
+}
+
+func (s *editState) moveLeft() {
+    if s.pos > 0 {
+        s.pos--
+    }
+}
+
+func (s *editState) moveRight() {
+    if s.pos < len(s.buf) {
+        s.pos++
+    }
+}
+
+func (s *editState) insert(text []rune) {
+    buf := make([]rune, 0, len(s.buf)+len(text))
+    buf = append(buf, s.buf[:s.pos]...)
+    buf = append(buf, text...)
+    buf = append(buf, s.buf[s.pos:]...)
+    s.buf = buf
+    s.pos += len(text)
+}
+
+func (s *editState) deleteAt(i int) {
+    if i < len(s.buf) {
+        s.buf = append(s.buf[:i], s.buf[i+1:]...)
+    }
+}
+
+// deleteWord удаляет слово перед курсором (Ctrl+W)
+func (s *editState) deleteWord() {
+    start := s.pos
+    for start > 0 && s.buf[start-1] == ' ' {
+        start--
+    }
+    for start > 0 && s.buf[start-1] != ' ' {
+        start--
+    }
+    s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+    s.pos = start
+}
+
+func (s *editState) historyPrev() {
+    if s.histIdx == 0 {
+        return
+    }
+    if s.histIdx == s.editor.history.Len() {
+        s.saved = s.buf
+    }
+    s.histIdx--
+    s.setLine(s.editor.history.Get(s.histIdx))
+}
+
+func (s *editState) historyNext() {
+    if s.histIdx >= s.editor.history.Len() {
+        return
+    }
+    s.histIdx++
+    if s.histIdx == s.editor.history.Len() {
+        s.buf = s.saved
+        s.pos = len(s.buf)
+        return
+    }
+    s.setLine(s.editor.history.Get(s.histIdx))
+}
+
+func (s *editState) setLine(line string) {
+    s.buf = []rune(line)
+    s.pos = len(s.buf)
+}
+
+// completeWord дополняет слово под курсором. Если вариантов несколько,
+// вставляется их общий префикс, а повторное нажатие Tab выводит список.
+func (s *editState) completeWord(repeated bool) {
+    if s.editor.complete == nil {
+        return
+    }
+    start, candidates := s.editor.complete(s.buf, s.pos)
+    if len(candidates) == 0 {
+        s.write("\a")
+        return
+    }
+
+    word := string(s.buf[start:s.pos])
+    replacement := commonPrefix(candidates)
+    if len(candidates) == 1 && !strings.HasSuffix(replacement, "/") {
+        replacement += " "
+    }
+
+    if replacement != word {
+        rest := append([]rune{}, s.buf[s.pos:]...)
+        s.buf = append(s.buf[:start], []rune(replacement)...)
+        s.pos = len(s.buf)
+        s.buf = append(s.buf, rest...)
+        return
+    }
+
+    if !repeated {
+        s.write("\a")
+        return
+    }
+    s.write("\r\n" + formatColumns(candidates, terminalWidth(s.editor.in.Fd())))
+}
+
+// formatColumns раскладывает слова по колонкам под ширину терминала
+func formatColumns(words []string, width int) string {
+    colWidth := 0
+    for _, w := range words {
+        if n := len([]rune(w)) + 2; n > colWidth {
+            colWidth = n
+        }
+    }
+    perLine := width / colWidth
+    if perLine < 1 {
+        perLine = 1
+    }
+
+    var b strings.Builder
+    for i, w := range words {
+        b.WriteString(w)
+        if (i+1)%perLine == 0 || i == len(words)-1 {
+            b.WriteString("\r\n")
+        } else {
+            b.WriteString(strings.Repeat(" ", colWidth-len([]rune(w))))
+        }
+    }
+    return b.String()
+}
+
+// reverseSearch реализует Ctrl+R: инкрементальный поиск по истории
+// от новых записей к старым. Возвращает true, если найденную строку
+// нужно сразу выполнить (нажат Enter).
+func (s *editState) reverseSearch() (bool, error) {
+    history := s.editor.history
+    original, originalPos := s.buf, s.pos
+    var query []rune
+    match := -1
+    failed := false
+
+    for {
+        line := ""
+        if match >= 0 {
+            line = history.Get(match)
+        }
+        label := "reverse-i-search"
+        if failed {
+            label = "failed reverse-i-search"
+        }
+        s.write(fmt.Sprintf("\r(%s)`%s': %s\x1b[K", label, string(query), line))
+
+        r, _, err := s.editor.reader.ReadRune()
+        if err != nil {
+            return false, err
+        }
+
+        switch {
+        case r == keyCtrlR:
+            // Ищем следующее, более старое совпадение
+            if match > 0 {
+                if found := history.Search(string(query), match-1); found >= 0 {
+                    match = found
+                    failed = false
+                    continue
+                }
+            }
+            failed = true
+        case r == keyBackspace || r == keyCtrlH:
+            if len(query) > 0 {
+                query = query[:len(query)-1]
+            }
+            match = history.Search(string(query), history.Len()-1)
+            failed = match < 0 && len(query) > 0
+        case r == keyCtrlG || r == keyCtrlC:
+            s.buf, s.pos = original, originalPos
+            return false, nil
+        case r == keyEnter || r == keyCtrlJ:
+            if match >= 0 {
+                s.setLine(history.Get(match))
+            }
+            return true, nil
+        case r == keyEsc:
+            if match >= 0 {
+                s.setLine(history.Get(match))
+            }
+            s.handleEscape(s.readEscape())
+            return false, nil
+        case r >= ' ':
+            query = append(query, r)
+            from := match
+            if from < 0 {
+                from = history.Len() - 1
+            }
+            if found := history.Search(string(query), from); found >= 0 {
+                match = found
+                failed = false
+            } else {
+                failed = true
+            }
+        default:
+            // Любая другая управляющая клавиша принимает найденную строку для редактирования
+            if match >= 0 {
+                s.setLine(history.Get(match))
+            }
+            return false, nil
+        }
+    }
+}
@@ -1,154 +1,60 @@
 package main
 
 import (
-    "bufio"
     "fmt"
-    "io"
     "os"
-    "os/exec"
-    "strings"
-    "strconv"
-    "syscall"
+    "path/filepath"
+
+    "shell/interp"
 )
 
 func main() {
-    reader := bufio.NewReader(os.Stdin)
-    for {
-        fmt.Print("$ ") // shell prompt
-        input, err := reader.ReadString('\n')
+    // shell script.sh [аргументы...] - выполнение сценария из файла
+    if len(os.Args) > 1 {
+        file, err := os.Open(os.Args[1])
         if err != nil {
             fmt.Fprintln(os.Stderr, err)
-            continue
-        }
-
-        input = strings.TrimSpace(input)
-        if input == "\\quit" {
-            break
-        }
-
-        if err := executeCommand(input); err != nil {
-            fmt.Fprintln(os.Stderr, err)
+            os.Exit(127)
         }
+        sh := interp.New(interp.Config{Name: os.Args[1], Args: os.Args[2:]})
+        code := sh.RunLines(interp.ReaderSource(file), false)
+        file.Close()
+        os.Exit(code)
     }
-}
-
-func executeCommand(input string) error {
-    // Разбиваем команду на пайпы
-    pipedCmds := strings.Split(input, "|")
-    var commands [][]string
 
-    // Парсим каждую команду в пайпе
-    for _, cmd := range pipedCmds {
-        args := strings.Fields(strings.TrimSpace(cmd))
-        if len(args) == 0 {
-            continue
-        }
-        commands = append(commands, args)
-    }
+    sh := interp.New(interp.Config{})
 
-    if len(commands) == 0 {
-        return nil
+    // Ввод не с терминала - читаем команды со stdin без приглашений
+    if !isTerminal(os.Stdin.Fd()) {
+        os.Exit(sh.RunLines(interp.ReaderSource(os.Stdin), false))
     }
 
-    // Если команда одна - выполняем её напрямую
-    if len(commands) == 1 {
-        return executeSingleCommand(commands[0])
-    }
-
-    return executePipeline(commands)
-}
-
-func executeSingleCommand(args []string) error {
-    switch args[0] {
-    case "cd":
-        if len(args) < 2 {
-            return os.Chdir(os.Getenv("HOME"))
-        }
-        return os.Chdir(args[1])
-    case "pwd":
-        dir, err := os.Getwd()
-        if err != nil {
-            return err
-        }
-        fmt.Println(dir)
-        return nil
-    case "echo":
-        fmt.Println(strings.Join(args[1:], " "))
-        return nil
-    case "kill":
-        if len(args) != 2 {
-            return fmt.Errorf("kill: неверное количество аргументов")
-        }
-        pid, err := strconv.Atoi(args[1])
-        if err != nil {
-            return fmt.Errorf("kill: неверный PID: %v", err)
-        }
-        return syscall.Kill(pid, syscall.SIGTERM)
-    case "ps":
-        cmd := exec.Command("ps", "aux")
-        cmd.Stdout = os.Stdout
-        cmd.Stderr = os.Stderr
-        return cmd.Run()
-    default:
-        cmd := exec.Command(args[0], args[1:]...)
-        cmd.Stdout = os.Stdout
-        cmd.Stderr = os.Stderr
-        cmd.Stdin = os.Stdin
-        return cmd.Run()
-    }
-}
-
-func executePipeline(commands [][]string) error {
-    var pipes [][2]io.ReadWriteCloser
-    var processes []*exec.Cmd
-
-    // Создаем пайпы между командами
-    for i := 0; i < len(commands)-1; i++ {
-        readPipe, writePipe := io.Pipe()
-        pipes = append(pipes, [2]io.ReadWriteCloser{readPipe, writePipe})
-    }
-
-    // Создаем команды
-    for i, command := range commands {
-        cmd := exec.Command(command[0], command[1:]...)
-
-        // Настраиваем stdin для первой команды
-        if i == 0 {
-            cmd.Stdin = os.Stdin
-        } else {
-            cmd.Stdin = pipes[i-1][0]
+    sh.EnableJobControl(int(os.Stdin.Fd()))
+    if path := rcPath(); path != "" {
+        if err := sh.Source(path); err != nil && !os.IsNotExist(err) {
+            fmt.Fprintln(os.Stderr, err)
         }
-
-        // Настраиваем stdout для последней команды
-        if i == len(commands)-1 {
-            cmd.Stdout = os.Stdout
-        } else {
-            cmd.Stdout = pipes[i][1]
+        if code, exited := sh.Exited(); exited {
+            os.Exit(code)
         }
-
-        cmd.Stderr = os.Stderr
-        processes = append(processes, cmd)
     }
-
-    // Запускаем все процессы
-    for _, cmd := range processes {
-        if err := cmd.Start(); err != nil {
-            return fmt.Errorf("ошибка запуска команды: %v", err)
-        }
+    history, err := LoadHistory(historyPath(), 1000)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
     }
+    editor := NewLineEditor(os.Stdin, os.Stdout, history, shellCompleter(sh))
+    os.Exit(sh.RunLines(editor.ReadLine, true))
+}
 
-    // Ждем завершения всех процессов
-    for _, cmd := range processes {
-        if err := cmd.Wait(); err != nil {
-            return fmt.Errorf("ошибка выполнения команды: %v", err)
-        }
+// rcPath возвращает файл начальной настройки интерактивного шелла:
+// $SHELLRC или ~/.shellrc
+func rcPath() string {
+    if path := os.Getenv("SHELLRC"); path != "" {
+        return path
     }
-
-    // Закрываем все пайпы
-    for _, pipe := range pipes {
-        pipe[0].Close()
-        pipe[1].Close()
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return ""
     }
-
-    return nil
-}
\ No newline at end of file
+    return filepath.Join(home, ".shellrc")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+    "syscall"
+    "unsafe"
+)
+
+// getTermios читает настройки терминала
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+    var t syscall.Termios
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&t)))
+    if errno != 0 {
+        return nil, errno
+    }
+    return &t, nil
+}
+
+// setTermios применяет настройки терминала
+func setTermios(fd uintptr, t *syscall.Termios) error {
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(t)))
+    if errno != 0 {
+        return errno
+    }
+    return nil
+}
+
+// isTerminal сообщает, подключен ли дескриптор к терминалу
+func isTerminal(fd uintptr) bool {
+    _, err := getTermios(fd)
+    return err == nil
+}
+
+// makeRaw переводит терминал в raw-режим: ввод без буферизации по строкам,
+// без эха и без генерации сигналов. Возвращает функцию восстановления.
+func makeRaw(fd uintptr) (func() error, error) {
+    old, err := getTermios(fd)
+    if err != nil {
+        return nil, err
+    }
+
+    raw := *old
+    raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+    raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+    raw.Cflag |= syscall.CS8
+    raw.Cc[syscall.VMIN] = 1
+    raw.Cc[syscall.VTIME] = 0
+    if err := setTermios(fd, &raw); err != nil {
+        return nil, err
+    }
+
+    return func() error {
+        return setTermios(fd, old)
+    }, nil
+}
+
+// terminalWidth возвращает ширину терминала в символах
+func terminalWidth(fd uintptr) int {
+    var ws struct {
+        Row, Col, Xpixel, Ypixel uint16
+    }
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+    if errno != 0 || ws.Col == 0 {
+        return 80
+    }
+    return int(ws.Col)
+}